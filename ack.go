@@ -0,0 +1,342 @@
+package que
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// AckMode is how a Worker acknowledges, by deleting them, the Jobs whose
+// WorkFunc succeeded. It trades throughput for the chance that a completed Job
+// is worked again after a crash. Jobs that are rescheduled or skipped are
+// always saved right away, and so are failed Jobs unless the Worker's
+// ErrorBatchWindow is set.
+type AckMode struct {
+	kind     ackKind
+	size     int
+	interval time.Duration
+}
+
+type ackKind int
+
+const (
+	ackImmediate ackKind = iota
+	ackBatched
+	ackOnCommit
+)
+
+// AckImmediate deletes every Job right after its WorkFunc returns. A Job is
+// worked again only if the process crashes, or loses its connection, between
+// the end of the WorkFunc and the deletion. It is the default.
+var AckImmediate = AckMode{}
+
+// AckOnCommit works every Job in a transaction, available to the WorkFunc as
+// Job.Tx, and deletes the Job in that same transaction. If the WorkFunc makes
+// all of its changes through Job.Tx, the changes and the acknowledgement
+// commit or roll back together, so a Job's effects are applied exactly once;
+// side effects outside the database can still happen more than once. The
+// transaction is rolled back if the WorkFunc fails or panics, before the
+// error is saved. It is the safest and, because of the transaction, slowest
+// mode, and it keeps a transaction open for as long as the WorkFunc runs.
+var AckOnCommit = AckMode{kind: ackOnCommit}
+
+// AckBatched acknowledges completed Jobs in batches of up to size Jobs, at
+// least every interval and whenever the Worker runs out of Jobs, with a single
+// statement. The Worker keeps the completed Jobs locked until then, so they are
+// not worked again in normal operation, but all of the Jobs of the current
+// batch are worked again if the process crashes. To hold their locks, the
+// Worker keeps a connection from the pool for as long as it runs. It is the
+// fastest mode for short Jobs.
+func AckBatched(size int, interval time.Duration) AckMode {
+	return AckMode{kind: ackBatched, size: size, interval: interval}
+}
+
+// Tx returns the transaction the Job is worked in if the Worker uses
+// AckOnCommit, and nil otherwise. Make the WorkFunc's changes through it so
+// they commit together with the Job's deletion. The Worker commits or rolls it
+// back: don't do it in the WorkFunc.
+func (j *Job) Tx() pgx.Tx {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.tx
+}
+
+// rollback rolls back the transaction of an AckOnCommit job, if any.
+func (j *Job) rollback() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.tx == nil {
+		return
+	}
+	if err := j.tx.Rollback(context.Background()); err != nil {
+		log.Printf("attempting to roll back job %d: %v", j.ID, err)
+	}
+	j.tx = nil
+}
+
+// commit commits the transaction of an AckOnCommit job, if any.
+func (j *Job) commit() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.tx == nil {
+		return nil
+	}
+	err := j.tx.Commit(context.Background())
+	j.tx = nil
+	return err
+}
+
+// releaseConn returns the job's connection to the pool, unless it belongs to
+// a Worker.
+func (j *Job) releaseConn() {
+	if !j.keepConn {
+		j.conn.Release()
+	}
+}
+
+// ackedJob identifies a completed job by the primary key of que_jobs.
+type ackedJob struct {
+	queue    string
+	priority int16
+	runAt    time.Time
+	id       int64
+
+	// locked is false if the job was leased, which released its lock.
+	locked bool
+}
+
+// failedJob is a failed job whose error is yet to be saved.
+type failedJob struct {
+	ackedJob
+	errorCount int32
+	delay      time.Duration
+	msg        string
+}
+
+// errorBatchSize is the maximum number of failures saved by one statement.
+const errorBatchSize = 100
+
+// ackBatchConn returns the connection that AckBatched jobs, and jobs whose
+// errors are batched, are locked on, acquiring it if needed. It returns nil
+// if neither is batched.
+func (w *Worker) ackBatchConn() (*pgxpool.Conn, error) {
+	if w.Ack.kind != ackBatched && w.ErrorBatchWindow <= 0 {
+		return nil, nil
+	}
+	if w.ackConn == nil {
+		conn, err := w.c.pool.Acquire(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		w.c.hold(conn)
+		w.ackConn = conn
+		w.ackConnSince = time.Now()
+		w.ackConnJobs = 0
+	}
+	if err := w.c.refresh(context.Background(), w.ackConn); err != nil {
+		return nil, err
+	}
+	return w.ackConn, nil
+}
+
+// recycleDue reports whether the Worker's connection has been used for more
+// Jobs, or held for longer, than allowed.
+func (w *Worker) recycleDue() bool {
+	if w.ackConn == nil {
+		return false
+	}
+	return w.MaxJobsBeforeRecycle > 0 && w.ackConnJobs >= w.MaxJobsBeforeRecycle ||
+		w.MaxConnAge > 0 && time.Since(w.ackConnSince) >= w.MaxConnAge
+}
+
+// recycleAckConn flushes the pending batches and closes the Worker's
+// connection, so that ackBatchConn opens a new one. Releasing it without
+// closing it would return it to the pool, which could hand it right back.
+func (w *Worker) recycleAckConn() {
+	w.Flush()
+	if w.ackConn == nil {
+		return
+	}
+	if err := w.ackConn.Conn().Close(context.Background()); err != nil {
+		log.Printf("attempting to close recycled connection: %v", err)
+	}
+	w.c.releaseHeld(w.ackConn)
+	w.ackConn = nil
+}
+
+// ackLater adds j to the batch of completed jobs, keeping it locked, and
+// flushes the batch if it is full or old enough.
+func (w *Worker) ackLater(j *Job) {
+	j.mu.Lock()
+	j.finalized = true
+	// keep the lock, which Done would release
+	j.conn = nil
+	locked := !j.leased
+	j.mu.Unlock()
+
+	if len(w.acks) == 0 {
+		w.acksSince = time.Now()
+	}
+	w.acks = append(w.acks, ackedJob{j.Queue, j.Priority, j.RunAt, j.ID, locked})
+	if len(w.acks) >= w.Ack.size || time.Since(w.acksSince) >= w.Ack.interval {
+		w.Flush()
+	}
+}
+
+// pendingIDs returns ids followed by the IDs of the Jobs whose acknowledgement
+// or error is pending. They are still in que_jobs, unchanged, and, unless
+// they were leased, locked on the Worker's connection, and advisory locks are
+// re-entrant, so the Worker must not try to lock them again.
+func (w *Worker) pendingIDs(ids []int64) []int64 {
+	for _, a := range w.acks {
+		ids = append(ids, a.id)
+	}
+	for _, f := range w.failures {
+		ids = append(ids, f.id)
+	}
+	return ids
+}
+
+// errorLater adds the failure of j to the batch of errors to save, keeping j
+// locked, and flushes the batch if it is full or old enough. It saves the
+// error right away if j isn't locked on the Worker's connection.
+func (w *Worker) errorLater(j *Job, msg string) error {
+	if !j.keepConn {
+		return j.Error(msg)
+	}
+
+	errorCount := j.ErrorCount + 1
+	j.mu.Lock()
+	j.finalized = true
+	// keep the lock, which Done would release
+	j.conn = nil
+	locked := !j.leased
+	j.mu.Unlock()
+
+	if len(w.failures) == 0 {
+		w.failuresSince = time.Now()
+	}
+	w.failures = append(w.failures, failedJob{
+		ackedJob:   ackedJob{j.Queue, j.Priority, j.RunAt, j.ID, locked},
+		errorCount: errorCount,
+		delay:      j.retryDelay(errorCount),
+		msg:        msg,
+	})
+	if len(w.failures) >= errorBatchSize || time.Since(w.failuresSince) >= w.ErrorBatchWindow {
+		w.Flush()
+	}
+	return nil
+}
+
+// Flush acknowledges the Jobs completed with AckBatched that are still
+// pending, by deleting and unlocking them, and saves the errors batched with
+// ErrorBatchWindow. Work calls it whenever it runs out of Jobs and before
+// returning; call it after using WorkOne directly.
+func (w *Worker) Flush() {
+	w.flushAcks()
+	w.flushErrors()
+}
+
+// flushDue reports whether a batch has been pending for longer than allowed.
+func (w *Worker) flushDue() bool {
+	return len(w.acks) > 0 && time.Since(w.acksSince) >= w.Ack.interval ||
+		len(w.failures) > 0 && time.Since(w.failuresSince) >= w.ErrorBatchWindow
+}
+
+func (w *Worker) flushAcks() {
+	if len(w.acks) == 0 {
+		return
+	}
+
+	var (
+		queues     = make([]string, len(w.acks))
+		priorities = make([]int16, len(w.acks))
+		runAts     = make([]time.Time, len(w.acks))
+		ids        = make([]int64, len(w.acks))
+		unlock     = make([]int64, 0, len(w.acks))
+	)
+	for i, a := range w.acks {
+		queues[i], priorities[i], runAts[i], ids[i] = a.queue, a.priority, a.runAt, a.id
+		if a.locked {
+			unlock = append(unlock, a.id)
+		}
+	}
+
+	err := w.c.refresh(context.Background(), w.ackConn)
+	if err == nil {
+		err = sendStmts(context.Background(), w.ackConn, []stmtArgs{
+			{w.c.stmt("que_ack_jobs"), []interface{}{queues, priorities, runAts, ids, w.c.LockKeyspace, unlock}},
+			{w.c.stmt("que_release_children"), []interface{}{ids}},
+		})
+	}
+	if err != nil {
+		log.Printf("attempting to acknowledge %d jobs: %v", len(w.acks), err)
+		w.dropAckConn()
+	}
+	w.acks = w.acks[:0]
+}
+
+func (w *Worker) flushErrors() {
+	if len(w.failures) == 0 {
+		return
+	}
+	if w.ackConn == nil {
+		// the connection was dropped, which unlocked the jobs
+		w.failures = w.failures[:0]
+		return
+	}
+
+	var (
+		queues      = make([]string, len(w.failures))
+		priorities  = make([]int16, len(w.failures))
+		runAts      = make([]time.Time, len(w.failures))
+		ids         = make([]int64, len(w.failures))
+		errorCounts = make([]int32, len(w.failures))
+		delays      = make([]int64, len(w.failures))
+		msgs        = make([]string, len(w.failures))
+		unlock      = make([]int64, 0, len(w.failures))
+	)
+	for i, f := range w.failures {
+		queues[i], priorities[i], runAts[i], ids[i] = f.queue, f.priority, f.runAt, f.id
+		errorCounts[i], delays[i], msgs[i] = f.errorCount, f.delay.Microseconds(), f.msg
+		if f.locked {
+			unlock = append(unlock, f.id)
+		}
+	}
+
+	err := w.c.refresh(context.Background(), w.ackConn)
+	if err == nil {
+		_, err = w.ackConn.Exec(context.Background(), w.c.stmt("que_set_errors"), queues, priorities, runAts, ids,
+			errorCounts, delays, msgs, w.c.LockKeyspace, unlock)
+	}
+	if err != nil {
+		log.Printf("attempting to save the errors of %d jobs: %v", len(w.failures), err)
+		w.dropAckConn()
+	}
+	w.failures = w.failures[:0]
+}
+
+// dropAckConn closes the Worker's connection after a failed flush. The jobs
+// are still locked by it, so closing it unlocks them and they will be worked
+// again.
+func (w *Worker) dropAckConn() {
+	w.ackConn.Conn().Close(context.Background())
+	w.c.releaseHeld(w.ackConn)
+	w.ackConn = nil
+}
+
+// releaseAckConn flushes the pending acknowledgements and returns the
+// Worker's connection to the pool.
+func (w *Worker) releaseAckConn() {
+	w.Flush()
+	if w.ackConn != nil {
+		w.c.releaseHeld(w.ackConn)
+		w.ackConn = nil
+	}
+}
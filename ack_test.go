@@ -0,0 +1,271 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWorkerAckBatched(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs := make(map[string]int)
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		runs[string(j.Args)]++
+		return nil
+	}})
+	w.Ack = AckBatched(n-1, time.Hour)
+	defer w.releaseAckConn()
+
+	for i := 0; i < n; i++ {
+		if !w.WorkOne() {
+			t.Fatalf("want didWork=true for job %d", i)
+		}
+	}
+
+	// the pending jobs are locked on the Worker's own connection, which must
+	// not lock them again
+	if len(runs) != n {
+		t.Errorf("want %d distinct jobs worked, got %v", n, runs)
+	}
+	for args, count := range runs {
+		if count != 1 {
+			t.Errorf("want job %s worked once, got %d", args, count)
+		}
+	}
+
+	// the first n-1 were acknowledged together, the last is pending
+	if left := countJobs(t, c.pool, "MyJob"); left != 1 {
+		t.Fatalf("want 1 job left, got %d", left)
+	}
+	// and still locked, so it isn't worked again
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		j.Done()
+		t.Fatalf("want pending job locked, got job %d", j.ID)
+	}
+
+	w.Flush()
+	if left := countJobs(t, c.pool, "MyJob"); left != 0 {
+		t.Errorf("want no jobs left after Flush, got %d", left)
+	}
+}
+
+func TestWorkerErrorBatchWindow(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		return errors.New("dependency down")
+	}})
+	w.ErrorBatchWindow = time.Hour
+	defer w.releaseAckConn()
+
+	for i := 0; i < 3; i++ {
+		if !w.WorkOne() {
+			t.Fatalf("want didWork=true for job %d", i)
+		}
+	}
+
+	// the failed jobs stay locked, without their errors, until the flush,
+	// and the Worker doesn't lock them again on its own connection
+	if len(w.failures) != 3 {
+		t.Fatalf("want 3 pending errors, got %d", len(w.failures))
+	}
+	seen := make(map[int64]bool)
+	for _, f := range w.failures {
+		if seen[f.id] {
+			t.Errorf("want each job failed once, got job %d again", f.id)
+		}
+		seen[f.id] = true
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		j.Done()
+		t.Fatalf("want failed jobs locked, got job %d", j.ID)
+	}
+
+	w.Flush()
+	jobs, err := c.ListJobs(JobFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("want 3 jobs, got %d", len(jobs))
+	}
+	for _, j := range jobs {
+		if j.ErrorCount != 1 {
+			t.Errorf("want ErrorCount=1 for job %d, got %d", j.ID, j.ErrorCount)
+		}
+		if j.LastError.String != "dependency down" || !j.RunAt.After(time.Now()) {
+			t.Errorf("want error saved and job rescheduled, got %+v", j)
+		}
+	}
+
+	var locks int
+	err = c.pool.QueryRow(context.Background(), "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory'").Scan(&locks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks != 0 {
+		t.Errorf("want failed jobs unlocked, got %d locks", locks)
+	}
+}
+
+func TestWorkerAckOnCommit(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	fail := true
+	w := NewWorker(c, WorkMap{
+		"Parent": func(j *Job) error {
+			// the side effect of the job, made in its transaction
+			if err := c.EnqueueInTx(&Job{Type: "Child"}, j.Tx()); err != nil {
+				return err
+			}
+			if fail {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	})
+	w.Ack = AckOnCommit
+
+	if err := c.Enqueue(&Job{Type: "Parent"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !w.WorkOne() {
+		t.Fatal("want didWork=true")
+	}
+	if n := countJobs(t, c.pool, "Child"); n != 0 {
+		t.Errorf("want side effect rolled back, got %d children", n)
+	}
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil || j.ErrorCount != 1 {
+		t.Fatalf("want parent with ErrorCount=1, got %+v", j)
+	}
+
+	// retry right away and succeed
+	fail = false
+	if _, err := c.pool.Exec(context.Background(), "UPDATE que_jobs SET run_at = now()"); err != nil {
+		t.Fatal(err)
+	}
+	if !w.WorkOne() {
+		t.Fatal("want didWork=true")
+	}
+	if n := countJobs(t, c.pool, "Parent"); n != 0 {
+		t.Errorf("want parent deleted, got %d", n)
+	}
+	if n := countJobs(t, c.pool, "Child"); n != 1 {
+		t.Errorf("want side effect committed, got %d children", n)
+	}
+}
+
+func BenchmarkWorkerAck(b *testing.B) {
+	log.SetOutput(ioutil.Discard)
+	defer func() {
+		log.SetOutput(os.Stdout)
+	}()
+
+	modes := []struct {
+		name string
+		mode AckMode
+	}{
+		{"Immediate", AckImmediate},
+		{"Batched", AckBatched(100, time.Second)},
+		{"OnCommit", AckOnCommit},
+	}
+	for _, m := range modes {
+		b.Run(fmt.Sprintf("Ack=%s", m.name), func(b *testing.B) {
+			c := openTestClient(b)
+			defer closePool(c.pool)
+
+			w := NewWorker(c, WorkMap{"Nil": nilWorker})
+			w.Ack = m.mode
+			defer w.releaseAckConn()
+
+			jobs := make([]*Job, b.N)
+			for i := range jobs {
+				jobs[i] = &Job{Type: "Nil"}
+			}
+			if err := c.EnqueueBatch(jobs); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.WorkOne()
+			}
+			w.Flush()
+		})
+	}
+}
+
+func TestWorkerMaxJobsBeforeRecycle(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pids []uint32
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		pids = append(pids, j.Conn().Conn().PgConn().PID())
+		return nil
+	}})
+	w.Ack = AckBatched(100, time.Hour)
+	w.MaxJobsBeforeRecycle = 2
+	defer w.releaseAckConn()
+
+	for i := 0; i < 3; i++ {
+		if !w.WorkOne() {
+			t.Fatalf("want didWork=true for job %d", i)
+		}
+	}
+
+	if len(pids) != 3 {
+		t.Fatalf("want 3 jobs worked, got %d", len(pids))
+	}
+	if pids[0] != pids[1] {
+		t.Errorf("want first 2 jobs on the same connection, got backends %d and %d", pids[0], pids[1])
+	}
+	if pids[2] == pids[1] {
+		t.Errorf("want connection re-acquired after 2 jobs, got backend %d again", pids[2])
+	}
+	// recycling flushed the batch of the first connection
+	if n := countJobs(t, c.pool, "MyJob"); n != 1 {
+		t.Errorf("want 1 job left, got %d", n)
+	}
+}
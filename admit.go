@@ -0,0 +1,67 @@
+package que
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// AdmitDecision is what a Worker's Admit func decides to do with a Job it
+// locked.
+type AdmitDecision int
+
+const (
+	// AdmitRun runs the Job as usual.
+	AdmitRun AdmitDecision = iota
+
+	// AdmitSkip releases the Job without running it, like a WorkFunc that
+	// returns ErrSkip, so that it is worked again later.
+	AdmitSkip
+
+	// AdmitDeadLetter moves the Job to the dead-letter table without running
+	// it.
+	AdmitDeadLetter
+)
+
+func (d AdmitDecision) String() string {
+	switch d {
+	case AdmitRun:
+		return "run"
+	case AdmitSkip:
+		return "skip"
+	case AdmitDeadLetter:
+		return "dead_letter"
+	}
+	return fmt.Sprintf("AdmitDecision(%d)", d)
+}
+
+// admit calls the Worker's Admit func for j, and carries out its decision
+// unless it is to run j. It reports whether j should run.
+func (w *Worker) admit(j *Job) bool {
+	if w.Admit == nil {
+		return true
+	}
+	d, err := w.Admit(j)
+	switch {
+	case d == AdmitDeadLetter:
+		if err == nil {
+			err = errors.New("not admitted")
+		}
+		if derr := j.DeadLetter(err.Error()); derr != nil {
+			log.Printf("attempting to dead-letter job %d: %v", j.ID, derr)
+		}
+		log.Printf("event=job_not_admitted job_id=%d job_type=%s decision=%s reason=%q", j.ID, j.Type, d, err)
+		w.observe(j, time.Now(), err)
+		return false
+	case err != nil:
+		w.skip(j)
+		log.Printf("event=job_admit_failed job_id=%d job_type=%s error=%q", j.ID, j.Type, err)
+		return false
+	case d == AdmitSkip:
+		w.skip(j)
+		log.Printf("event=job_not_admitted job_id=%d job_type=%s decision=%s", j.ID, j.Type, d)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package que
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdmitDecisionString(t *testing.T) {
+	for d, want := range map[AdmitDecision]string{
+		AdmitRun:          "run",
+		AdmitSkip:         "skip",
+		AdmitDeadLetter:   "dead_letter",
+		AdmitDecision(42): "AdmitDecision(42)",
+	} {
+		if got := d.String(); got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestWorkerAdmit(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		decision AdmitDecision
+		err      error
+		ran      bool
+		pending  bool
+		dead     string
+	}{
+		{name: "run", decision: AdmitRun, ran: true},
+		{name: "skip", decision: AdmitSkip, pending: true},
+		{name: "dead letter", decision: AdmitDeadLetter, dead: "not admitted"},
+		{name: "dead letter with reason", decision: AdmitDeadLetter, err: errors.New("tenant deleted"), dead: "tenant deleted"},
+		{name: "error", decision: AdmitRun, err: errors.New("flags unavailable"), pending: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := openTestClient(t)
+			defer closePool(c.pool)
+
+			if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+				t.Fatal(err)
+			}
+
+			ran := false
+			w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+				ran = true
+				return nil
+			}})
+			var admitted *Job
+			w.Admit = func(j *Job) (AdmitDecision, error) {
+				admitted = j
+				return tc.decision, tc.err
+			}
+			if !w.WorkOne() {
+				t.Fatal("want a job locked")
+			}
+
+			if admitted == nil || admitted.Type != "MyJob" {
+				t.Errorf("want Admit called with the locked job, got %+v", admitted)
+			}
+			if ran != tc.ran {
+				t.Errorf("want ran=%v, got %v", tc.ran, ran)
+			}
+
+			j, err := findOneJob(c.pool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pending := j != nil; pending != tc.pending {
+				t.Errorf("want pending=%v, got %v", tc.pending, pending)
+			}
+			if j != nil && j.ErrorCount != 0 {
+				t.Errorf("want no error recorded on a released job, got %d", j.ErrorCount)
+			}
+
+			dead, err := c.DeadJobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.dead == "" {
+				if len(dead) != 0 {
+					t.Errorf("want no dead jobs, got %d", len(dead))
+				}
+				return
+			}
+			if len(dead) != 1 {
+				t.Fatalf("want 1 dead job, got %d", len(dead))
+			}
+			if dead[0].LastError.String != tc.dead {
+				t.Errorf("want last error %q, got %q", tc.dead, dead[0].LastError.String)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrJobChanged is returned by Job.Advance if the Job's row no longer matches
+// the Job as it was locked.
+var ErrJobChanged = errors.New("que: job changed since it was locked")
+
+// Advance moves a state-machine Job to its next state: it sets the Job's Args
+// to newArgs, encoded like SetArgs does, and its RunAt to nextRunAt, and
+// clears its ErrorCount and LastError, with a single statement on the Job's
+// connection. The WorkFunc should then return nil, and the Job is kept
+// rather than deleted, to run again at nextRunAt with its new state.
+//
+// The update only applies to the Job's row as it was locked: if the row was
+// changed since, for instance rescheduled by a process that doesn't respect
+// the Job's lock, nothing is updated and ErrJobChanged is returned, so that no
+// update is lost. With AckOnCommit, the update is part of the Job's
+// transaction, and so commits together with the WorkFunc's changes.
+func (j *Job) Advance(newArgs interface{}, nextRunAt time.Time) error {
+	if err := j.SetArgs(newArgs); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.finalized {
+		return nil
+	}
+
+	var q queryable = j.conn
+	if j.tx != nil {
+		q = j.tx
+	} else if j.conn == nil {
+		return ErrNoConn
+	}
+	args, compression, compressed, err := compressArgs(j.Args, j.argsCompression())
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = j.healing("advance", func() error {
+		return q.QueryRow(context.Background(), j.stmt("que_advance_job"), j.Queue, j.Priority, j.RunAt, j.ID, args, nextRunAt, compression, compressed).Scan(&id)
+	})
+	if err == pgx.ErrNoRows {
+		return ErrJobChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	j.RunAt = nextRunAt
+	j.ErrorCount = 0
+	j.LastError.Set(nil)
+	j.reschedule = true
+	j.finalized = true
+	return nil
+}
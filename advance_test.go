@@ -0,0 +1,95 @@
+package que
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+type orderState struct {
+	Step string
+}
+
+func TestJobAdvance(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	next := map[string]string{"charge": "ship", "ship": "notify"}
+	var steps []string
+	w := NewWorker(c, WorkMap{"Order": func(j *Job) error {
+		var s orderState
+		if err := j.decodeArgs(&s); err != nil {
+			return err
+		}
+		steps = append(steps, s.Step)
+		if next[s.Step] == "" {
+			return nil // done
+		}
+		return j.Advance(orderState{Step: next[s.Step]}, time.Now().Add(-time.Second))
+	}})
+
+	j := &Job{Type: "Order"}
+	if err := j.SetArgs(orderState{Step: "charge"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.pool.Exec(context.Background(), "UPDATE que_jobs SET error_count = 2, last_error = 'declined'"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+	advanced, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advanced == nil {
+		t.Fatal("want job kept after advancing")
+	}
+	if want := `{"Step":"ship"}`; string(advanced.Args) != want {
+		t.Errorf("want Args=%s, got %s", want, advanced.Args)
+	}
+	if advanced.ErrorCount != 0 || advanced.LastError.Status == pgtype.Present {
+		t.Errorf("want error state cleared, got ErrorCount=%d LastError=%v", advanced.ErrorCount, advanced.LastError)
+	}
+
+	for w.WorkOne() {
+	}
+	if want, got := "[charge ship notify]", fmt.Sprint(steps); got != want {
+		t.Errorf("want steps %s, got %s", want, got)
+	}
+	if n := countJobs(t, c.pool, "Order"); n != 0 {
+		t.Errorf("want job deleted once done, got %d", n)
+	}
+}
+
+func TestJobAdvanceChanged(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "Order"}); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	// another process reschedules the job despite the lock
+	if _, err := c.pool.Exec(context.Background(), "UPDATE que_jobs SET run_at = run_at + interval '1 minute'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Advance(orderState{Step: "ship"}, time.Now()); err != ErrJobChanged {
+		t.Errorf("want ErrJobChanged, got %v", err)
+	}
+}
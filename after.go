@@ -0,0 +1,102 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ParentFailure is what happens to a Job enqueued with EnqueueAfter when its
+// parent Job fails permanently.
+type ParentFailure string
+
+const (
+	// CancelOnParentFailure deletes the Job.
+	CancelOnParentFailure ParentFailure = "cancel"
+
+	// DeadLetterOnParentFailure moves the Job to the dead-letter table, with
+	// a last error naming its parent.
+	DeadLetterOnParentFailure ParentFailure = "dead_letter"
+)
+
+// ErrParentFailed is returned by EnqueueAfter when the parent Job is in the
+// dead-letter table.
+var ErrParentFailed = errors.New("que: parent job failed")
+
+// EnqueueAfter adds j to the queue to run right after the Job with ID
+// parentID, typically a follow-up step on the same data. j is held back until
+// the parent is deleted, which Workers do when it succeeds, and then becomes
+// ready in the same transaction. If the parent fails permanently instead, that
+// is, it is moved to the dead-letter table, j is cancelled or dead-lettered as
+// onFailure says, and so are the Jobs enqueued after j, recursively. Failures
+// that are retried don't affect j.
+//
+// If the parent is no longer in que_jobs, it is assumed to have succeeded and
+// j is ready right away, unless the parent is in the dead-letter table, in
+// which case j isn't enqueued and ErrParentFailed is returned. The parent row
+// is locked while j is inserted, so a parent finalized concurrently either
+// sees j or is seen gone by EnqueueAfter.
+//
+// Ruby que ignores the blocked_by column used to hold j back, so Ruby Workers
+// sharing the queue may run j before its parent.
+func (c *Client) EnqueueAfter(parentID int64, j *Job, onFailure ParentFailure) error {
+	start := time.Now()
+	defer c.acquireEnqueueSlot()()
+	err := c.enqueueAfter(parentID, j, onFailure)
+	c.observeEnqueue(j.Queue, j.Type, 1, start, err)
+	return err
+}
+
+func (c *Client) enqueueAfter(parentID int64, j *Job, onFailure ParentFailure) error {
+	if j.Type == "" {
+		return ErrMissingType
+	}
+	if onFailure != CancelOnParentFailure && onFailure != DeadLetterOnParentFailure {
+		return fmt.Errorf("que: invalid ParentFailure %q", onFailure)
+	}
+	if err := c.checkRunAt(j); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The parent is locked FOR KEY SHARE, which blocks its deletion but not
+	// the updates of a retry, until j is committed. If it is already gone,
+	// the dead-letter table is checked by a later statement, which sees a
+	// parent dead-lettered while the lock was waited for.
+	var blocked *int64
+	var id int64
+	err = tx.QueryRow(ctx, c.stmt("que_lock_parent"), parentID).Scan(&id)
+	switch {
+	case err == nil:
+		blocked = &parentID
+	case err == pgx.ErrNoRows:
+		var failed bool
+		if err := tx.QueryRow(ctx, c.stmt("que_parent_failed"), parentID).Scan(&failed); err != nil {
+			return err
+		}
+		if failed {
+			return ErrParentFailed
+		}
+	default:
+		return err
+	}
+
+	args, err := insertArgs(j, c.argsCompression)
+	if err != nil {
+		return err
+	}
+	args = append(args, blocked, string(onFailure))
+	if err := tx.QueryRow(ctx, c.stmt("que_insert_job_after"), args...).Scan(&j.ID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,261 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestEnqueueAfterReleasedOnSuccess(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	parent := &Job{Type: "Parent"}
+	if err := c.Enqueue(parent); err != nil {
+		t.Fatal(err)
+	}
+	// the child has a higher priority, but must still wait for its parent
+	child := &Job{Type: "Child", Priority: 1}
+	if err := c.EnqueueAfter(parent.ID, child, CancelOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+
+	var worked []string
+	wf := func(j *Job) error {
+		worked = append(worked, j.Type)
+		return nil
+	}
+	w := NewWorker(c, WorkMap{"Parent": wf, "Child": wf})
+	for w.WorkOne() {
+	}
+
+	if fmt.Sprint(worked) != "[Parent Child]" {
+		t.Errorf("want [Parent Child], got %v", worked)
+	}
+}
+
+func TestEnqueueAfterParentFailure(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	parent := &Job{Type: "Parent"}
+	if err := c.Enqueue(parent); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := &Job{Type: "Cancelled"}
+	if err := c.EnqueueAfter(parent.ID, cancelled, CancelOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+	deadLettered := &Job{Type: "DeadLettered"}
+	if err := c.EnqueueAfter(parent.ID, deadLettered, DeadLetterOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(c, WorkMap{"Parent": func(j *Job) error {
+		return Permanent(errors.New("bad input"))
+	}})
+	if !w.WorkOne() {
+		t.Fatal("want parent worked")
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Errorf("want children removed from que_jobs, got %+v", j)
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 2 {
+		t.Fatalf("want 2 dead jobs, got %d", len(dead))
+	}
+	for _, d := range dead {
+		switch d.ID {
+		case parent.ID:
+		case deadLettered.ID:
+			if want := fmt.Sprintf("parent job %d failed", parent.ID); d.LastError.String != want {
+				t.Errorf("want LastError=%q, got %q", want, d.LastError.String)
+			}
+		default:
+			t.Errorf("want only the parent and the dead-lettered child, got %s", d.Type)
+		}
+	}
+
+	if err := c.EnqueueAfter(parent.ID, &Job{Type: "Late"}, CancelOnParentFailure); err != ErrParentFailed {
+		t.Errorf("want ErrParentFailed, got %v", err)
+	}
+}
+
+func TestEnqueueAfterFinishedParent(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.EnqueueAfter(12345, &Job{Type: "Child"}, CancelOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want the child of a finished parent ready, got none")
+	}
+	j.Done()
+}
+
+func TestEnqueueAfterGrandchildren(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	parent := &Job{Type: "Parent"}
+	if err := c.Enqueue(parent); err != nil {
+		t.Fatal(err)
+	}
+	child := &Job{Type: "Child"}
+	if err := c.EnqueueAfter(parent.ID, child, CancelOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+	grandchild := &Job{Type: "Grandchild"}
+	if err := c.EnqueueAfter(child.ID, grandchild, DeadLetterOnParentFailure); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.DeadLetter("bad input"); err != nil {
+		t.Fatal(err)
+	}
+	j.Done()
+
+	if j, err := findOneJob(c.pool); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Errorf("want descendants removed from que_jobs, got %+v", j)
+	}
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 2 {
+		t.Fatalf("want the parent and the grandchild dead, got %d dead jobs", len(dead))
+	}
+	for _, d := range dead {
+		if d.ID == grandchild.ID {
+			if want := fmt.Sprintf("parent job %d failed", child.ID); d.LastError.String != want {
+				t.Errorf("want LastError=%q, got %q", want, d.LastError.String)
+			}
+		}
+	}
+}
+
+func TestEnqueueAfterInvalidParentFailure(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.EnqueueAfter(12345, &Job{Type: "Child"}, ""); err == nil {
+		t.Error("want error for an empty ParentFailure")
+	}
+	if j, err := findOneJob(c.pool); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Errorf("want no job enqueued, got %+v", j)
+	}
+}
+
+// enqueueAfterRacing enqueues children of a new parent from several goroutines
+// while finalize removes the parent, and returns the number of children
+// enqueued.
+func enqueueAfterRacing(t *testing.T, c *Client, onFailure ParentFailure, finalize func(*Job) error) int {
+	parent := &Job{Type: "Parent"}
+	if err := c.Enqueue(parent); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want the parent locked")
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	enqueued := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.EnqueueAfter(parent.ID, &Job{Type: "Child"}, onFailure)
+			switch err {
+			case nil:
+				mu.Lock()
+				enqueued++
+				mu.Unlock()
+			case ErrParentFailed:
+			default:
+				t.Error(err)
+			}
+		}()
+		if i == n/2 {
+			if err := finalize(j); err != nil {
+				t.Error(err)
+			}
+			j.Done()
+		}
+	}
+	wg.Wait()
+	return enqueued
+}
+
+func TestEnqueueAfterConcurrentDelete(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	enqueued := enqueueAfterRacing(t, c, CancelOnParentFailure, (*Job).Delete)
+
+	var blocked, ready int
+	err := c.pool.QueryRow(context.Background(), `
+SELECT count(*) FILTER (WHERE blocked_by IS NOT NULL), count(*) FILTER (WHERE blocked_by IS NULL)
+FROM que_jobs`).Scan(&blocked, &ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 0 {
+		t.Errorf("want no child left blocked by a deleted parent, got %d", blocked)
+	}
+	if ready != enqueued {
+		t.Errorf("want %d children ready, got %d", enqueued, ready)
+	}
+}
+
+func TestEnqueueAfterConcurrentDeadLetter(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	enqueued := enqueueAfterRacing(t, c, DeadLetterOnParentFailure, func(j *Job) error {
+		return j.DeadLetter("bad input")
+	})
+
+	if j, err := findOneJob(c.pool); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Errorf("want no child left in que_jobs, got %+v", j)
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != enqueued+1 {
+		t.Errorf("want the parent and %d children dead, got %d dead jobs", enqueued, len(dead))
+	}
+}
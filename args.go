@@ -0,0 +1,253 @@
+package que
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// PositionalArgs encodes args as a top-level JSON array, which is the shape
+// Ruby Que uses for the positional arguments of a job's run method. Use it to
+// build the Args of a Job that will be worked by a Ruby consumer:
+//
+//	j := &que.Job{
+//	    Type: "ChargeCard",
+//	    Args: que.PositionalArgs(customerID, amount),
+//	}
+//
+// PositionalArgs panics if any of args cannot be marshaled to JSON. Use
+// Job.SetPositionalArgs to get an error instead.
+func PositionalArgs(args ...interface{}) []byte {
+	b, err := marshalPositionalArgs(args)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func marshalPositionalArgs(args []interface{}) ([]byte, error) {
+	if args == nil {
+		// encode no arguments as [] rather than null
+		args = []interface{}{}
+	}
+	return json.Marshal(args)
+}
+
+// SetPositionalArgs sets the Args of the Job to a JSON array containing args,
+// in order. See PositionalArgs.
+func (j *Job) SetPositionalArgs(args ...interface{}) error {
+	b, err := marshalPositionalArgs(args)
+	if err != nil {
+		return err
+	}
+	j.Args = b
+	return nil
+}
+
+// ScanArgs decodes array-shaped Args, as enqueued by Ruby or by
+// PositionalArgs, into dest. Each element of the array is unmarshaled into the
+// dest at the same position, so the number of elements must match the number
+// of dest values.
+//
+// As a convenience, if Args holds a JSON object rather than an array and a
+// single dest is given, the object is unmarshaled into it.
+func (j *Job) ScanArgs(dest ...interface{}) error {
+	err := j.scanArgs(dest)
+	if err != nil && j.argsNull {
+		return fmt.Errorf("decoding positional args: %w", ErrNullArgs)
+	}
+	return err
+}
+
+func (j *Job) scanArgs(dest []interface{}) error {
+	if j.argsErr != nil {
+		return fmt.Errorf("decoding positional args: %w", j.argsErr)
+	}
+	args := bytes.TrimSpace(j.Args)
+	if len(args) > 0 && args[0] == '{' && len(dest) == 1 {
+		return json.Unmarshal(args, dest[0])
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(args, &elems); err != nil {
+		return fmt.Errorf("decoding positional args: %w", err)
+	}
+	if len(elems) != len(dest) {
+		return fmt.Errorf("job has %d positional args, want %d", len(elems), len(dest))
+	}
+	for i, elem := range elems {
+		if err := json.Unmarshal(elem, dest[i]); err != nil {
+			return fmt.Errorf("decoding positional arg %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ErrNullArgs is wrapped by the errors returned when the Args of a Job were
+// NULL and the Client's NullArgs replacing them can't be decoded either, which
+// means that the Job was enqueued without the arguments its handler needs.
+var ErrNullArgs = errors.New("que: job args are null")
+
+// isNullArgs reports whether args, as read from the database, are NULL.
+func isNullArgs(args []byte) bool {
+	args = bytes.TrimSpace(args)
+	return len(args) == 0 || string(args) == "null"
+}
+
+// nullArgs returns the Args that replace NULL Args.
+func (c *Client) nullArgs() []byte {
+	if c.NullArgs == nil {
+		return []byte("[]")
+	}
+	return append([]byte(nil), c.NullArgs...)
+}
+
+// ArgsError is returned when a Job's Args can't be decoded into the type its
+// handler expects.
+type ArgsError struct {
+	// Mismatch is true if Args is valid JSON with the wrong shape, such as a
+	// field holding a string where the handler expects a number. This usually
+	// means the Job was enqueued before a deploy changed its args type, so
+	// retrying it won't help.
+	Mismatch bool
+
+	// Field is the path of the offending field, such as "Customer.ID", if it
+	// is known.
+	Field string
+
+	// Err is the underlying error from encoding/json.
+	Err error
+}
+
+func (e *ArgsError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("decoding args: field %s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("decoding args: %v", e.Err)
+}
+
+func (e *ArgsError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeOption configures the json.Decoder used by DecodeInto.
+type DecodeOption func(*json.Decoder)
+
+// DisallowUnknownFields makes DecodeInto fail with a mismatch when Args holds
+// an object field that has no matching field in the destination struct. The
+// TraceparentKey field added by TraceparentInjector is exempt.
+var DisallowUnknownFields DecodeOption = (*json.Decoder).DisallowUnknownFields
+
+// DecodeInto decodes the Args of j into v, with the Codec registered for the
+// Job's Type if there is one and as JSON otherwise. It is the recommended way
+// to decode Args, and the one used by TypedWorkFunc.
+//
+// Unlike json.Unmarshal, numbers decoded into interface{} values become
+// json.Number rather than float64, so integers beyond 2^53, such as ids and
+// amounts enqueued from Ruby, keep their exact value. Numbers decoded into
+// integer fields are exact either way.
+//
+// The options only apply to JSON Args. On failure DecodeInto returns an
+// *ArgsError.
+func DecodeInto(j *Job, v interface{}, opts ...DecodeOption) error {
+	return j.decodeArgs(v, opts...)
+}
+
+// decodeArgs unmarshals args into v, returning an *ArgsError on failure.
+func decodeArgs(args []byte, v interface{}, opts ...DecodeOption) error {
+	if len(opts) > 0 {
+		args = withoutTraceparent(args)
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	err := dec.Decode(v)
+	if err == nil {
+		if _, err := dec.Token(); err != io.EOF {
+			return &ArgsError{Err: errors.New("invalid data after top-level value")}
+		}
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &ArgsError{Mismatch: true, Field: typeErr.Field, Err: err}
+	}
+	// encoding/json has no type for unknown field errors
+	if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		return &ArgsError{Mismatch: true, Field: strings.Trim(field, `"`), Err: err}
+	}
+	return &ArgsError{Err: err}
+}
+
+var (
+	jobPtrType = reflect.TypeOf((*Job)(nil))
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// TypedWorkFunc adapts fn, which must be a func(*Job, T) error for some type T,
+// to a WorkFunc that decodes the Job's Args into a new T with DecodeInto before
+// calling fn:
+//
+//	type chargeArgs struct {
+//	    CustomerID int64
+//	    Amount     int
+//	}
+//
+//	wm := que.WorkMap{
+//	    "ChargeCard": que.TypedWorkFunc(func(j *que.Job, args chargeArgs) error {
+//	        return charge(args.CustomerID, args.Amount)
+//	    }),
+//	}
+//
+// If T is a pointer type, a pointer to a new value is passed to fn.
+//
+// When Args can't be decoded the returned WorkFunc fails with an *ArgsError. A
+// syntax error is retried like any other error. A schema mismatch, where Args
+// is valid JSON of the wrong shape, is marked Permanent so the Job is moved to
+// the dead-letter table instead of being retried pointlessly; fix the Job's
+// args there and move it back to que_jobs to run it again.
+//
+// TypedWorkFunc panics if fn has the wrong signature.
+func TypedWorkFunc(fn interface{}) WorkFunc {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		panic(fmt.Sprintf("que: TypedWorkFunc: want func(*que.Job, T) error, got %T", fn))
+	}
+	ft := fv.Type()
+	if ft.NumIn() != 2 || ft.In(0) != jobPtrType || ft.NumOut() != 1 || ft.Out(0) != errorType {
+		panic(fmt.Sprintf("que: TypedWorkFunc: want func(*que.Job, T) error, got %v", ft))
+	}
+
+	argsType := ft.In(1)
+	isPtr := argsType.Kind() == reflect.Ptr
+	if isPtr {
+		argsType = argsType.Elem()
+	}
+
+	return func(j *Job) error {
+		args := reflect.New(argsType)
+		if err := j.decodeArgs(args.Interface()); err != nil {
+			if argsErr := err.(*ArgsError); argsErr.Mismatch {
+				return Permanent(err)
+			}
+			return err
+		}
+		if !isPtr {
+			args = args.Elem()
+		}
+
+		out := fv.Call([]reflect.Value{reflect.ValueOf(j), args})
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	}
+}
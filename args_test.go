@@ -0,0 +1,379 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPositionalArgs(t *testing.T) {
+	if want, got := `[42,"foo",{"bar":true}]`, string(PositionalArgs(42, "foo", map[string]bool{"bar": true})); got != want {
+		t.Errorf("want Args=%s, got %s", want, got)
+	}
+	if want, got := `[]`, string(PositionalArgs()); got != want {
+		t.Errorf("want Args=%s, got %s", want, got)
+	}
+}
+
+func TestPositionalArgsPanicsOnInvalidArg(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("want panic for unmarshalable arg")
+		}
+	}()
+	PositionalArgs(make(chan int))
+}
+
+func TestJobSetPositionalArgs(t *testing.T) {
+	j := &Job{Type: "MyJob"}
+	if err := j.SetPositionalArgs("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `["a",1]`, string(j.Args); got != want {
+		t.Errorf("want Args=%s, got %s", want, got)
+	}
+
+	if err := j.SetPositionalArgs(make(chan int)); err == nil {
+		t.Error("want error for unmarshalable arg")
+	}
+}
+
+func TestJobScanArgs(t *testing.T) {
+	j := &Job{Args: []byte(`[7, "seven", {"n": 7}]`)}
+
+	var (
+		i int
+		s string
+		m struct{ N int }
+	)
+	if err := j.ScanArgs(&i, &s, &m); err != nil {
+		t.Fatal(err)
+	}
+	if i != 7 || s != "seven" || m.N != 7 {
+		t.Errorf("want 7, seven, {7}, got %d, %s, %+v", i, s, m)
+	}
+
+	if err := j.ScanArgs(&i, &s); err == nil {
+		t.Error("want error for wrong number of args")
+	}
+	if err := j.ScanArgs(&s, &i, &m); err == nil {
+		t.Error("want error for wrong arg type")
+	}
+}
+
+func TestJobScanArgsObject(t *testing.T) {
+	j := &Job{Args: []byte(`{"name": "bgentry"}`)}
+
+	var args struct{ Name string }
+	if err := j.ScanArgs(&args); err != nil {
+		t.Fatal(err)
+	}
+	if want := "bgentry"; args.Name != want {
+		t.Errorf("want Name=%q, got %q", want, args.Name)
+	}
+}
+
+func TestPositionalArgsRoundTrip(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Args: PositionalArgs(int64(1234), "foo", []string{"a", "b"})}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	var (
+		id   int64
+		name string
+		tags []string
+	)
+	if err := j.ScanArgs(&id, &name, &tags); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1234 || name != "foo" || len(tags) != 2 {
+		t.Errorf("want 1234, foo, [a b], got %d, %s, %v", id, name, tags)
+	}
+}
+
+func TestScanArgsRubyEnqueued(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	// enqueue the way Ruby's Que.enqueue(42, "foo", bar: true) stores args
+	_, err := c.pool.Exec(context.Background(), `
+	INSERT INTO que_jobs (job_class, args)
+	VALUES ('MyJob', '[42, "foo", {"bar": true}]'::json)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	var (
+		n    int
+		s    string
+		opts struct{ Bar bool }
+	)
+	if err := j.ScanArgs(&n, &s, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 || s != "foo" || !opts.Bar {
+		t.Errorf("want 42, foo, {true}, got %d, %s, %+v", n, s, opts)
+	}
+}
+
+func TestNullArgsRubyEnqueued(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, args := range []string{"null", "{}"} {
+		_, err := c.pool.Exec(context.Background(), `
+		INSERT INTO que_jobs (job_class, args)
+		VALUES ('MyJob', $1::json)`, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j, err := c.LockJob("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j == nil {
+			t.Fatal("wanted job, got none")
+		}
+
+		want := args
+		if args == "null" {
+			want = "[]"
+		}
+		if string(j.Args) != want {
+			t.Errorf("args %s: want Args=%s, got %s", args, want, j.Args)
+		}
+
+		var v chargeArgs
+		err = DecodeInto(j, &v)
+		if args == "null" && !errors.Is(err, ErrNullArgs) {
+			t.Errorf("args %s: want ErrNullArgs decoding a struct, got %v", args, err)
+		} else if args == "{}" && err != nil {
+			t.Errorf("args %s: want no error decoding a struct, got %v", args, err)
+		}
+
+		if err := j.Delete(); err != nil {
+			t.Fatal(err)
+		}
+		j.Done()
+	}
+}
+
+func TestNullArgsSQLNull(t *testing.T) {
+	c := openTestSchemaClient(t, "que_go_test_null_args")
+	defer closePool(c.pool)
+	c.NullArgs = []byte("{}")
+
+	_, err := c.pool.Exec(context.Background(), `
+	ALTER TABLE que_go_test_null_args.que_jobs ALTER COLUMN args DROP NOT NULL;
+	INSERT INTO que_go_test_null_args.que_jobs (job_class, args) VALUES ('MyJob', NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	var v chargeArgs
+	if err := DecodeInto(j, &v); err != nil {
+		t.Errorf("want NULL args decoded as {}, got %v", err)
+	}
+	var n int
+	if err := j.ScanArgs(&n); !errors.Is(err, ErrNullArgs) {
+		t.Errorf("want ErrNullArgs scanning positional args, got %v", err)
+	}
+}
+
+type chargeArgs struct {
+	Customer struct {
+		ID int64
+	}
+	Amount int
+}
+
+func TestTypedWorkFunc(t *testing.T) {
+	var got chargeArgs
+	wf := TypedWorkFunc(func(j *Job, args chargeArgs) error {
+		got = args
+		return nil
+	})
+
+	if err := wf(&Job{Args: []byte(`{"Customer": {"ID": 7}, "Amount": 100}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Customer.ID != 7 || got.Amount != 100 {
+		t.Errorf("want {7 100}, got %+v", got)
+	}
+}
+
+func TestTypedWorkFuncPointer(t *testing.T) {
+	var got *chargeArgs
+	wf := TypedWorkFunc(func(j *Job, args *chargeArgs) error {
+		got = args
+		return errors.New("handler error")
+	})
+
+	if err := wf(&Job{Args: []byte(`{"Amount": 100}`)}); err == nil || err.Error() != "handler error" {
+		t.Errorf("want handler error, got %v", err)
+	}
+	if got == nil || got.Amount != 100 {
+		t.Errorf("want &{Amount:100}, got %+v", got)
+	}
+}
+
+func TestTypedWorkFuncSchemaMismatch(t *testing.T) {
+	wf := TypedWorkFunc(func(j *Job, args chargeArgs) error {
+		t.Error("handler should not be called")
+		return nil
+	})
+
+	err := wf(&Job{Args: []byte(`{"Customer": {"ID": "cus_7"}, "Amount": 100}`)})
+	if !IsPermanent(err) {
+		t.Errorf("want permanent error, got %v", err)
+	}
+	var argsErr *ArgsError
+	if !errors.As(err, &argsErr) {
+		t.Fatalf("want *ArgsError, got %T", err)
+	}
+	if !argsErr.Mismatch {
+		t.Error("want Mismatch=true")
+	}
+	if !strings.Contains(argsErr.Field, "ID") {
+		t.Errorf("want Field to name the offending field, got %q", argsErr.Field)
+	}
+}
+
+func TestTypedWorkFuncSyntaxError(t *testing.T) {
+	wf := TypedWorkFunc(func(j *Job, args chargeArgs) error {
+		t.Error("handler should not be called")
+		return nil
+	})
+
+	err := wf(&Job{Args: []byte(`{"Amount": `)})
+	if IsPermanent(err) {
+		t.Errorf("want retryable error, got %v", err)
+	}
+	var argsErr *ArgsError
+	if !errors.As(err, &argsErr) {
+		t.Fatalf("want *ArgsError, got %T", err)
+	}
+	if argsErr.Mismatch {
+		t.Error("want Mismatch=false")
+	}
+}
+
+func TestTypedWorkFuncBadSignature(t *testing.T) {
+	for _, fn := range []interface{}{
+		nil,
+		func(j *Job) error { return nil },
+		func(args chargeArgs) error { return nil },
+		func(j *Job, args chargeArgs) {},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("want panic for %T", fn)
+				}
+			}()
+			TypedWorkFunc(fn)
+		}()
+	}
+}
+
+func TestDecodeIntoPreservesIntegers(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	// a 19-digit id, as enqueued by Ruby, beyond float64's exact range
+	const id = "9007199254740993123"
+	if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(`{"id":` + id + `,"amount":9223372036854775807}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	var generic map[string]interface{}
+	if err := DecodeInto(j, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := generic["id"].(json.Number); !ok || got.String() != id {
+		t.Errorf("want id=%s, got %#v", id, generic["id"])
+	}
+
+	var typed struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := DecodeInto(j, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(9223372036854775807); typed.Amount != want {
+		t.Errorf("want Amount=%d, got %d", want, typed.Amount)
+	}
+}
+
+func TestDecodeIntoDisallowUnknownFields(t *testing.T) {
+	j := &Job{Type: "MyJob", Args: []byte(`{"id":1,"extra":true}`)}
+
+	var args struct {
+		ID int64 `json:"id"`
+	}
+	if err := DecodeInto(j, &args); err != nil {
+		t.Fatalf("want unknown fields ignored by default, got %v", err)
+	}
+
+	err := DecodeInto(j, &args, DisallowUnknownFields)
+	var argsErr *ArgsError
+	if !errors.As(err, &argsErr) {
+		t.Fatalf("want *ArgsError, got %v", err)
+	}
+	if !argsErr.Mismatch || argsErr.Field != "extra" {
+		t.Errorf("want mismatch on field extra, got %+v", argsErr)
+	}
+}
+
+func TestDecodeIntoTrailingData(t *testing.T) {
+	j := &Job{Type: "MyJob", Args: []byte(`{"id":1} {"id":2}`)}
+
+	var args map[string]interface{}
+	err := DecodeInto(j, &args)
+	var argsErr *ArgsError
+	if !errors.As(err, &argsErr) || argsErr.Mismatch {
+		t.Errorf("want syntax *ArgsError, got %v", err)
+	}
+}
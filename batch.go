@@ -0,0 +1,143 @@
+package que
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// Checkpoint saves the Job's current Args to the database without finalizing
+// the Job, so that a Worker that locks the Job after a crash resumes from
+// them. It also refreshes the time the Job was locked, so that ReapStuck
+// doesn't consider a Job that checkpoints regularly stuck.
+//
+// The Job must be locked. With AckOnCommit, the checkpoint is only committed
+// with the rest of the Job's transaction.
+func (j *Job) Checkpoint() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.finalized {
+		return nil
+	}
+	if j.conn == nil {
+		return ErrNoConn
+	}
+	args, compression, compressed, err := compressArgs(j.Args, j.argsCompression())
+	if err != nil {
+		return err
+	}
+	_, err = j.conn.Exec(context.Background(), j.stmt("que_checkpoint_job"), j.Queue, j.Priority, j.RunAt, j.ID, args, compression, compressed)
+	return err
+}
+
+// BatchCheckpoint is the progress of a Job worked by a BatchJob WorkFunc,
+// saved as the Job's Args after every chunk. Decode the Args of a listed Job
+// into it to follow the progress of a backfill.
+type BatchCheckpoint struct {
+	// Cursor is where the next chunk starts, as returned by the BatchFetchFunc.
+	Cursor string `json:"cursor"`
+
+	// Chunks and Processed are the number of chunks and items processed so
+	// far.
+	Chunks    int64 `json:"chunks"`
+	Processed int64 `json:"processed"`
+}
+
+// BatchFetchFunc fetches the chunk of items that starts at cursor, which is
+// empty for the first chunk. It returns the items, usually a slice, and the
+// cursor of the next chunk, such as the last primary key of the chunk. done
+// reports whether this is the last chunk; the items of the last chunk may be
+// empty.
+type BatchFetchFunc func(ctx context.Context, cursor string) (items interface{}, next string, done bool, err error)
+
+// BatchProcessFunc processes a chunk of items returned by a BatchFetchFunc.
+type BatchProcessFunc func(ctx context.Context, items interface{}) error
+
+// BatchJob returns a WorkFunc for a long-running Job that works through a
+// large data set in chunks, such as a backfill of a large table: it calls
+// fetch and process for one chunk after the other, and checkpoints its
+// progress, as a BatchCheckpoint in the Job's Args, after every chunk. The
+// Job is deleted once fetch reports it's done.
+//
+// Each chunk runs in its own transactions, if any, so no transaction stays
+// open for the length of the Job. Enqueue the Job with empty Args, or with a
+// BatchCheckpoint to start from a given cursor; its Args are owned by the
+// WorkFunc, so parameters must be captured by fetch and process instead.
+//
+// If the process crashes, the Job is worked again from its last checkpoint,
+// so the chunk it was processing is processed again: process must be
+// idempotent. If fetch or process fail, the Job fails as usual and its retry
+// resumes from the last checkpoint too. When the Worker shuts down, the Job
+// stops after the current chunk and is rescheduled to resume right away.
+// Checkpoints also keep ReapStuck from reaping the Job as long as each chunk
+// takes less than its maxRuntime.
+//
+// BatchJob can't be used with AckOnCommit, whose transaction would span the
+// whole Job and hold back the checkpoints.
+func BatchJob(fetch BatchFetchFunc, process BatchProcessFunc) WorkFunc {
+	return func(j *Job) error {
+		if j.Tx() != nil {
+			return errors.New("que: BatchJob can't be used with AckOnCommit")
+		}
+
+		var cp BatchCheckpoint
+		if args := bytes.TrimSpace(j.Args); len(args) > 0 && !bytes.Equal(args, []byte("[]")) {
+			if err := json.Unmarshal(args, &cp); err != nil {
+				return fmt.Errorf("que: decoding batch checkpoint: %w", err)
+			}
+		}
+
+		ctx := j.Context()
+		for {
+			if ctx.Err() != nil {
+				// shutting down: resume elsewhere from the last checkpoint
+				j.Reschedule(time.Now())
+				return nil
+			}
+
+			items, next, done, err := fetch(ctx, cp.Cursor)
+			if err != nil {
+				return err
+			}
+			if n := batchLen(items); n > 0 {
+				if err := process(ctx, items); err != nil {
+					return err
+				}
+				cp.Processed += int64(n)
+			}
+			cp.Chunks++
+			cp.Cursor = next
+			if done {
+				log.Printf("event=batch_done job_id=%d job_type=%s chunks=%d processed=%d", j.ID, j.Type, cp.Chunks, cp.Processed)
+				return nil
+			}
+
+			if j.Args, err = json.Marshal(cp); err != nil {
+				return err
+			}
+			if err := j.Checkpoint(); err != nil {
+				return fmt.Errorf("que: saving batch checkpoint: %w", err)
+			}
+		}
+	}
+}
+
+// batchLen returns the number of items in a chunk: the length of a slice,
+// array or map, and otherwise 1 for a non-nil value.
+func batchLen(items interface{}) int {
+	if items == nil {
+		return 0
+	}
+	v := reflect.ValueOf(items)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len()
+	}
+	return 1
+}
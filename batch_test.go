@@ -0,0 +1,186 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestBatchLen(t *testing.T) {
+	for _, tc := range []struct {
+		items interface{}
+		want  int
+	}{
+		{nil, 0},
+		{[]int(nil), 0},
+		{[]int{1, 2, 3}, 3},
+		{map[string]int{"a": 1}, 1},
+		{"one item", 1},
+	} {
+		if got := batchLen(tc.items); got != tc.want {
+			t.Errorf("want batchLen(%#v)=%d, got %d", tc.items, tc.want, got)
+		}
+	}
+}
+
+// fetchInts returns a BatchFetchFunc over the integers [0, total), in chunks
+// of size, with the next integer as cursor.
+func fetchInts(total, size int) BatchFetchFunc {
+	return func(ctx context.Context, cursor string) (interface{}, string, bool, error) {
+		start := 0
+		if cursor != "" {
+			var err error
+			if start, err = strconv.Atoi(cursor); err != nil {
+				return nil, "", false, err
+			}
+		}
+		var items []int
+		for i := start; i < total && i < start+size; i++ {
+			items = append(items, i)
+		}
+		next := start + len(items)
+		return items, strconv.Itoa(next), next >= total, nil
+	}
+}
+
+func TestBatchJobResumes(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var processed []int
+	failAt := 6
+	process := func(ctx context.Context, items interface{}) error {
+		for _, i := range items.([]int) {
+			if i == failAt {
+				failAt = -1
+				return errors.New("transient failure")
+			}
+		}
+		processed = append(processed, items.([]int)...)
+		return nil
+	}
+	w := NewWorker(c, WorkMap{"Backfill": BatchJob(fetchInts(10, 3), process)})
+	w.RetryPolicy = ConstantBackoff(0)
+
+	if err := c.Enqueue(&Job{Type: "Backfill"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the third chunk fails, after the first two were checkpointed
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want failed job left")
+	}
+	var cp BatchCheckpoint
+	if err := json.Unmarshal(j.Args, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (BatchCheckpoint{Cursor: "6", Chunks: 2, Processed: 6}); cp != want {
+		t.Errorf("want checkpoint %+v, got %+v", want, cp)
+	}
+
+	// the retry resumes from the checkpoint
+	if !w.WorkOne() {
+		t.Fatal("want job retried")
+	}
+	if want, got := "[0 1 2 3 4 5 6 7 8 9]", fmt.Sprint(processed); got != want {
+		t.Errorf("want processed %s, got %s", want, got)
+	}
+	if j, err := findOneJob(c.pool); err != nil || j != nil {
+		t.Errorf("want job deleted, got %+v, %v", j, err)
+	}
+}
+
+func TestBatchJobShutdown(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var w *Worker
+	chunks := 0
+	process := func(ctx context.Context, items interface{}) error {
+		if chunks++; chunks == 2 {
+			w.cancel()
+		}
+		return nil
+	}
+	w = NewWorker(c, WorkMap{"Backfill": BatchJob(fetchInts(10, 3), process)})
+
+	if err := c.Enqueue(&Job{Type: "Backfill"}); err != nil {
+		t.Fatal(err)
+	}
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want job rescheduled")
+	}
+	if j.ErrorCount != 0 {
+		t.Errorf("want ErrorCount=0, got %d", j.ErrorCount)
+	}
+	var cp BatchCheckpoint
+	if err := json.Unmarshal(j.Args, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Cursor != "6" {
+		t.Errorf("want cursor 6 after 2 chunks, got %+v", cp)
+	}
+}
+
+// ExampleBatchJob backfills a new column of a table of 10 million users in
+// chunks of 10,000 rows, in primary key order.
+func ExampleBatchJob() {
+	var (
+		pool *pgxpool.Pool // the application's pool
+		c    *Client       // the Client of the Workers
+	)
+
+	fetch := func(ctx context.Context, cursor string) (interface{}, string, bool, error) {
+		after := int64(0)
+		if cursor != "" {
+			after, _ = strconv.ParseInt(cursor, 10, 64)
+		}
+		rows, err := pool.Query(ctx, `SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT 10000`, after)
+		if err != nil {
+			return nil, "", false, err
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, "", false, err
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return nil, cursor, true, rows.Err()
+		}
+		return ids, strconv.FormatInt(ids[len(ids)-1], 10), false, rows.Err()
+	}
+	process := func(ctx context.Context, items interface{}) error {
+		// idempotent, since a chunk is processed again after a crash
+		_, err := pool.Exec(ctx, `UPDATE users SET email_domain = split_part(email, '@', 2) WHERE id = ANY($1)`, items.([]int64))
+		return err
+	}
+
+	wm := WorkMap{"BackfillEmailDomain": BatchJob(fetch, process)}
+	_ = NewWorker(c, wm)
+	_ = c.Enqueue(&Job{Type: "BackfillEmailDomain"})
+}
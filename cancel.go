@@ -0,0 +1,70 @@
+package que
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// RequestCancel asks the Worker running the Job with the given id to cancel
+// it, from any process. The request is saved on the Job, and Workers with a
+// CancelCheckInterval pick it up and cancel the Job's context; WorkFuncs must
+// watch j.Context() for this to have any effect. If the Job isn't running yet,
+// it is cancelled shortly after it is started.
+//
+// RequestCancel reports whether the Job was running when it was called. It
+// returns false and no error if there is no such Job.
+func (c *Client) RequestCancel(id int64) (running bool, err error) {
+	err = c.pool.QueryRow(context.Background(), c.stmt("que_request_cancel"), id, c.LockKeyspace).Scan(&running)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return running, err
+}
+
+// cancelRequested reports whether the Worker cancelled the job because its
+// cancellation was requested.
+func (j *Job) cancelRequested() bool {
+	return atomic.LoadInt32(&j.cancelled) == 1
+}
+
+// watchCancel checks every CancelCheckInterval whether the cancellation of j
+// was requested, and if so calls cancel. The returned func stops watching.
+func (w *Worker) watchCancel(j *Job, cancel context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(w.CancelCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+
+			var requested bool
+			err := w.c.pool.QueryRow(context.Background(), w.c.stmt("que_cancel_requested"), j.ID).Scan(&requested)
+			if err != nil {
+				if err != pgx.ErrNoRows {
+					log.Printf("checking cancellation of job %d: %v", j.ID, err)
+				}
+				continue
+			}
+			if requested {
+				atomic.StoreInt32(&j.cancelled, 1)
+				cancel()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		cancel()
+	}
+}
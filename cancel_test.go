@@ -0,0 +1,132 @@
+package que
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestCancel(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "LongJob"}
+	if err := c.EnqueueBatch([]*Job{j}); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	w := NewWorker(c, WorkMap{
+		"LongJob": func(j *Job) error {
+			close(started)
+			select {
+			case <-j.Context().Done():
+				return j.Context().Err()
+			case <-time.After(10 * time.Second):
+				return nil
+			}
+		},
+	})
+	w.CancelCheckInterval = 10 * time.Millisecond
+
+	done := make(chan bool)
+	go func() {
+		done <- w.WorkOne()
+	}()
+	<-started
+
+	running, err := c.RequestCancel(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !running {
+		t.Error("want running=true")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want job cancelled")
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != j.ID {
+		t.Fatalf("want job %d dead-lettered, got %+v", j.ID, dead)
+	}
+	if !strings.Contains(dead[0].LastError.String, "cancelled by request") {
+		t.Errorf("want LastError to mention cancellation, got %q", dead[0].LastError.String)
+	}
+}
+
+func TestWorkerPoolRequestCancel(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "LongJob"}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	wp := NewWorkerPool(c, WorkMap{
+		"LongJob": func(j *Job) error {
+			close(started)
+			select {
+			case <-j.Context().Done():
+				close(cancelled)
+				return j.Context().Err()
+			case <-time.After(10 * time.Second):
+				return nil
+			}
+		},
+	}, 1)
+	wp.Interval = 10 * time.Millisecond
+	wp.CancelCheckInterval = 10 * time.Millisecond
+	wp.Start()
+	defer wp.Shutdown()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the job to start")
+	}
+	if _, err := c.RequestCancel(j.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want job cancelled")
+	}
+}
+
+func TestRequestCancelNotRunning(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "MyJob"}
+	if err := c.EnqueueBatch([]*Job{j}); err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := c.RequestCancel(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running {
+		t.Error("want running=false for a pending job")
+	}
+
+	running, err = c.RequestCancel(j.ID + 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running {
+		t.Error("want running=false for a missing job")
+	}
+}
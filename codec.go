@@ -0,0 +1,101 @@
+package que
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Codec encodes and decodes the Args of Jobs.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+// RegisterCodec sets the Codec used for the Args of Jobs of type typ, for
+// instance a protobuf codec for large internal jobs. Both Job.SetArgs and
+// TypedWorkFunc look up the codec by the Job's Type, so the enqueueing and the
+// working processes must register the same codecs. It is meant to be called
+// from an init function. Passing a nil Codec restores the default.
+//
+// Jobs of types without a registered codec have their Args encoded as plain
+// JSON. Because que_jobs.args is a json column, the output of a registered
+// codec is stored as a base64-encoded JSON string instead, which can hold
+// arbitrary bytes. Ruby workers can't decode those Args, so only register
+// codecs for job types that are both enqueued and worked from Go.
+func RegisterCodec(typ string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if c == nil {
+		delete(codecs, typ)
+		return
+	}
+	codecs[typ] = c
+}
+
+// codecFor returns the Codec registered for typ, or nil if there is none.
+func codecFor(typ string) Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	return codecs[typ]
+}
+
+// SetArgs encodes v as the Job's Args, using the Codec registered for the
+// Job's Type if there is one and JSON otherwise. Type must be set before
+// calling SetArgs.
+func (j *Job) SetArgs(v interface{}) error {
+	if j.Type == "" {
+		return ErrMissingType
+	}
+
+	c := codecFor(j.Type)
+	if c == nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		j.Args = b
+		return nil
+	}
+
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// a []byte is marshaled as a base64-encoded string
+	if j.Args, err = json.Marshal(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeArgs decodes the Job's Args into v with the Codec registered for the
+// Job's Type, or as JSON with opts if there is none. It returns an *ArgsError
+// on failure.
+func (j *Job) decodeArgs(v interface{}, opts ...DecodeOption) error {
+	if j.argsErr != nil {
+		return &ArgsError{Err: j.argsErr}
+	}
+	c := codecFor(j.Type)
+	if c == nil {
+		err := decodeArgs(j.Args, v, opts...)
+		if err != nil && j.argsNull {
+			return &ArgsError{Mismatch: true, Err: ErrNullArgs}
+		}
+		return err
+	}
+	var b []byte
+	if err := json.Unmarshal(j.Args, &b); err != nil {
+		return &ArgsError{Err: err}
+	}
+	if err := c.Unmarshal(b, v); err != nil {
+		return &ArgsError{Err: err}
+	}
+	return nil
+}
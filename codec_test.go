@@ -0,0 +1,101 @@
+package que
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type resizeArgs struct {
+	Path   string
+	Widths []int
+}
+
+func TestJobSetArgsDefaultJSON(t *testing.T) {
+	j := &Job{Type: "JSONJob"}
+	if err := j.SetArgs(resizeArgs{Path: "a.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `{"Path":"a.png","Widths":null}`, string(j.Args); got != want {
+		t.Errorf("want Args=%s, got %s", want, got)
+	}
+
+	if err := (&Job{}).SetArgs(resizeArgs{}); err != ErrMissingType {
+		t.Errorf("want %v, got %v", ErrMissingType, err)
+	}
+}
+
+func TestJobSetArgsCodec(t *testing.T) {
+	RegisterCodec("GobJob", gobCodec{})
+	defer RegisterCodec("GobJob", nil)
+
+	j := &Job{Type: "GobJob"}
+	want := resizeArgs{Path: "a.png", Widths: []int{100, 200}}
+	if err := j.SetArgs(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// binary codec output must still be valid for the json args column
+	var s string
+	if err := json.Unmarshal(j.Args, &s); err != nil {
+		t.Fatalf("want Args to be a JSON string, got %s: %v", j.Args, err)
+	}
+
+	var got resizeArgs
+	wf := TypedWorkFunc(func(j *Job, args resizeArgs) error {
+		got = args
+		return nil
+	})
+	if err := wf(j); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != want.Path || len(got.Widths) != 2 {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	RegisterCodec("GobJob", gobCodec{})
+	defer RegisterCodec("GobJob", nil)
+
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "GobJob"}
+	if err := j.SetArgs(resizeArgs{Path: "b.png", Widths: []int{64}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer locked.Done()
+
+	var args resizeArgs
+	if err := locked.decodeArgs(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Path != "b.png" || len(args.Widths) != 1 || args.Widths[0] != 64 {
+		t.Errorf("want {b.png [64]}, got %+v", args)
+	}
+}
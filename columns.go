@@ -0,0 +1,99 @@
+package que
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// jobColumns caches the columns of que_jobs, as found by Client.readQuery.
+type jobColumns struct {
+	mu   sync.Mutex
+	cols map[string]bool
+}
+
+// readQuery returns the text of the read query sql, qualified for the
+// Client's schema, with its %s verb, if any, replaced by the columns to
+// select, as scanned by scanListedJob, with the args only selected when the
+// condition withArgs holds. The columns of que_jobs are looked up once;
+// columns added after que 0.x that are missing are selected as empty values.
+//
+// The read queries are sent as text rather than prepared when connecting, so
+// that ListJobs, Peek, GetJob, LoadArgs and QueueStats work on connections
+// without prepared statements, such as those of a read replica or of a
+// database whose schema predates some of que's columns, where preparing the
+// other statements would fail.
+func (c *Client) readQuery(ctx context.Context, sql, withArgs string) (string, error) {
+	if strings.Contains(sql, "%s") {
+		cols, err := c.jobColumns(ctx)
+		if err != nil {
+			return "", err
+		}
+		optional := func(col string) string {
+			if cols[col] {
+				return "coalesce(" + col + ", '')"
+			}
+			return "''::text"
+		}
+		args := "convert_to(args::text, 'UTF8')"
+		if cols["compressed_args"] {
+			args = "coalesce(compressed_args, " + args + ")"
+		}
+		sql = fmt.Sprintf(sql, strings.Join([]string{
+			"queue", "priority", "run_at", "job_id", "job_class",
+			"CASE WHEN " + withArgs + " THEN " + args + " END", "error_count", "last_error",
+			optional("unique_key"), optional("routing_key"), optional("args_compression"),
+		}, ", "))
+	}
+	return qualifySQL(c.schema, sql), nil
+}
+
+// forget clears the cache, so that the columns are looked up again.
+func (cs *jobColumns) forget() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.cols = nil
+}
+
+// jobColumns returns the set of the columns of que_jobs.
+func (c *Client) jobColumns(ctx context.Context) (map[string]bool, error) {
+	c.columns.mu.Lock()
+	defer c.columns.mu.Unlock()
+
+	if c.columns.cols != nil {
+		return c.columns.cols, nil
+	}
+
+	table := "que_jobs"
+	if c.schema != "" {
+		table = pgx.Identifier{c.schema, table}.Sanitize()
+	}
+	rows, err := c.pool.Query(ctx, `
+SELECT attname
+FROM pg_attribute
+WHERE attrelid = $1::regclass
+AND attnum > 0
+AND NOT attisdropped`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols[col] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	c.columns.cols = cols
+	return cols, nil
+}
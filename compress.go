@@ -0,0 +1,110 @@
+package que
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+// Compression is an algorithm that Args can be compressed with, see
+// WithArgsCompression.
+type Compression string
+
+// Gzip compresses Args with gzip.
+const Gzip Compression = "gzip"
+
+// compressedArgs is stored in que_jobs.args in place of compressed Args,
+// which are in the compressed_args column.
+var compressedArgs = []byte(`{"que_compressed_args":true}`)
+
+// ClientOption configures a Client created by NewClient or
+// NewClientWithSchema.
+type ClientOption func(*Client)
+
+// WithArgsCompression makes the Client compress the Args of the Jobs it
+// enqueues with comp, for job types with large, repetitive Args:
+//
+//	c := que.NewClient(pool, que.WithArgsCompression(que.Gzip))
+//
+// It trades CPU time on both ends for a smaller que_jobs table and less data
+// sent to workers. Args are only compressed when that makes them smaller, so
+// small Args are still stored as JSON.
+//
+// Compressed Args are stored in the compressed_args bytea column, with comp
+// in the args_compression column, and the args column holds
+// {"que_compressed_args":true}. Workers decompress them when they lock the
+// Job, whatever the options of their Client, so only the Clients that
+// enqueue need the option; the Args that Advance, Checkpoint and Update store
+// are compressed according to the Client of the Worker. Ruby workers only see
+// the placeholder, so don't use compression on a Client that enqueues jobs
+// worked by Ruby. Likewise, LockFilters and TenantKeys that read the args
+// column see the placeholder for compressed Args.
+func WithArgsCompression(comp Compression) ClientOption {
+	return func(c *Client) {
+		c.argsCompression = comp
+	}
+}
+
+// argsCompression returns the Compression of the Client that locked j, if
+// any.
+func (j *Job) argsCompression() Compression {
+	if j.client == nil {
+		return ""
+	}
+	return j.client.argsCompression
+}
+
+// compressArgs returns what to store in the args, args_compression and
+// compressed_args columns for args compressed with comp. args_compression and
+// compressed_args are NULL if args are stored uncompressed.
+func compressArgs(args []byte, comp Compression) (stored []byte, compression *string, compressed []byte, err error) {
+	switch comp {
+	case "":
+		return args, nil, nil, nil
+	case Gzip:
+	default:
+		return nil, nil, nil, fmt.Errorf("que: unknown args compression %q", comp)
+	}
+	if len(args) <= len(compressedArgs) {
+		return args, nil, nil, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(args); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, nil, err
+	}
+	if buf.Len() >= len(args) {
+		return args, nil, nil, nil
+	}
+	s := string(comp)
+	return compressedArgs, &s, buf.Bytes(), nil
+}
+
+// decompressArgs returns the Args read from the database, which were
+// compressed with comp unless it is empty.
+func decompressArgs(args []byte, comp string) ([]byte, error) {
+	switch Compression(comp) {
+	case "":
+		return args, nil
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(args))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("que: unknown args compression %q", comp)
+	}
+}
+
+// setStoredArgs sets the Args of j, as read from the database with the
+// compression comp. If they can't be decompressed, decoding them fails with
+// the error.
+func (j *Job) setStoredArgs(args []byte, comp string) {
+	j.Args, j.argsErr = decompressArgs(args, comp)
+}
@@ -0,0 +1,161 @@
+package que
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// reportArgs is a large payload with a lot of repetitive structure.
+func reportArgs() []resizeArgs {
+	rows := make([]resizeArgs, 200)
+	for i := range rows {
+		rows[i] = resizeArgs{Path: fmt.Sprintf("/images/products/%d/original.png", i), Widths: []int{64, 128, 256, 512}}
+	}
+	return rows
+}
+
+func TestCompressArgs(t *testing.T) {
+	plain, err := json.Marshal(reportArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, comp, compressed, err := compressArgs(plain, Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, compressedArgs) {
+		t.Errorf("want placeholder args %s, got %s", compressedArgs, stored)
+	}
+	if comp == nil || *comp != "gzip" {
+		t.Fatalf("want compression gzip, got %v", comp)
+	}
+	if len(compressed) >= len(plain)/2 {
+		t.Errorf("want compressed Args under half of %d bytes, got %d", len(plain), len(compressed))
+	}
+
+	args, err := decompressArgs(compressed, *comp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(args, plain) {
+		t.Errorf("want decompressed Args equal to the original")
+	}
+}
+
+func TestCompressArgsSmall(t *testing.T) {
+	plain := []byte(`{"Path":"a.png"}`)
+	stored, comp, compressed, err := compressArgs(plain, Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, plain) || comp != nil || compressed != nil {
+		t.Errorf("want small Args stored uncompressed, got %s, %v, %v", stored, comp, compressed)
+	}
+}
+
+func TestCompressArgsUnknown(t *testing.T) {
+	if _, _, _, err := compressArgs([]byte(`[]`), "lz4"); err == nil {
+		t.Error("want error for unknown compression")
+	}
+	if _, err := decompressArgs([]byte(`[]`), "lz4"); err == nil {
+		t.Error("want error for unknown compression")
+	}
+}
+
+func TestCompressArgsCorrupt(t *testing.T) {
+	j := &Job{Type: "ReportJob"}
+	j.setStoredArgs([]byte("not gzip"), "gzip")
+
+	var args []resizeArgs
+	err := j.decodeArgs(&args)
+	if _, ok := err.(*ArgsError); !ok {
+		t.Fatalf("want *ArgsError, got %v", err)
+	}
+	if err := j.ScanArgs(&args); err == nil {
+		t.Error("want error from ScanArgs")
+	}
+}
+
+func TestWithArgsCompression(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	c = NewClient(c.pool, WithArgsCompression(Gzip))
+
+	want := reportArgs()
+	j := &Job{Type: "ReportJob"}
+	if err := j.SetArgs(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		args        []byte
+		compression *string
+		compressed  []byte
+	)
+	err := c.pool.QueryRow(context.Background(), "SELECT args::text, args_compression, compressed_args FROM que_jobs WHERE job_id = $1", j.ID).Scan(&args, &compression, &compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(args, compressedArgs) {
+		t.Errorf("want placeholder args %s, got %s", compressedArgs, args)
+	}
+	if compression == nil || *compression != "gzip" || len(compressed) == 0 {
+		t.Errorf("want gzip compressed args, got %v with %d bytes", compression, len(compressed))
+	}
+
+	// workers decompress whatever the options of their Client
+	locked, err := NewClient(c.pool).LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locked.Done()
+
+	var got []resizeArgs
+	if err := DecodeInto(locked, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || got[199].Path != want[199].Path {
+		t.Errorf("want %d rows ending with %+v, got %d rows", len(want), want[199], len(got))
+	}
+
+	listed, err := c.GetJob(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(listed.Args, locked.Args) {
+		t.Errorf("want GetJob to decompress the Args")
+	}
+}
+
+// BenchmarkCompressArgs measures the CPU cost of compressing and decompressing
+// large Args, and reports the size of the stored Args relative to plain JSON.
+func BenchmarkCompressArgs(b *testing.B) {
+	plain, err := json.Marshal(reportArgs())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var size int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, comp, compressed, err := compressArgs(plain, Gzip)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := decompressArgs(compressed, *comp); err != nil {
+			b.Fatal(err)
+		}
+		size = len(compressed)
+	}
+	b.ReportMetric(float64(size)/float64(len(plain)), "size-ratio")
+	b.ReportMetric(float64(len(plain)), "plain-bytes")
+	b.ReportMetric(float64(size), "stored-bytes")
+}
@@ -0,0 +1,44 @@
+package que
+
+import "context"
+
+// ValidateCoverage returns the types of the Jobs currently in the pool's Queue
+// that have no WorkFunc in its WorkMap, sorted. Call it at startup to fail fast
+// or warn when a deploy forgot to register the WorkFunc of Jobs that are
+// already enqueued, which the pool would otherwise fail as unknown types.
+//
+// It is a point-in-time snapshot of que_jobs: it says nothing about Jobs
+// enqueued later, and Jobs of a missing type may have been worked by other
+// processes, or still be enqueued, by the time it returns. The query reads
+// the whole Queue, so it can be slow on a large backlog without an index on
+// (queue, job_class). Like QueueStats, it is sent as text, so it works on a
+// read replica.
+func (w *WorkerPool) ValidateCoverage(ctx context.Context) ([]string, error) {
+	return w.c.missingTypes(ctx, w.Queue, w.WorkMap)
+}
+
+// missingTypes returns the types of the Jobs in queue that have no WorkFunc
+// in wm.
+func (c *Client) missingTypes(ctx context.Context, queue string, wm WorkMap) ([]string, error) {
+	sql, err := c.readQuery(ctx, sqlJobTypes, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.pool.Query(ctx, sql, queue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var typ string
+		if err := rows.Scan(&typ); err != nil {
+			return nil, err
+		}
+		if _, ok := wm[typ]; !ok {
+			missing = append(missing, typ)
+		}
+	}
+	return missing, rows.Err()
+}
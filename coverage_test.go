@@ -0,0 +1,42 @@
+package que
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestWorkerPoolValidateCoverage(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, j := range []*Job{
+		{Type: "Handled"},
+		{Type: "ForgottenB"},
+		{Type: "ForgottenA"},
+		{Type: "ForgottenA"},
+		{Type: "OtherQueue", Queue: "other"},
+	} {
+		if err := c.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wp := NewWorkerPool(c, WorkMap{"Handled": func(j *Job) error { return nil }}, 1)
+	missing, err := wp.ValidateCoverage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(missing), "[ForgottenA ForgottenB]"; got != want {
+		t.Errorf("want missing types %s, got %s", want, got)
+	}
+
+	wp.Queue = "other"
+	missing, err = wp.ValidateCoverage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(missing), "[OtherQueue]"; got != want {
+		t.Errorf("want missing types %s, got %s", want, got)
+	}
+}
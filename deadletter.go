@@ -0,0 +1,186 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// DeadJob is a Job that was moved out of que_jobs and into the dead-letter
+// table que_dead_jobs because it could not be worked. Dead jobs are never
+// locked by workers.
+type DeadJob struct {
+	ID         int64
+	Queue      string
+	Priority   int16
+	RunAt      time.Time
+	Type       string
+	Args       []byte
+	ErrorCount int32
+	LastError  pgtype.Text
+
+	// PanicCount is the number of times the job panicked while being worked.
+	PanicCount int32
+
+	// DiedAt is the time the job was moved to the dead-letter table.
+	DiedAt time.Time
+}
+
+// DeadLetter moves this job to the dead-letter table que_dead_jobs, so it won't
+// be worked again. If msg is not empty it is saved as the job's last error.
+//
+// You must also later call Done() to return this job's database connection to
+// the pool.
+func (j *Job) DeadLetter(msg string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.finalized {
+		return nil
+	}
+	if j.conn == nil {
+		return ErrNoConn
+	}
+
+	lastError := pgtype.Text{String: msg, Status: pgtype.Null}
+	if msg != "" {
+		lastError.Status = pgtype.Present
+	}
+
+	err := j.healing("dead_letter", func() error {
+		return sendStmts(context.Background(), j.conn, []stmtArgs{
+			{j.stmt("que_dead_letter_job"), []interface{}{j.ID, lastError}},
+			{j.stmt("que_fail_children"), []interface{}{j.ID}},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	j.finalized = true
+	return nil
+}
+
+// panicked records a recovered panic on this job like Error does, and also
+// counts it separately from other errors. Once the job has panicked maxPanics
+// times it is moved to the dead-letter table. A maxPanics of zero or less
+// disables this. It reports whether the job was dead-lettered.
+func (j *Job) panicked(msg string, maxPanics int) (bool, error) {
+	errorCount := j.ErrorCount + 1
+	delay := j.retryDelay(errorCount)
+
+	var panicCount int32
+	err := j.conn.QueryRow(context.Background(), j.stmt("que_set_panic"), errorCount, delay.Microseconds(), msg, j.Queue, j.Priority, j.RunAt, j.ID).Scan(&panicCount)
+	if err != nil {
+		return false, err
+	}
+
+	if maxPanics <= 0 || int(panicCount) < maxPanics {
+		return false, nil
+	}
+	if err := j.DeadLetter(""); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeadJobs returns all of the jobs in the dead-letter table, oldest first.
+func (c *Client) DeadJobs() ([]*DeadJob, error) {
+	rows, err := c.pool.Query(context.Background(), c.stmt("que_dead_jobs"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*DeadJob
+	for rows.Next() {
+		var (
+			j           = &DeadJob{}
+			args        []byte
+			compression pgtype.Text
+		)
+		err := rows.Scan(
+			&j.Queue,
+			&j.Priority,
+			&j.RunAt,
+			&j.ID,
+			&j.Type,
+			&args,
+			&compression,
+			&j.ErrorCount,
+			&j.LastError,
+			&j.PanicCount,
+			&j.DiedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if j.Args, err = decompressArgs(args, compression.String); err != nil {
+			return nil, fmt.Errorf("que: decompressing the args of dead job %d: %w", j.ID, err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// ReplayDeadLetter moves the dead job id back to que_jobs to be worked again
+// right away, typically after fixing the code that failed it. It keeps its ID,
+// Queue, Priority and Type, but its ErrorCount and LastError are reset.
+//
+// If transform is not nil, the job's Args are replaced by what it returns for
+// them, to fix a payload that was the cause of the failure. If transform fails,
+// or returns invalid JSON, the job is left in the dead-letter table and the
+// error is returned. ReplayDeadLetter returns ErrJobNotFound if there is no
+// dead job id, for instance because it was already replayed.
+//
+// To replay several jobs, call it for each of the jobs returned by DeadJobs
+// that should be replayed; each job is replayed or left independently of the
+// others.
+func (c *Client) ReplayDeadLetter(id int64, transform func(args []byte) ([]byte, error)) error {
+	ctx := context.Background()
+
+	var (
+		args        = &pgtype.Bytea{Status: pgtype.Null}
+		compression *string
+		compressed  []byte
+	)
+	if transform != nil {
+		var (
+			stored []byte
+			comp   pgtype.Text
+		)
+		err := c.pool.QueryRow(ctx, c.stmt("que_dead_job_args"), id).Scan(&stored, &comp)
+		if err == pgx.ErrNoRows {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		old, err := decompressArgs(stored, comp.String)
+		if err != nil {
+			return fmt.Errorf("que: decompressing the args of dead job %d: %w", id, err)
+		}
+		b, err := transform(old)
+		if err != nil {
+			return fmt.Errorf("que: transforming the args of dead job %d: %w", id, err)
+		}
+		if !json.Valid(b) {
+			return fmt.Errorf("que: transformed args of dead job %d are not valid JSON: %q", id, b)
+		}
+		if b, compression, compressed, err = compressArgs(b, c.argsCompression); err != nil {
+			return err
+		}
+		args.Bytes, args.Status = b, pgtype.Present
+	}
+
+	var replayed int64
+	err := c.pool.QueryRow(ctx, c.stmt("que_replay_dead_job"), id, args, compression, compressed).Scan(&replayed)
+	if err == pgx.ErrNoRows {
+		return ErrJobNotFound
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package que
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// deadJob enqueues a job with args and moves it to the dead-letter table.
+func deadJob(t *testing.T, c *Client, args string) int64 {
+	t.Helper()
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(args)}); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+	if err := j.DeadLetter("bad payload"); err != nil {
+		t.Fatal(err)
+	}
+	return j.ID
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	unchanged := deadJob(t, c, `{"user":1}`)
+	fixed := deadJob(t, c, `{"usr":2}`)
+
+	if err := c.ReplayDeadLetter(unchanged, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ReplayDeadLetter(fixed, func(args []byte) ([]byte, error) {
+		return bytes.Replace(args, []byte(`"usr"`), []byte(`"user"`), 1), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int64]string{unchanged: `{"user":1}`, fixed: `{"user":2}`} {
+		j, err := c.GetJob(id)
+		if err != nil {
+			t.Fatalf("want job %d replayed, got %v", id, err)
+		}
+		if string(j.Args) != want {
+			t.Errorf("want job %d Args=%s, got %s", id, want, j.Args)
+		}
+		if j.ErrorCount != 0 || j.LastError.String != "" {
+			t.Errorf("want job %d error reset, got ErrorCount=%d LastError=%q", id, j.ErrorCount, j.LastError.String)
+		}
+	}
+	if dead, err := c.DeadJobs(); err != nil || len(dead) != 0 {
+		t.Errorf("want no dead jobs left, got %d, %v", len(dead), err)
+	}
+
+	if err := c.ReplayDeadLetter(fixed, nil); err != ErrJobNotFound {
+		t.Errorf("want ErrJobNotFound replaying twice, got %v", err)
+	}
+}
+
+func TestReplayDeadLetterTransformError(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	failing := deadJob(t, c, `{"user":1}`)
+	invalid := deadJob(t, c, `{"user":2}`)
+
+	errUnfixable := errors.New("unfixable")
+	err := c.ReplayDeadLetter(failing, func(args []byte) ([]byte, error) {
+		return nil, errUnfixable
+	})
+	if !errors.Is(err, errUnfixable) {
+		t.Errorf("want transform error, got %v", err)
+	}
+	err = c.ReplayDeadLetter(invalid, func(args []byte) ([]byte, error) {
+		return []byte(`{"user":`), nil
+	})
+	if err == nil {
+		t.Error("want error for invalid JSON args")
+	}
+
+	// both jobs were skipped
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 2 {
+		t.Errorf("want 2 dead jobs left, got %d", len(dead))
+	}
+	if n := countJobs(t, c.pool, "MyJob"); n != 0 {
+		t.Errorf("want no jobs replayed, got %d", n)
+	}
+}
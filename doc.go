@@ -46,7 +46,7 @@ Here is a complete example showing worker setup and two jobs enqueued, one with
 
     printName := func(j *que.Job) error {
         var args printNameArgs
-        if err := json.Unmarshal(j.Args, &args); err != nil {
+        if err := que.DecodeInto(j, &args); err != nil {
             return err
         }
         fmt.Printf("Hello %s!\n", args.Name)
@@ -60,7 +60,7 @@ Here is a complete example showing worker setup and two jobs enqueued, one with
 
     rescheduleExample := func(j *que.Job) error {
         var args rescheduleArgs
-        if err := json.Unmarshal(j.Args, &args); err != nil {
+        if err := que.DecodeInto(j, &args); err != nil {
             return err
         }
 
@@ -106,6 +106,11 @@ Here is a complete example showing worker setup and two jobs enqueued, one with
     workers := que.NewWorkerPool(qc, wm, 2) // create a pool w/ 2 workers
     go workers.Start() // work jobs in another goroutine
 
+Decode Args with DecodeInto rather than json.Unmarshal: it keeps integers
+exact when decoding into interface{} values, and large ids and amounts enqueued
+from Ruby would otherwise lose precision as float64. Pass
+que.DisallowUnknownFields to reject Args with fields the target doesn't have.
+
     //
     // Job Example
     // This example handles the job and the worker automatically
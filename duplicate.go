@@ -0,0 +1,73 @@
+package que
+
+import (
+	"sync"
+	"time"
+)
+
+// duplicates remembers the recently worked Jobs, to detect when a WorkFunc
+// runs again for a Job that was already completed, or for an attempt of a Job
+// whose outcome was already recorded. Delivery is at-least-once, so this
+// happens e.g. when a Job's connection is lost before its deletion commits.
+// Only Jobs worked by the same process within the window are detected.
+type duplicates struct {
+	mu        sync.Mutex
+	window    time.Duration
+	seen      map[int64]seenJob
+	lastPrune time.Time
+}
+
+type seenJob struct {
+	attempt int32
+	done    bool
+	at      time.Time
+}
+
+func newDuplicates(window time.Duration) *duplicates {
+	return &duplicates{
+		window:    window,
+		seen:      make(map[int64]seenJob),
+		lastPrune: time.Now(),
+	}
+}
+
+// started reports whether running j now is a duplicate execution: j was
+// already completed, or already worked with the same ErrorCount.
+func (d *duplicates) started(j *Job) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.seen[j.ID]
+	if !ok || time.Since(s.at) > d.window {
+		return false
+	}
+	return s.done || j.ErrorCount <= s.attempt
+}
+
+// finished records that the WorkFunc of j returned, and whether j completed.
+func (d *duplicates) finished(j *Job, done bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.seen[j.ID] = seenJob{attempt: j.ErrorCount, done: done, at: now}
+
+	if now.Sub(d.lastPrune) < d.window {
+		return
+	}
+	for id, s := range d.seen {
+		if now.Sub(s.at) > d.window {
+			delete(d.seen, id)
+		}
+	}
+	d.lastPrune = now
+}
+
+// forget drops j, e.g. because it was skipped and will legitimately be worked
+// again with the same ErrorCount.
+func (d *duplicates) forget(j *Job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, j.ID)
+}
@@ -0,0 +1,65 @@
+package que
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicates(t *testing.T) {
+	d := newDuplicates(time.Minute)
+
+	j := &Job{ID: 1}
+	if d.started(j) {
+		t.Error("want first execution not to be a duplicate")
+	}
+	d.finished(j, false)
+
+	// the error was recorded, so the retry has a higher ErrorCount
+	retry := &Job{ID: 1, ErrorCount: 1}
+	if d.started(retry) {
+		t.Error("want retry not to be a duplicate")
+	}
+	// the same attempt running again is
+	if !d.started(&Job{ID: 1}) {
+		t.Error("want same attempt to be a duplicate")
+	}
+	d.finished(retry, true)
+
+	// any execution of a completed job is
+	if !d.started(&Job{ID: 1, ErrorCount: 5}) {
+		t.Error("want completed job to be a duplicate")
+	}
+
+	skipped := &Job{ID: 2}
+	d.finished(skipped, false)
+	d.forget(skipped)
+	if d.started(skipped) {
+		t.Error("want forgotten job not to be a duplicate")
+	}
+}
+
+func TestDuplicatesWindow(t *testing.T) {
+	d := newDuplicates(10 * time.Millisecond)
+
+	j := &Job{ID: 1}
+	d.finished(j, true)
+	time.Sleep(20 * time.Millisecond)
+	if d.started(j) {
+		t.Error("want job outside the window not to be a duplicate")
+	}
+
+	d.finished(&Job{ID: 2}, true)
+	if _, ok := d.seen[1]; ok {
+		t.Error("want expired job pruned")
+	}
+}
+
+func TestMetricsDuplicates(t *testing.T) {
+	m := newMetrics()
+	m.observe(JobStats{Type: "ChargeCard"})
+	m.observe(JobStats{Type: "ChargeCard", Duplicate: true})
+
+	if want, got := (TypeMetrics{Succeeded: 2, Duplicates: 1}), m.snapshot().Types["ChargeCard"]; got != want {
+		t.Errorf("want ChargeCard=%+v, got %+v", want, got)
+	}
+}
@@ -2,10 +2,14 @@ package que
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 func TestEnqueueOnlyType(t *testing.T) {
@@ -169,3 +173,540 @@ func TestEnqueueInTx(t *testing.T) {
 		t.Fatalf("wanted job to be rolled back, got %+v", j)
 	}
 }
+
+func TestInTxRollbackNeverWorked(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	worked := false
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		worked = true
+		return nil
+	}})
+
+	errBusiness := errors.New("business rule violated")
+	err := c.InTx(context.Background(), func(tx *Tx) error {
+		if err := c.EnqueueInTx(&Job{Type: "MyJob"}, tx); err != nil {
+			return err
+		}
+		// the uncommitted job is invisible to the worker
+		if w.WorkOne() {
+			t.Error("want no job worked before commit")
+		}
+		return errBusiness
+	})
+	if err != errBusiness {
+		t.Fatalf("want %v, got %v", errBusiness, err)
+	}
+
+	if w.WorkOne() || worked {
+		t.Error("want rolled back job never worked")
+	}
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Fatalf("wanted job to be rolled back, got %+v", j)
+	}
+}
+
+func TestInTxCommit(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	committed := false
+	err := c.InTx(context.Background(), func(tx *Tx) error {
+		tx.AfterCommit(func() { committed = true })
+		return c.EnqueueInTx(&Job{Type: "MyJob"}, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Error("want AfterCommit func called")
+	}
+
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error { return nil }})
+	if !w.WorkOne() {
+		t.Error("want committed job worked")
+	}
+}
+
+func TestEnqueueInTxAfterCommit(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	pgxTx, err := c.pool.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTx(pgxTx)
+	defer tx.Rollback(context.Background())
+
+	if err = c.EnqueueInTx(&Job{Type: "MyJob"}, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	called := 0
+	tx.AfterCommit(func() {
+		called++
+
+		// the job must be durable by the time the callback runs
+		j, err := findOneJob(c.pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j == nil {
+			t.Error("want job to be visible after commit")
+		}
+	})
+	if called != 0 {
+		t.Errorf("want callback not called before commit, got %d calls", called)
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if called != 1 {
+		t.Errorf("want callback called once, got %d", called)
+	}
+
+	// committing again must not run the callback again
+	_ = tx.Commit(context.Background())
+	if called != 1 {
+		t.Errorf("want callback called once, got %d", called)
+	}
+}
+
+func TestEnqueueInTxAfterCommitRollback(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	pgxTx, err := c.pool.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTx(pgxTx)
+
+	if err = c.EnqueueInTx(&Job{Type: "MyJob"}, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	tx.AfterCommit(func() { called = true })
+
+	if err = tx.Rollback(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(context.Background()); err == nil {
+		t.Error("want error committing a rolled back transaction")
+	}
+	if called {
+		t.Error("want callback not called after rollback")
+	}
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	runAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	jobs := []*Job{
+		{Type: "First"},
+		{Type: "Second", Queue: "other", Priority: 5, RunAt: runAt, Args: []byte(`{"n": 2}`)},
+		{Type: "Third"},
+	}
+	if err := c.EnqueueBatch(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range jobs {
+		if want.ID == 0 {
+			t.Fatalf("want non-zero ID for %s", want.Type)
+		}
+
+		var typ string
+		err := c.pool.QueryRow(context.Background(), "SELECT job_class FROM que_jobs WHERE job_id = $1", want.ID).Scan(&typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != want.Type {
+			t.Errorf("job %d: want Type=%q, got %q", want.ID, want.Type, typ)
+		}
+	}
+
+	second := &Job{}
+	err := c.pool.QueryRow(context.Background(), `
+	SELECT queue, priority, run_at, args FROM que_jobs WHERE job_id = $1`, jobs[1].ID).Scan(
+		&second.Queue,
+		&second.Priority,
+		&second.RunAt,
+		&second.Args,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "other"; second.Queue != want {
+		t.Errorf("want Queue=%q, got %q", want, second.Queue)
+	}
+	if want := int16(5); second.Priority != want {
+		t.Errorf("want Priority=%d, got %d", want, second.Priority)
+	}
+	if !second.RunAt.Equal(runAt) {
+		t.Errorf("want RunAt=%s, got %s", runAt, second.RunAt)
+	}
+	if want, got := `{"n": 2}`, string(second.Args); got != want {
+		t.Errorf("want Args=%s, got %s", want, got)
+	}
+}
+
+func TestEnqueueBatchMissingType(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	err := c.EnqueueBatch([]*Job{{Type: "MyJob"}, {}})
+	if err != ErrMissingType {
+		t.Fatalf("want %v, got %v", ErrMissingType, err)
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Errorf("want no jobs enqueued, got %+v", j)
+	}
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j1 := &Job{Type: "MyJob", UniqueKey: "rebuild-index:tenant-42"}
+	inserted, err := c.EnqueueUnique(j1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Fatal("want first job inserted")
+	}
+	if j1.ID == 0 {
+		t.Error("want non-zero ID")
+	}
+
+	j2 := &Job{Type: "MyJob", Args: []byte(`{"other":"args"}`), UniqueKey: "rebuild-index:tenant-42"}
+	inserted, err = c.EnqueueUnique(j2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted {
+		t.Error("want duplicate job skipped")
+	}
+	if j2.ID != 0 {
+		t.Errorf("want ID=0, got %d", j2.ID)
+	}
+
+	inserted, err = c.EnqueueUnique(&Job{Type: "MyJob", UniqueKey: "rebuild-index:tenant-43"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Error("want job with other key inserted")
+	}
+
+	// once the first job is worked its key is free again
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.ID != j1.ID {
+		t.Fatalf("want job %d, got %d", j1.ID, j.ID)
+	}
+	if err := j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	j.Done()
+
+	inserted, err = c.EnqueueUnique(&Job{Type: "MyJob", UniqueKey: "rebuild-index:tenant-42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Error("want job inserted after the previous one was worked")
+	}
+}
+
+func TestEnqueueUniqueMissingKey(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if _, err := c.EnqueueUnique(&Job{Type: "MyJob"}); err != ErrMissingUniqueKey {
+		t.Errorf("want ErrMissingUniqueKey, got %v", err)
+	}
+}
+
+func TestUniqueTarget(t *testing.T) {
+	for _, sql := range []string{sqlInsertJobUnique, sqlInsertJobUniqueNotify} {
+		if !strings.Contains(sql, "ON CONFLICT "+defaultUniqueTarget+" DO NOTHING") {
+			t.Errorf("want default unique target in %s", sql)
+		}
+	}
+
+	target, err := UniqueColumns("job_class", "routing_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err = target.Where("routing_key IS NOT NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `("job_class", "routing_key") WHERE routing_key IS NOT NULL`, target.sql; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	if _, err := UniqueColumns(); err == nil {
+		t.Error("want error for no columns")
+	}
+	if _, err := UniqueColumns("job_class", "x); DROP TABLE que_jobs; --"); err == nil {
+		t.Error("want error for invalid column")
+	}
+	if _, err := UniqueConstraint("que jobs"); err == nil {
+		t.Error("want error for invalid constraint")
+	}
+	constraint, err := UniqueConstraint("que_jobs_tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := constraint.Where("routing_key IS NOT NULL"); err == nil {
+		t.Error("want error for constraint with predicate")
+	}
+	for _, pred := range []string{"", "job_class = 'x'", "job_class = $1", "(routing_key IS NOT NULL", "true; DROP TABLE que_jobs"} {
+		if _, err := target.Where(pred); err == nil {
+			t.Errorf("want error for predicate %q", pred)
+		}
+	}
+}
+
+func TestEnqueueUniqueOn(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	_, err := c.pool.Exec(context.Background(), `CREATE UNIQUE INDEX que_jobs_type_tenant ON que_jobs (job_class, routing_key) WHERE routing_key IS NOT NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.pool.Exec(context.Background(), `DROP INDEX que_jobs_type_tenant`)
+
+	target, err := UniqueColumns("job_class", "routing_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err = target.Where("routing_key IS NOT NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	j1 := &Job{Type: "Rebuild", RoutingKey: "tenant-42"}
+	inserted, err := c.EnqueueUniqueOn(j1, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted || j1.ID == 0 {
+		t.Fatalf("want first job inserted, got inserted=%v ID=%d", inserted, j1.ID)
+	}
+
+	j2 := &Job{Type: "Rebuild", RoutingKey: "tenant-42"}
+	inserted, err = c.EnqueueUniqueOn(j2, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted || j2.ID != 0 {
+		t.Errorf("want duplicate job skipped, got inserted=%v ID=%d", inserted, j2.ID)
+	}
+
+	// without a UniqueKey, jobs don't conflict in que_jobs_unique_key
+	for _, typ := range []string{"Reindex", "Vacuum"} {
+		inserted, err = c.EnqueueUniqueOn(&Job{Type: typ, RoutingKey: "tenant-42"}, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !inserted {
+			t.Errorf("want %s job inserted", typ)
+		}
+	}
+
+	// a target without a matching index is an error
+	missing, err := UniqueColumns("job_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EnqueueUniqueOn(&Job{Type: "Rebuild"}, missing); err == nil {
+		t.Error("want error for a target without an index")
+	}
+}
+
+func TestEnqueueStats(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var stats []EnqueueStats
+	c.EnqueueStats = func(s EnqueueStats) {
+		stats = append(stats, s)
+	}
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Queue: "q1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&Job{}); err != ErrMissingType {
+		t.Fatalf("want ErrMissingType, got %v", err)
+	}
+	err := c.EnqueueBatch([]*Job{
+		{Type: "MyJob", Queue: "q1"},
+		{Type: "OtherJob", Queue: "q1"},
+		{Type: "MyJob", Queue: "q1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EnqueueStats{
+		{Queue: "q1", Type: "MyJob", Count: 1},
+		{Queue: "", Type: "", Count: 1, Err: ErrMissingType},
+		{Queue: "q1", Type: "MyJob", Count: 2},
+		{Queue: "q1", Type: "OtherJob", Count: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("want %d stats, got %d: %+v", len(want), len(stats), stats)
+	}
+	for i, s := range stats {
+		if s.Duration <= 0 {
+			t.Errorf("stats[%d]: want positive Duration, got %v", i, s.Duration)
+		}
+		s.Duration = 0
+		if s != want[i] {
+			t.Errorf("stats[%d]: want %+v, got %+v", i, want[i], s)
+		}
+	}
+}
+
+func TestClientMaxConcurrentEnqueues(t *testing.T) {
+	c := &Client{MaxConcurrentEnqueues: 2}
+
+	release1 := c.acquireEnqueueSlot()
+	release2 := c.acquireEnqueueSlot()
+
+	acquired := make(chan func())
+	go func() {
+		acquired <- c.acquireEnqueueSlot()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("want third enqueue to wait for a slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release1()
+	select {
+	case release3 := <-acquired:
+		release3()
+	case <-time.After(time.Second):
+		t.Fatal("want third enqueue to get the freed slot")
+	}
+	release2()
+}
+
+func TestClientUnlimitedEnqueues(t *testing.T) {
+	c := &Client{}
+	for i := 0; i < 100; i++ {
+		c.acquireEnqueueSlot()
+	}
+}
+
+func TestClientReserveWorkerConns(t *testing.T) {
+	config, err := pgxpool.ParseConfig(testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = 4
+	config.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closePool(pool)
+
+	for _, n := range []int{-1, 4, 5} {
+		if err := NewClient(pool).ReserveWorkerConns(n); err == nil {
+			t.Errorf("want error reserving %d of 4 connections", n)
+		}
+	}
+
+	c := NewClient(pool)
+	c.MaxConcurrentEnqueues = 10
+	if err := c.ReserveWorkerConns(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := cap(c.enqueueSlots); got != 3 {
+		t.Errorf("want 3 enqueue slots, got %d", got)
+	}
+	if err := c.ReserveWorkerConns(2); err == nil {
+		t.Error("want error reserving connections twice")
+	}
+
+	c = NewClient(pool)
+	c.MaxConcurrentEnqueues = 2
+	if err := c.ReserveWorkerConns(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := cap(c.enqueueSlots); got != 2 {
+		t.Errorf("want MaxConcurrentEnqueues to apply, got %d slots", got)
+	}
+
+	c = NewClient(pool)
+	c.acquireEnqueueSlot()()
+	if err := c.ReserveWorkerConns(1); err == nil {
+		t.Error("want error reserving connections after enqueueing")
+	}
+}
+
+func TestReserveWorkerConnsProducerBurst(t *testing.T) {
+	c := openTestClientMaxConns(t, 3)
+	defer closePool(c.pool)
+
+	if err := c.ReserveWorkerConns(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// producers that would take every connection of the pool if they could
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error { return nil }})
+	for i := 0; i < 10; i++ {
+		done := make(chan bool)
+		go func() { done <- w.WorkOne() }()
+		select {
+		case worked := <-done:
+			if !worked {
+				t.Errorf("want job %d worked", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want the worker to get a connection during the burst, job %d", i)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+package que
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// EnqueueFollowup is like EnqueueFollowups for a single child job.
+func (j *Job) EnqueueFollowup(child *Job) error {
+	return j.EnqueueFollowups([]*Job{child})
+}
+
+// EnqueueFollowups arranges for children to be enqueued when this job is
+// finalized with Delete, Update or Finalize, which is what a Worker does after
+// the WorkFunc returns nil. The children are inserted on the job's connection
+// in the same transaction that deletes or updates the job, so either the job is
+// completed and all of its children are enqueued, or none of it happens and
+// the job will be worked again. A crash halfway through enqueueing children
+// can't leave only some of them behind.
+//
+// If the job fails instead, with Error or DeadLetter, the children are
+// discarded. EnqueueFollowups may be called several times; the children of all
+// calls are enqueued together.
+func (j *Job) EnqueueFollowups(children []*Job) error {
+	for _, child := range children {
+		if child.Type == "" {
+			return ErrMissingType
+		}
+		if j.client != nil {
+			if err := j.client.checkRunAt(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.followups = append(j.followups, children...)
+	return nil
+}
+
+// stmtArgs is a statement and its arguments.
+type stmtArgs struct {
+	sql  string
+	args []interface{}
+}
+
+// execFinalize runs the statements that delete or update the job, in order
+// and in a single transaction, together with the inserts of its followups if
+// it has any. The caller must hold j.mu.
+func (j *Job) execFinalize(stmts ...stmtArgs) error {
+	if j.conn == nil && j.tx == nil {
+		return ErrNoConn
+	}
+	ctx := context.Background()
+	if j.tx != nil && len(j.followups) == 0 {
+		return execStmts(ctx, j.tx, stmts)
+	}
+	if len(j.followups) == 0 {
+		return j.healing("finalize", func() error {
+			return sendStmts(ctx, j.conn, stmts)
+		})
+	}
+
+	insertStmt := j.stmt("que_insert_job")
+	if j.client != nil {
+		insertStmt = j.client.insertStmt()
+	}
+
+	var (
+		tx  pgx.Tx
+		err error
+	)
+	if j.tx != nil {
+		// a savepoint in the AckOnCommit transaction
+		tx, err = j.tx.Begin(ctx)
+	} else {
+		tx, err = j.conn.Begin(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, child := range j.followups {
+		if err := execEnqueue(child, tx, insertStmt, j.argsCompression()); err != nil {
+			return err
+		}
+	}
+	if err := execStmts(ctx, tx, stmts); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	j.followups = nil
+	return nil
+}
+
+// execStmts runs stmts one after the other on q.
+func execStmts(ctx context.Context, q queryable, stmts []stmtArgs) error {
+	for _, s := range stmts {
+		if _, err := q.Exec(ctx, s.sql, s.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendStmts sends stmts to conn in a single batch, which PostgreSQL runs as a
+// single implicit transaction, in a single round trip. Each statement still
+// takes its own snapshot.
+func sendStmts(ctx context.Context, conn *pgxpool.Conn, stmts []stmtArgs) error {
+	b := &pgx.Batch{}
+	for _, s := range stmts {
+		b.Queue(s.sql, s.args...)
+	}
+	br := conn.SendBatch(ctx, b)
+	for range stmts {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return err
+		}
+	}
+	return br.Close()
+}
@@ -0,0 +1,92 @@
+package que
+
+import (
+	"context"
+	"testing"
+)
+
+func countJobs(t testing.TB, q queryable, typ string) int {
+	var n int
+	err := q.QueryRow(context.Background(), "SELECT count(*) FROM que_jobs WHERE job_class = $1", typ).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWorkerEnqueueFollowups(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	wm := WorkMap{
+		"ProcessUpload": func(j *Job) error {
+			return j.EnqueueFollowups([]*Job{
+				{Type: "Thumbnail", Args: j.Args},
+				{Type: "VirusScan", Args: j.Args},
+				{Type: "Transcode", Args: j.Args},
+			})
+		},
+	}
+	if err := c.Enqueue(&Job{Type: "ProcessUpload", Args: []byte(`[42]`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(c, wm)
+	if !w.WorkOne() {
+		t.Fatal("want didWork=true")
+	}
+
+	if n := countJobs(t, c.pool, "ProcessUpload"); n != 0 {
+		t.Errorf("want parent deleted, got %d", n)
+	}
+	for _, typ := range []string{"Thumbnail", "VirusScan", "Transcode"} {
+		if n := countJobs(t, c.pool, typ); n != 1 {
+			t.Errorf("want one %s job, got %d", typ, n)
+		}
+	}
+}
+
+func TestJobEnqueueFollowupsAtomic(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "ProcessUpload"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	// the second child fails to insert, as if the process crashed between
+	// the children
+	err = j.EnqueueFollowups([]*Job{
+		{Type: "Thumbnail"},
+		{Type: "VirusScan", Args: []byte(`not json`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Delete(); err == nil {
+		t.Fatal("want error deleting job with invalid followup")
+	}
+
+	if n := countJobs(t, c.pool, "ProcessUpload"); n != 1 {
+		t.Errorf("want parent kept, got %d", n)
+	}
+	if n := countJobs(t, c.pool, "Thumbnail"); n != 0 {
+		t.Errorf("want no children enqueued, got %d", n)
+	}
+}
+
+func TestJobEnqueueFollowupsMissingType(t *testing.T) {
+	j := &Job{}
+	if err := j.EnqueueFollowup(&Job{}); err != ErrMissingType {
+		t.Errorf("want ErrMissingType, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// isStatementInvalid reports whether err shows that one of que's prepared
+// statements can't be used on its connection anymore: because it was never
+// prepared or was deallocated, or because a migration changed the type of
+// the columns it returns.
+func isStatementInvalid(err error) bool {
+	if isStatementMissing(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "0A000" && // feature_not_supported
+		strings.Contains(pgErr.Message, "cached plan must not change result type")
+}
+
+// ErrStatementsNotPrepared is returned, wrapping the error from PostgreSQL,
+// when que's prepared statements don't exist on a connection and can't be
+// prepared on it either. The statements must be prepared on every connection
+// of the Client's pool, by using PrepareStatements, or PrepareSchemaStatements
+// for a Client created with NewClientWithSchema, as the AfterConnect func of
+// the pool's config.
+var ErrStatementsNotPrepared = errors.New("que: statements not prepared")
+
+// notPreparedError is an ErrStatementsNotPrepared with its cause.
+type notPreparedError struct {
+	err error
+}
+
+func (e *notPreparedError) Error() string {
+	return fmt.Sprintf("%v: %v; set the AfterConnect func of the pool's config to que.PrepareStatements", ErrStatementsNotPrepared, e.err)
+}
+
+func (e *notPreparedError) Is(target error) bool {
+	return target == ErrStatementsNotPrepared
+}
+
+func (e *notPreparedError) Unwrap() error {
+	return e.err
+}
+
+// ErrSchemaOutdated is returned, wrapping the error from PostgreSQL, by the
+// operations whose statements use columns or tables that que's schema lacks,
+// because schema.sql wasn't re-run after upgrading que. Re-running it, which
+// only adds what is missing, fixes them without restarting: their statements
+// are prepared on first use.
+var ErrSchemaOutdated = errors.New("que: schema outdated")
+
+// outdatedError is an ErrSchemaOutdated with the statements that couldn't be
+// prepared and the error of the first of them.
+type outdatedError struct {
+	names []string
+	err   error
+}
+
+func (e *outdatedError) Error() string {
+	return fmt.Sprintf("%v: statements %s: %v; re-run schema.sql to upgrade it", ErrSchemaOutdated, strings.Join(e.names, ", "), e.err)
+}
+
+func (e *outdatedError) Is(target error) bool {
+	return target == ErrSchemaOutdated
+}
+
+func (e *outdatedError) Unwrap() error {
+	return e.err
+}
+
+// isSchemaOutdated reports whether err, from preparing a statement, shows
+// that a column or table it uses doesn't exist.
+func isSchemaOutdated(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "42703" || // undefined_column
+		pgErr.Code == "42P01" // undefined_table
+}
+
+// isStatementMissing reports whether err shows that a prepared statement
+// doesn't exist. pgx only executes a statement by name if it prepared it on
+// the connection, and otherwise sends the name as SQL, which fails with a
+// syntax error at its very start. No SQL of que's does.
+func isStatementMissing(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case "26000": // invalid_sql_statement_name
+		return true
+	case "42601": // syntax_error
+		return pgErr.Position == 1
+	}
+	return false
+}
+
+// healStatements re-prepares que's statements on conn if err shows that they
+// were invalidated, and reports whether it did, in which case the operation
+// that failed with err may be retried once, along with the statements skipped
+// because the schema is outdated. If they can't be prepared, it returns the
+// error to report instead of err. It must not be used within a transaction,
+// which the error has aborted.
+func healStatements(ctx context.Context, conn *pgx.Conn, schema, op string, err error) (bool, *outdatedError, error) {
+	if err == nil || !isStatementInvalid(err) {
+		return false, nil, err
+	}
+	outdated, rerr := reprepareConn(ctx, conn, schema)
+	if rerr != nil {
+		log.Printf("event=statements_heal_failed op=%s error=%q reprepare_error=%q", op, err, rerr)
+		if isStatementMissing(err) {
+			return false, nil, &notPreparedError{err: rerr}
+		}
+		return false, nil, err
+	}
+	log.Printf("event=statements_healed op=%s error=%q", op, err)
+	return true, outdated, err
+}
+
+// withHealing runs fn on conn, and again after re-preparing que's statements
+// on conn if fn failed because they were invalidated.
+func withHealing(ctx context.Context, conn *pgx.Conn, schema, op string, fn func() error) error {
+	healed, outdated, err := healStatements(ctx, conn, schema, op, fn())
+	if !healed {
+		return err
+	}
+	err = fn()
+	if isStatementMissing(err) {
+		if outdated != nil {
+			return outdated
+		}
+		return &notPreparedError{err: err}
+	}
+	return err
+}
+
+// onConn runs fn on a connection from the Client's pool, healing its
+// statements like withHealing.
+func (c *Client) onConn(ctx context.Context, op string, fn func(conn *pgx.Conn) error) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return withHealing(ctx, conn.Conn(), c.schema, op, func() error {
+		return fn(conn.Conn())
+	})
+}
+
+// healing runs fn, which uses the job's connection, like withHealing. It
+// doesn't retry in the job's AckOnCommit transaction.
+func (j *Job) healing(op string, fn func() error) error {
+	if j.tx != nil || j.conn == nil {
+		return fn()
+	}
+	return withHealing(context.Background(), j.conn.Conn(), j.schema, op, fn)
+}
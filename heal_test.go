@@ -0,0 +1,192 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestIsStatementInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("prepared statement does not exist"), false},
+		{&pgconn.PgError{Code: "26000", Message: `prepared statement "que_lock_job" does not exist`}, true},
+		{fmt.Errorf("locking: %w", &pgconn.PgError{Code: "26000"}), true},
+		{&pgconn.PgError{Code: "42601", Message: `syntax error at or near "que_lock_job"`, Position: 1}, true},
+		{&pgconn.PgError{Code: "42601", Message: `syntax error at or near "AND"`, Position: 120}, false},
+		{&pgconn.PgError{Code: "0A000", Message: "cached plan must not change result type"}, true},
+		{&pgconn.PgError{Code: "0A000", Message: "cannot use FOR UPDATE with GROUP BY"}, false},
+		{&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}, false},
+	} {
+		if got := isStatementInvalid(tc.err); got != tc.want {
+			t.Errorf("want isStatementInvalid(%v)=%v, got %v", tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestHealStatements(t *testing.T) {
+	// a single connection, so the statements are deallocated on the one
+	// that que uses next
+	c := openTestClientMaxConns(t, 1)
+	defer closePool(c.pool)
+
+	deallocate := func(name string) {
+		t.Helper()
+		if _, err := c.pool.Exec(context.Background(), "DEALLOCATE "+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deallocate("que_insert_job")
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatalf("want enqueue healed, got %v", err)
+	}
+
+	deallocate("que_lock_job")
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatalf("want lock healed, got %v", err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	if _, err := j.Conn().Exec(context.Background(), "DEALLOCATE que_destroy_job"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Delete(); err != nil {
+		t.Fatalf("want finalize healed, got %v", err)
+	}
+	if n := countJobs(t, c.pool, "MyJob"); n != 0 {
+		t.Errorf("want job deleted, got %d jobs", n)
+	}
+}
+
+func TestHealStatementsResultTypeChanged(t *testing.T) {
+	c := openTestClientMaxConns(t, 1)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a migration changes the type of a column the lock query returns
+	if _, err := c.pool.Exec(context.Background(), "ALTER TABLE que_jobs ALTER COLUMN last_error TYPE varchar"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := c.pool.Exec(context.Background(), "ALTER TABLE que_jobs ALTER COLUMN last_error TYPE text"); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatalf("want lock healed, got %v", err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	j.Done()
+}
+
+func TestNotPreparedError(t *testing.T) {
+	cause := &pgconn.PgError{Code: "26000", Message: `prepared statement "que_insert_job" does not exist`}
+	var err error = &notPreparedError{err: cause}
+
+	if !errors.Is(err, ErrStatementsNotPrepared) {
+		t.Error("want error to be ErrStatementsNotPrepared")
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr != cause {
+		t.Error("want error to wrap its cause")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "que.PrepareStatements") || !strings.Contains(msg, "que_insert_job") {
+		t.Errorf("want actionable message with the cause, got %q", msg)
+	}
+}
+
+// openUnpreparedPool opens a pool whose connections don't prepare que's
+// statements.
+func openUnpreparedPool(t *testing.T) *pgxpool.Pool {
+	pool, err := pgxpool.Connect(context.Background(), testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(context.Background(), "TRUNCATE TABLE que_jobs"); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestUnpreparedPool(t *testing.T) {
+	pool := openUnpreparedPool(t)
+	defer closePool(pool)
+	c := NewClient(pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatalf("want statements prepared on first use, got %v", err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+	if err := j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpreparedPoolCantPrepare(t *testing.T) {
+	pool := openUnpreparedPool(t)
+	defer closePool(pool)
+
+	// the statements of a schema without que's tables can't be prepared
+	c, err := NewClientWithSchema(pool, "que_go_test_missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Enqueue(&Job{Type: "MyJob"})
+	if !errors.Is(err, ErrStatementsNotPrepared) {
+		t.Errorf("want ErrStatementsNotPrepared from Enqueue, got %v", err)
+	}
+	if _, err := c.LockJob(""); !errors.Is(err, ErrStatementsNotPrepared) {
+		t.Errorf("want ErrStatementsNotPrepared from LockJob, got %v", err)
+	}
+}
+
+func TestOutdatedSchema(t *testing.T) {
+	c := openTestV0Client(t)
+	defer closePool(c.pool)
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PrepareSchemaStatements(context.Background(), conn.Conn(), "que_go_test_v0")
+	conn.Release()
+	if err != nil {
+		t.Fatalf("want statements of missing columns skipped, got %v", err)
+	}
+
+	// the routing_key column was added after que 0.x
+	err = c.Enqueue(&Job{Type: "MyJob"})
+	if !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("want ErrSchemaOutdated from Enqueue, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "que_insert_job") {
+		t.Errorf("want error to name the statement, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package que
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QueueStats describes the Jobs of one type waiting in one queue.
+type QueueStats struct {
+	Queue string
+	Type  string
+
+	// Count is the number of Jobs, of which Working are locked by a worker and
+	// Errored have failed at least once.
+	Count   int64
+	Working int64
+	Errored int64
+
+	// HighestErrorCount is the highest ErrorCount among the Jobs.
+	HighestErrorCount int32
+
+	// OldestRunAt is the earliest RunAt among the Jobs.
+	OldestRunAt time.Time
+}
+
+// QueueStats returns the number of Jobs in que_jobs by queue and type, most
+// numerous first.
+func (c *Client) QueueStats() ([]QueueStats, error) {
+	sql, err := c.readQuery(context.Background(), sqlJobStats, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.pool.Query(context.Background(), sql, c.LockKeyspace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []QueueStats
+	for rows.Next() {
+		var s QueueStats
+		err := rows.Scan(&s.Queue, &s.Type, &s.Count, &s.Working, &s.Errored, &s.HighestErrorCount, &s.OldestRunAt)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// PoolStats describes the connections of the pgx pool used by a Client. Its
+// fields are que's own, so it doesn't change when pgx is upgraded.
+type PoolStats struct {
+	// MaxConns is the maximum size of the pool, and TotalConns its current
+	// size: AcquiredConns are in use, IdleConns are available and
+	// ConstructingConns are being opened.
+	MaxConns          int32
+	TotalConns        int32
+	AcquiredConns     int32
+	IdleConns         int32
+	ConstructingConns int32
+
+	// AcquireCount is the number of connections acquired from the pool, of
+	// which EmptyAcquireCount had to wait for a connection because none was
+	// idle, and CanceledAcquireCount gave up waiting.
+	AcquireCount         int64
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
+
+	// AcquireDuration is the total time spent acquiring connections. Divide
+	// it by AcquireCount for the average wait. A rising EmptyAcquireCount and
+	// AcquireDuration mean that the pool is too small for the Workers and
+	// enqueuers sharing it.
+	AcquireDuration time.Duration
+}
+
+// PoolStats returns the statistics of the Client's connection pool, to tell
+// whether stalled queues are caused by an exhausted pool.
+func (c *Client) PoolStats() PoolStats {
+	s := c.pool.Stat()
+	return PoolStats{
+		MaxConns:             s.MaxConns(),
+		TotalConns:           s.TotalConns(),
+		AcquiredConns:        s.AcquiredConns(),
+		IdleConns:            s.IdleConns(),
+		ConstructingConns:    s.ConstructingConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration(),
+	}
+}
+
+// WorkerState describes what a Worker is doing.
+type WorkerState struct {
+	Queue     string
+	Partition int
+
+	// JobID and JobType identify the Job being worked, and JobStartedAt is
+	// when the Worker started working it. They are zero if the Worker is
+	// idle.
+	JobID        int64
+	JobType      string
+	JobStartedAt time.Time
+}
+
+// Busy reports whether the Worker is working a Job.
+func (s WorkerState) Busy() bool {
+	return s.JobID != 0
+}
+
+// workerState is the part of a WorkerState that changes as a Worker works.
+type workerState struct {
+	mu      sync.Mutex
+	jobID   int64
+	jobType string
+	since   time.Time
+}
+
+func (s *workerState) set(j *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j == nil {
+		s.jobID, s.jobType, s.since = 0, "", time.Time{}
+		return
+	}
+	s.jobID, s.jobType, s.since = j.ID, j.Type, time.Now()
+}
+
+// Inspect returns what the Worker is currently doing.
+func (w *Worker) Inspect() WorkerState {
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+
+	return WorkerState{
+		Queue:        w.Queue,
+		Partition:    w.Partition,
+		JobID:        w.state.jobID,
+		JobType:      w.state.jobType,
+		JobStartedAt: w.state.since,
+	}
+}
+
+// PoolState is a snapshot of the configuration and activity of a WorkerPool.
+type PoolState struct {
+	Queue         string
+	Interval      time.Duration
+	PollBatchSize int
+	MaxPanics     int
+	Affinity      bool
+	Listen        bool
+
+	// Workers holds the state of each Worker. It is empty until the pool is
+	// started.
+	Workers []WorkerState
+
+	// Metrics holds the outcomes of the Jobs worked since the last call to
+	// Metrics. Unlike Metrics, Inspect doesn't reset them.
+	Metrics Metrics
+
+	// RecentErrors holds the last Jobs that failed, oldest first.
+	RecentErrors []JobStats
+}
+
+// Inspect returns a snapshot of the pool's configuration and of what its
+// Workers are doing, meant for debugging.
+func (w *WorkerPool) Inspect() PoolState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := PoolState{
+		Queue:         w.Queue,
+		Interval:      w.Interval,
+		PollBatchSize: w.PollBatchSize,
+		MaxPanics:     w.MaxPanics,
+		Affinity:      w.Affinity,
+		Listen:        w.Listen,
+	}
+	for _, worker := range w.workers {
+		if worker != nil {
+			s.Workers = append(s.Workers, worker.Inspect())
+		}
+	}
+	s.Metrics, s.RecentErrors = w.metrics.peek()
+	return s
+}
@@ -0,0 +1,86 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolInspect(t *testing.T) {
+	wp := NewWorkerPool(nil, WorkMap{}, 2)
+	wp.Queue = "emails"
+	wp.PollBatchSize = 3
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		wp.metrics.observe(JobStats{ID: int64(i), Type: "SendEmail", Err: errors.New("smtp down")})
+	}
+	wp.metrics.observe(JobStats{ID: 100, Type: "SendEmail"})
+
+	s := wp.Inspect()
+	if s.Queue != "emails" || s.PollBatchSize != 3 || s.Interval != defaultWakeInterval {
+		t.Errorf("want pool configuration, got %+v", s)
+	}
+	if len(s.Workers) != 0 {
+		t.Errorf("want no workers before Start, got %d", len(s.Workers))
+	}
+	if len(s.RecentErrors) != maxRecentErrors {
+		t.Fatalf("want %d recent errors, got %d", maxRecentErrors, len(s.RecentErrors))
+	}
+	if want := int64(5); s.RecentErrors[0].ID != want {
+		t.Errorf("want oldest recent error %d, got %d", want, s.RecentErrors[0].ID)
+	}
+	if want := (TypeMetrics{Succeeded: 1, Failed: maxRecentErrors + 5}); s.Metrics.Types["SendEmail"] != want {
+		t.Errorf("want SendEmail=%+v, got %+v", want, s.Metrics.Types["SendEmail"])
+	}
+
+	// Inspect doesn't reset the metrics
+	if m := wp.Metrics(); m.Types["SendEmail"].Succeeded != 1 {
+		t.Errorf("want metrics kept by Inspect, got %+v", m.Types)
+	}
+}
+
+func TestWorkerInspect(t *testing.T) {
+	w := NewWorker(nil, WorkMap{})
+	w.Queue = "emails"
+
+	if s := w.Inspect(); s.Busy() || s.Queue != "emails" {
+		t.Errorf("want idle worker on emails, got %+v", s)
+	}
+
+	w.state.set(&Job{ID: 7, Type: "SendEmail"})
+	s := w.Inspect()
+	if !s.Busy() || s.JobID != 7 || s.JobType != "SendEmail" {
+		t.Errorf("want worker busy with job 7, got %+v", s)
+	}
+	if time.Since(s.JobStartedAt) > time.Minute {
+		t.Errorf("want recent JobStartedAt, got %v", s.JobStartedAt)
+	}
+
+	w.state.set(nil)
+	if s := w.Inspect(); s.Busy() {
+		t.Errorf("want idle worker, got %+v", s)
+	}
+}
+
+func TestClientPoolStats(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.PoolStats()
+	conn.Release()
+
+	if s.AcquiredConns != 1 {
+		t.Errorf("want AcquiredConns=1, got %d", s.AcquiredConns)
+	}
+	if s.TotalConns < 1 || s.TotalConns > s.MaxConns {
+		t.Errorf("want 1 <= TotalConns <= MaxConns=%d, got %d", s.MaxConns, s.TotalConns)
+	}
+	if s.AcquireCount < 1 {
+		t.Errorf("want AcquireCount >= 1, got %d", s.AcquireCount)
+	}
+}
@@ -0,0 +1,163 @@
+package que
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrJobNotFound is returned by GetJob and LoadArgs when the Job is not in
+// que_jobs, for instance because it was already worked.
+var ErrJobNotFound = errors.New("que: job not found")
+
+// JobFilter selects the Jobs returned by ListJobs and Peek or deleted by
+// DeleteJobs.
+type JobFilter struct {
+	// Queue restricts the Jobs to a single queue, unless AllQueues is set.
+	// The zero value is the default queue "".
+	Queue     string
+	AllQueues bool
+
+	// Type, if not empty, restricts the Jobs to a single type.
+	Type string
+
+	// Limit is the maximum number of Jobs to list. Zero or less means no
+	// limit. It is ignored by Peek and DeleteJobs.
+	Limit int
+
+	// IncludeArgs makes ListJobs and Peek load the Args of the Jobs. By
+	// default they don't, which keeps listing queues with large payloads
+	// fast; use LoadArgs to load the Args of a single Job later. GetJob always
+	// loads the Args.
+	IncludeArgs bool
+}
+
+// limit returns the LIMIT for f, where nil means no limit.
+func (f JobFilter) limit() *int64 {
+	if f.Limit <= 0 {
+		return nil
+	}
+	l := int64(f.Limit)
+	return &l
+}
+
+// ArgsLoaded reports whether the Job's Args were loaded. It is false for Jobs
+// returned by ListJobs or Peek without JobFilter.IncludeArgs, until LoadArgs
+// is called.
+func (j *Job) ArgsLoaded() bool {
+	return !j.argsOmitted
+}
+
+// ListJobs returns the Jobs in que_jobs that match f, in the order workers
+// would lock them. The returned Jobs are not locked: use them for display
+// only, not to Delete or Update them.
+//
+// ListJobs and the other read methods, Peek, GetJob, LoadArgs and QueueStats,
+// work with databases whose que_jobs table predates some of the columns in
+// schema.sql, and with pools that don't prepare que's statements, such as
+// those of read replicas. The Job fields of missing columns are best-effort:
+// UniqueKey and RoutingKey are left empty if their column is missing.
+func (c *Client) ListJobs(f JobFilter) ([]*Job, error) {
+	sql, err := c.readQuery(context.Background(), sqlListJobs, "$5::boolean")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.pool.Query(context.Background(), sql, f.AllQueues, f.Queue, f.Type, f.limit(), f.IncludeArgs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		j, err := scanListedJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		j.argsOmitted = !f.IncludeArgs
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Peek returns the Job in que_jobs that matches f and would be locked next,
+// or nil if there is none. Like ListJobs, it doesn't lock the Job.
+func (c *Client) Peek(f JobFilter) (*Job, error) {
+	f.Limit = 1
+	jobs, err := c.ListJobs(f)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// GetJob returns the Job with the given ID, including its Args, without
+// locking it. It returns ErrJobNotFound if there is no such Job.
+func (c *Client) GetJob(id int64) (*Job, error) {
+	sql, err := c.readQuery(context.Background(), sqlGetJob, "true")
+	if err != nil {
+		return nil, err
+	}
+	j, err := scanListedJob(c.pool.QueryRow(context.Background(), sql, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	return j, err
+}
+
+// LoadArgs loads the Args of j, a Job returned by ListJobs or Peek without
+// JobFilter.IncludeArgs. It returns ErrJobNotFound if the Job is no longer in
+// que_jobs.
+func (c *Client) LoadArgs(j *Job) error {
+	sql, err := c.readQuery(context.Background(), sqlGetJob, "true")
+	if err != nil {
+		return err
+	}
+	loaded, err := scanListedJob(c.pool.QueryRow(context.Background(), sql, j.ID))
+	if err == pgx.ErrNoRows {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	j.Args, j.argsErr = loaded.Args, loaded.argsErr
+	j.argsOmitted = false
+	return nil
+}
+
+func scanListedJob(row pgx.Row) (*Job, error) {
+	var (
+		j           = &Job{}
+		args        []byte
+		compression string
+	)
+	err := row.Scan(
+		&j.Queue,
+		&j.Priority,
+		&j.RunAt,
+		&j.ID,
+		&j.Type,
+		&args,
+		&j.ErrorCount,
+		&j.LastError,
+		&j.UniqueKey,
+		&j.RoutingKey,
+		&compression,
+	)
+	if err != nil {
+		return nil, err
+	}
+	j.setStoredArgs(args, compression)
+	return j, nil
+}
+
+// DeleteJobs deletes the Jobs in que_jobs that match f, including those being
+// worked, and returns how many were deleted.
+func (c *Client) DeleteJobs(f JobFilter) (int64, error) {
+	tag, err := c.pool.Exec(context.Background(), c.stmt("que_delete_jobs"), f.AllQueues, f.Queue, f.Type)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,212 @@
+package que
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestListJobs(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, j := range []*Job{
+		{Type: "MyJob", Priority: 2},
+		{Type: "MyJob", Priority: 1, Args: []byte(`[1]`)},
+		{Type: "OtherJob"},
+		{Type: "MyJob", Queue: "other"},
+	} {
+		if err := c.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := c.ListJobs(JobFilter{Type: "MyJob", IncludeArgs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("want 2 jobs, got %d", len(jobs))
+	}
+	if jobs[0].Priority != 1 || string(jobs[0].Args) != `[1]` {
+		t.Errorf("want first job Priority=1 Args=[1], got %d %s", jobs[0].Priority, jobs[0].Args)
+	}
+
+	jobs, err = c.ListJobs(JobFilter{AllQueues: true, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Errorf("want 3 jobs, got %d", len(jobs))
+	}
+}
+
+func TestListJobsOmitsArgs(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(`{"big":true}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.Peek(JobFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	if j.ArgsLoaded() || j.Args != nil {
+		t.Errorf("want args not loaded, got ArgsLoaded=%v Args=%s", j.ArgsLoaded(), j.Args)
+	}
+
+	if err := c.LoadArgs(j); err != nil {
+		t.Fatal(err)
+	}
+	if !j.ArgsLoaded() || string(j.Args) != `{"big":true}` {
+		t.Errorf("want args loaded, got ArgsLoaded=%v Args=%s", j.ArgsLoaded(), j.Args)
+	}
+
+	got, err := c.GetJob(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Args) != `{"big":true}` || got.Type != "MyJob" {
+		t.Errorf("want GetJob to load the job with its args, got %s %s", got.Type, got.Args)
+	}
+
+	if _, err := c.DeleteJobs(JobFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetJob(j.ID); err != ErrJobNotFound {
+		t.Errorf("want ErrJobNotFound, got %v", err)
+	}
+	if err := c.LoadArgs(j); err != ErrJobNotFound {
+		t.Errorf("want ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestDeleteJobs(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, j := range []*Job{
+		{Type: "MyJob"},
+		{Type: "OtherJob"},
+		{Type: "MyJob", Queue: "other"},
+	} {
+		if err := c.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := c.DeleteJobs(JobFilter{Type: "MyJob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 deleted, got %d", n)
+	}
+
+	n, err = c.DeleteJobs(JobFilter{AllQueues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("want 2 deleted, got %d", n)
+	}
+}
+
+func TestReadQuery(t *testing.T) {
+	c := &Client{schema: "jobs"}
+	c.columns.cols = map[string]bool{"routing_key": true}
+
+	sql, err := c.readQuery(context.Background(), sqlGetJob, "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`FROM "jobs".que_jobs`, "THEN convert_to(args::text, 'UTF8') END, error_count", "''::text, coalesce(routing_key, ''), ''::text"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("want query to contain %q, got:\n%s", want, sql)
+		}
+	}
+}
+
+// openTestV0Client returns a Client for a que_jobs table with only the columns
+// of que 0.x, on a pool that doesn't prepare any statements.
+func openTestV0Client(t *testing.T) *Client {
+	pool, err := pgxpool.Connect(context.Background(), testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"DROP SCHEMA IF EXISTS que_go_test_v0 CASCADE",
+		"CREATE SCHEMA que_go_test_v0",
+		`CREATE TABLE que_go_test_v0.que_jobs
+(
+  priority    smallint    NOT NULL DEFAULT 100,
+  run_at      timestamptz NOT NULL DEFAULT now(),
+  job_id      bigserial   NOT NULL,
+  job_class   text        NOT NULL,
+  args        json        NOT NULL DEFAULT '[]'::json,
+  error_count integer     NOT NULL DEFAULT 0,
+  last_error  text,
+  queue       text        NOT NULL DEFAULT '',
+
+  CONSTRAINT que_jobs_pkey PRIMARY KEY (queue, priority, run_at, job_id)
+)`,
+		`INSERT INTO que_go_test_v0.que_jobs (job_class, args, error_count) VALUES ('MyJob', '[1]', 2)`,
+	} {
+		if _, err := pool.Exec(context.Background(), sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewClientWithSchema(pool, "que_go_test_v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReadJobsOldSchema(t *testing.T) {
+	c := openTestV0Client(t)
+	defer closePool(c.pool)
+
+	jobs, err := c.ListJobs(JobFilter{IncludeArgs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("want 1 job, got %d", len(jobs))
+	}
+	j := jobs[0]
+	if j.Type != "MyJob" || string(j.Args) != "[1]" || j.ErrorCount != 2 || j.RoutingKey != "" {
+		t.Errorf("want the job's columns read, got %+v", j)
+	}
+
+	j, err = c.Peek(JobFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadArgs(j); err != nil {
+		t.Fatal(err)
+	}
+	if string(j.Args) != "[1]" {
+		t.Errorf("want Args=[1], got %s", j.Args)
+	}
+
+	if _, err := c.GetJob(j.ID); err != nil {
+		t.Errorf("want GetJob to work, got %v", err)
+	}
+
+	stats, err := c.QueueStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Count != 1 || stats[0].Errored != 1 {
+		t.Errorf("want 1 errored job in the stats, got %+v", stats)
+	}
+}
@@ -0,0 +1,61 @@
+package que
+
+import (
+	"log"
+	"runtime"
+	"sync"
+)
+
+// leakWindowJobs is the number of Jobs of a type over which the growth of the
+// number of goroutines is averaged.
+const leakWindowJobs = 100
+
+// leakThreshold is the average number of goroutines per Job above which the
+// Jobs of a type are suspected of leaking them.
+const leakThreshold = 0.5
+
+// leakDetector attributes the growth of the number of goroutines while
+// WorkFuncs run to their job types, to find WorkFuncs that start goroutines
+// that outlive their Job. It is a heuristic: concurrent Workers, goroutines
+// that exit shortly after their Job and unrelated goroutines all add noise,
+// which averaging over many Jobs only reduces.
+type leakDetector struct {
+	mu    sync.Mutex
+	types map[string]*leakWindow
+}
+
+// leakWindow accumulates the growth for a job type over leakWindowJobs Jobs.
+type leakWindow struct {
+	jobs   int
+	growth int
+}
+
+func newLeakDetector() *leakDetector {
+	return &leakDetector{types: make(map[string]*leakWindow)}
+}
+
+// observe records that running a WorkFunc for a Job of type typ changed the
+// number of goroutines by delta, and logs a warning if the Jobs of typ have
+// grown it persistently. It reports whether it logged a warning.
+func (d *leakDetector) observe(typ string, delta int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lw, ok := d.types[typ]
+	if !ok {
+		lw = &leakWindow{}
+		d.types[typ] = lw
+	}
+	lw.jobs++
+	lw.growth += delta
+	if lw.jobs < leakWindowJobs {
+		return false
+	}
+	leaking := float64(lw.growth) >= leakThreshold*float64(lw.jobs)
+	if leaking {
+		log.Printf("event=goroutine_leak job_type=%s jobs=%d goroutine_growth=%d goroutines=%d",
+			typ, lw.jobs, lw.growth, runtime.NumGoroutine())
+	}
+	*lw = leakWindow{}
+	return leaking
+}
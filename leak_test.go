@@ -0,0 +1,63 @@
+package que
+
+import "testing"
+
+func TestLeakDetector(t *testing.T) {
+	d := newLeakDetector()
+
+	for i := 1; i < leakWindowJobs; i++ {
+		if d.observe("Leaky", 1) {
+			t.Fatalf("want no warning before %d jobs, got one after %d", leakWindowJobs, i)
+		}
+		d.observe("Clean", 0)
+	}
+	if !d.observe("Leaky", 1) {
+		t.Error("want warning for a type leaking a goroutine per job")
+	}
+	if d.observe("Clean", 0) {
+		t.Error("want no warning for a type that doesn't leak")
+	}
+
+	// the window was reset, and noise that cancels out isn't a leak
+	for i := 0; i < leakWindowJobs; i++ {
+		delta := 1
+		if i%2 == 1 {
+			delta = -1
+		}
+		if d.observe("Leaky", delta) {
+			t.Error("want no warning for goroutines that exit after their job")
+		}
+	}
+}
+
+func TestWorkerDetectGoroutineLeaks(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	var stats []JobStats
+	wm := WorkMap{
+		"Leaky": func(j *Job) error {
+			go func() { <-block }()
+			return nil
+		},
+	}
+	w := NewWorker(c, wm)
+	w.DetectGoroutineLeaks = true
+	w.Stats = func(s JobStats) { stats = append(stats, s) }
+
+	if err := c.Enqueue(&Job{Type: "Leaky"}); err != nil {
+		t.Fatal(err)
+	}
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+	if len(stats) != 1 {
+		t.Fatalf("want 1 stats, got %d", len(stats))
+	}
+	if stats[0].GoroutineDelta < 1 {
+		t.Errorf("want GoroutineDelta >= 1, got %d", stats[0].GoroutineDelta)
+	}
+}
@@ -0,0 +1,115 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// notifyChannel returns the channel that jobs in the que_jobs table of schema
+// are announced on when Client.Notify is set. Channel names are limited to 63
+// bytes, so long schema names are cut short.
+func notifyChannel(schema string) string {
+	if schema == "" {
+		return "que_jobs"
+	}
+	if len(schema) > 63-len(".que_jobs") {
+		schema = schema[:63-len(".que_jobs")]
+	}
+	return schema + ".que_jobs"
+}
+
+// listenRetryInterval is how long the listener waits before reconnecting after
+// losing its connection.
+var listenRetryInterval = time.Second
+
+// jobNotification is the payload of a notification sent by Enqueue.
+type jobNotification struct {
+	ID       int64     `json:"id"`
+	Queue    *string   `json:"queue"`
+	Priority int16     `json:"priority"`
+	RunAt    time.Time `json:"run_at"`
+
+	// Ready is true if the job could be worked as soon as it was enqueued,
+	// as opposed to being scheduled for later. It is computed by the
+	// database so that clock skew between hosts doesn't matter.
+	Ready bool `json:"ready"`
+}
+
+// wakes reports whether a Worker of queue should be woken up to work the
+// announced job, given the pool's ListenMaxPriority. A job whose queue was
+// left out of the payload wakes the Workers of every queue.
+func (n *jobNotification) wakes(queue string, maxPriority int16) bool {
+	if n.Queue != nil && *n.Queue != queue {
+		return false
+	}
+	if maxPriority > 0 && n.Priority > maxPriority {
+		return false
+	}
+	return n.Ready
+}
+
+// listen LISTENs for new jobs on a connection from the pool of c until ctx is
+// done. For every job that is ready to be worked on queue, with a priority of
+// at most maxPriority unless it is zero, it wakes one of the Workers waiting
+// on wake, if any.
+func listen(ctx context.Context, c *Client, queue string, maxPriority int16, wake chan<- struct{}) {
+	for {
+		err := listenConn(ctx, c, queue, maxPriority, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listening for jobs: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+			// reconnect
+		}
+	}
+}
+
+func listenConn(ctx context.Context, c *Client, queue string, maxPriority int16, wake chan<- struct{}) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	c.hold(conn)
+	defer c.releaseHeld(conn)
+
+	channel := pgx.Identifier{notifyChannel(c.schema)}.Sanitize()
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	defer func() {
+		// Don't leave the connection listening when it is returned to the
+		// pool. If ctx is done the connection is closed anyway.
+		_, _ = conn.Exec(context.Background(), "UNLISTEN "+channel)
+	}()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var n jobNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &n); err != nil {
+			log.Printf("decoding job notification %q: %v", notification.Payload, err)
+			continue
+		}
+		if !n.wakes(queue, maxPriority) {
+			continue
+		}
+
+		select {
+		case wake <- struct{}{}:
+		default:
+			// all Workers are busy and will find the job on their own
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobNotificationWakes(t *testing.T) {
+	queue := "emails"
+	tests := []struct {
+		payload     string
+		maxPriority int16
+		want        bool
+	}{
+		{`{"id": 1, "queue": "emails", "priority": 100, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": true}`, 0, true},
+		{`{"id": 1, "queue": "emails", "priority": 100, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": false}`, 0, false},
+		{`{"id": 1, "queue": "", "priority": 100, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": true}`, 0, false},
+		{`{"id": 1, "queue": null, "priority": 100, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": true}`, 0, true},
+		{`{"id": 1, "queue": "emails", "priority": 10, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": true}`, 10, true},
+		{`{"id": 1, "queue": "emails", "priority": 11, "run_at": "2020-09-01T12:00:00.123456+00:00", "ready": true}`, 10, false},
+	}
+	for _, tt := range tests {
+		var n jobNotification
+		if err := json.Unmarshal([]byte(tt.payload), &n); err != nil {
+			t.Fatal(err)
+		}
+		if got := n.wakes(queue, tt.maxPriority); got != tt.want {
+			t.Errorf("%s, max priority %d: want wakes=%t, got %t", tt.payload, tt.maxPriority, tt.want, got)
+		}
+	}
+}
+
+func TestNotifyChannel(t *testing.T) {
+	if got := notifyChannel(""); got != "que_jobs" {
+		t.Errorf("want que_jobs, got %q", got)
+	}
+	if got := notifyChannel("jobs"); got != "jobs.que_jobs" {
+		t.Errorf("want jobs.que_jobs, got %q", got)
+	}
+	if got := notifyChannel(strings.Repeat("a", 63)); len(got) != 63 {
+		t.Errorf("want a channel of 63 bytes for a long schema, got %q", got)
+	}
+}
+
+func TestEnqueueNotifyPayload(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	c.Notify = true
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(context.Background(), "LISTEN que_jobs"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN que_jobs")
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Queue: "emails", Priority: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notification, err := conn.Conn().WaitForNotification(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n jobNotification
+	if err := json.Unmarshal([]byte(notification.Payload), &n); err != nil {
+		t.Fatal(err)
+	}
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.ID != j.ID {
+		t.Errorf("want ID=%d, got %d", j.ID, n.ID)
+	}
+	if n.Queue == nil || *n.Queue != "emails" {
+		t.Errorf("want Queue=emails, got %v", n.Queue)
+	}
+	if want := int16(7); n.Priority != want {
+		t.Errorf("want Priority=%d, got %d", want, n.Priority)
+	}
+	if !n.Ready {
+		t.Error("want Ready=true")
+	}
+}
+
+func TestListenWakesWorker(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	c.Notify = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	wake := make(chan struct{})
+	go func() {
+		defer close(done)
+		listen(ctx, c, "", 0, wake)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the listener may not be LISTENing yet, so keep enqueueing until it
+	// notices a job
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-wake:
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("want worker to be woken by enqueue")
+		}
+	}
+}
+
+func TestEnqueueBatchNotify(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	c.Notify = true
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(context.Background(), "LISTEN que_jobs"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN que_jobs")
+
+	jobs := []*Job{{Type: "MyJob"}, {Type: "MyJob"}}
+	if err := c.EnqueueBatch(jobs); err != nil {
+		t.Fatal(err)
+	}
+	if jobs[0].ID == 0 || jobs[1].ID == 0 {
+		t.Fatalf("want IDs set, got %d and %d", jobs[0].ID, jobs[1].ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, j := range jobs {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n jobNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &n); err != nil {
+			t.Fatal(err)
+		}
+		if n.ID != j.ID {
+			t.Errorf("want notification of job %d, got %+v", j.ID, n)
+		}
+	}
+}
+
+func TestNotifySchemaChannel(t *testing.T) {
+	c := openTestSchemaClient(t, "que_go_test_notify")
+	defer closePool(c.pool)
+	c.Notify = true
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	for _, sql := range []string{`LISTEN que_jobs`, `LISTEN "que_go_test_notify.que_jobs"`} {
+		if _, err := conn.Exec(context.Background(), sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN *")
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notification, err := conn.Conn().WaitForNotification(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.Channel != "que_go_test_notify.que_jobs" {
+		t.Errorf("want notification on the schema's channel, got %q", notification.Channel)
+	}
+}
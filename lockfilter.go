@@ -0,0 +1,113 @@
+package que
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lockJobParams is the number of parameters of the lock query, which a
+// LockFilter's parameters follow.
+const lockJobParams = 8
+
+// LockFilter is an extra condition that Jobs must satisfy for a Worker to lock
+// them, for gating Jobs on a feature flag or a tenant allowlist that varies
+// between deployments. Create one with NewLockFilter.
+type LockFilter struct {
+	sql  string
+	args []interface{}
+}
+
+var (
+	placeholderRE = regexp.MustCompile(`\$([0-9]+)`)
+
+	// lockFilterForbidden matches what may not appear in a LockFilter:
+	// statement separators, comments and literals, whose values must be
+	// passed as parameters instead.
+	lockFilterForbidden = regexp.MustCompile(`;|--|/\*|'|"|\$\$|\$[A-Za-z_]`)
+)
+
+// NewLockFilter returns a LockFilter with the SQL condition cond, whose
+// parameters $1, $2... are args:
+//
+//	f, err := que.NewLockFilter("args->>$1::text = ANY($2::text[])", "tenant", allowed)
+//
+// cond is ANDed with the conditions of the lock query, which only considers
+// the Jobs of the Worker's Queue whose RunAt has passed, in order of
+// Priority, RunAt and ID. It may refer to any column of que_jobs, unqualified,
+// and is evaluated for each candidate Job before it is locked, so it should be
+// cheap. Jobs that don't satisfy it are left for other Workers.
+//
+// To keep values out of the SQL text, cond may not contain string or quoted
+// identifier literals, comments or semicolons, and its parentheses must be
+// balanced. Every value must be passed as a parameter, and every parameter in
+// cond must be one of args.
+func NewLockFilter(cond string, args ...interface{}) (*LockFilter, error) {
+	if err := checkLockSQL("lock filter", cond, len(args)); err != nil {
+		return nil, err
+	}
+	return &LockFilter{sql: renumberParams(cond, lockJobParams), args: args}, nil
+}
+
+// checkLockSQL checks that s, the SQL of a lock filter or tenant key (what)
+// with nargs parameters, follows the rules of NewLockFilter.
+func checkLockSQL(what, s string, nargs int) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("que: empty %s", what)
+	}
+	if m := lockFilterForbidden.FindString(s); m != "" {
+		return fmt.Errorf("que: %s %q may not contain %q; pass values as parameters", what, s, m)
+	}
+	if !balancedParens(s) {
+		return fmt.Errorf("que: %s %q has unbalanced parentheses", what, s)
+	}
+	for _, p := range placeholderRE.FindAllString(s, -1) {
+		n, _ := strconv.Atoi(p[1:])
+		if n < 1 || n > nargs {
+			return fmt.Errorf("que: %s %q refers to %s, but has %d parameters", what, s, p, nargs)
+		}
+	}
+	return nil
+}
+
+// renumberParams returns s with its parameters $1, $2... shifted by offset.
+func renumberParams(s string, offset int) string {
+	return placeholderRE.ReplaceAllStringFunc(s, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		return "$" + strconv.Itoa(n+offset)
+	})
+}
+
+// balancedParens reports whether every parenthesis in s is closed, and only
+// after being opened.
+func balancedParens(s string) bool {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			return false
+		}
+	}
+	return depth == 0
+}
+
+// lockSQL returns the lock query with the filter's condition, for the tables
+// in schema.
+func (f *LockFilter) lockSQL(schema string) string {
+	return qualifySQL(schema, f.apply(sqlLockJob))
+}
+
+// apply returns the lock query sql with the filter's condition, if any.
+func (f *LockFilter) apply(sql string) string {
+	if f == nil {
+		return sql
+	}
+	const last = "% $6::integer = $7::integer)"
+	return strings.Replace(sql, last, last+"\n AND ("+f.sql+")", -1)
+}
@@ -0,0 +1,77 @@
+package que
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewLockFilter(t *testing.T) {
+	f, err := NewLockFilter("args->>$1::text = ANY($2::text[])", "tenant", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "args->>$9::text = ANY($10::text[])"; f.sql != want {
+		t.Errorf("want sql %q, got %q", want, f.sql)
+	}
+
+	sql := f.lockSQL("")
+	if got := strings.Count(sql, "AND (args->>$9::text = ANY($10::text[]))"); got != 3 {
+		t.Errorf("want filter in both lock subqueries and the next run_at query, got %d in:\n%s", got, sql)
+	}
+	if got := f.lockSQL("jobs"); !strings.Contains(got, `FROM "jobs".que_jobs`) {
+		t.Errorf("want qualified lock query, got:\n%s", got)
+	}
+}
+
+func TestNewLockFilterInvalid(t *testing.T) {
+	for _, cond := range []string{
+		"",
+		"job_class = 'MyJob'",
+		`"job_class" = $1`,
+		"true; DROP TABLE que_jobs",
+		"true -- comment",
+		"true /* comment */",
+		"job_class = $$MyJob$$",
+		"job_class = $tag$MyJob$tag$",
+		"(job_class = $1",
+		"job_class = $1)",
+		"job_class = $2",
+		"job_class = $0",
+	} {
+		if _, err := NewLockFilter(cond, "MyJob"); err == nil {
+			t.Errorf("want error for %q", cond)
+		}
+	}
+}
+
+func TestWorkerLockFilter(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, args := range []string{`{"tenant":"blocked"}`, `{"tenant":"allowed"}`} {
+		if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(args)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var worked []string
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		worked = append(worked, string(j.Args))
+		return nil
+	}})
+	f, err := NewLockFilter("args->>$1::text = ANY($2::text[])", "tenant", []string{"allowed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.LockFilter = f
+
+	if !w.WorkOne() {
+		t.Fatal("want allowed job worked")
+	}
+	if w.WorkOne() {
+		t.Error("want blocked job not worked")
+	}
+	if len(worked) != 1 || worked[0] != `{"tenant":"allowed"}` {
+		t.Errorf("want only the allowed job worked, got %v", worked)
+	}
+}
@@ -0,0 +1,224 @@
+package que
+
+import (
+	"sync"
+	"time"
+)
+
+// JobStats describes the outcome of a single Job worked by a Worker. It is
+// passed to the Worker's Stats func after every Job.
+type JobStats struct {
+	ID    int64
+	Queue string
+	Type  string
+
+	// PickupDelay is the time between the Job becoming ready to run, at its
+	// RunAt, and a Worker locking it. It measures how far behind the Workers
+	// are, independently of how far in the future the Job was scheduled. For
+	// a Job enqueued to run immediately, it is the enqueue-to-pickup latency.
+	PickupDelay time.Duration
+
+	// Duration is the time spent running the Job's WorkFunc.
+	Duration time.Duration
+
+	// Err is the error that failed the Job, or nil if it succeeded. Panics and
+	// unknown job types are reported as errors.
+	Err error
+
+	// Duplicate is true if the Worker detected that the Job was already
+	// worked. It is only set if duplicate tracking is enabled; see
+	// Worker.DuplicateWindow.
+	Duplicate bool
+
+	// GoroutineDelta is the change in the number of goroutines of the process
+	// while the Job's WorkFunc ran. It is only set if the Worker detects
+	// goroutine leaks; see Worker.DetectGoroutineLeaks.
+	GoroutineDelta int
+
+	// Labels holds the dimensions returned for the Job by the Worker's Labels
+	// func, if any.
+	Labels map[string]string
+}
+
+// LabelFunc returns labels that describe a Job, to break down the JobStats
+// passed to a Worker's Stats func by dimensions other than Queue and Type,
+// such as a tenant ID read from the Job's Args. It is called after the Job's
+// WorkFunc returned, so it may be called with a Job whose Args failed to
+// decode.
+//
+// Every distinct set of labels typically becomes a separate time series in a
+// metrics system, so keep their number of distinct values, their
+// cardinality, bounded: label by tenant only if there are few tenants, and
+// never by Job ID. Controlling it is up to the LabelFunc. The labels are not
+// part of the Worker's Metrics.
+type LabelFunc func(j *Job) map[string]string
+
+// TypeMetrics holds the number of Jobs of a single type that succeeded and
+// failed.
+type TypeMetrics struct {
+	Succeeded int64
+	Failed    int64
+
+	// Duplicates is the number of the Jobs, succeeded or failed, that were
+	// detected as duplicate executions.
+	Duplicates int64
+}
+
+// SuccessRate returns the fraction of Jobs that succeeded, between 0 and 1. It
+// returns 1 if no Jobs were worked.
+func (m TypeMetrics) SuccessRate() float64 {
+	total := m.Succeeded + m.Failed
+	if total == 0 {
+		return 1
+	}
+	return float64(m.Succeeded) / float64(total)
+}
+
+// Metrics is a snapshot of the Jobs worked by a Worker or WorkerPool.
+type Metrics struct {
+	// Since is the start of the period covered by this snapshot, which is when
+	// the previous snapshot was taken.
+	Since time.Time
+
+	// Until is the end of the period covered by this snapshot.
+	Until time.Time
+
+	// Types holds the outcomes of Jobs by job type.
+	Types map[string]TypeMetrics
+}
+
+// metrics accumulates per-type Job outcomes until they are read.
+type metrics struct {
+	mu    sync.Mutex
+	since time.Time
+	types map[string]TypeMetrics
+
+	// recentErrors holds the last few failed Jobs, oldest first.
+	recentErrors []JobStats
+}
+
+// maxRecentErrors is the number of failed Jobs kept for Inspect.
+const maxRecentErrors = 20
+
+func newMetrics() *metrics {
+	return &metrics{
+		since: time.Now(),
+		types: make(map[string]TypeMetrics),
+	}
+}
+
+func (m *metrics) observe(s JobStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm := m.types[s.Type]
+	if s.Err != nil {
+		tm.Failed++
+		if len(m.recentErrors) == maxRecentErrors {
+			m.recentErrors = append(m.recentErrors[:0], m.recentErrors[1:]...)
+		}
+		m.recentErrors = append(m.recentErrors, s)
+	} else {
+		tm.Succeeded++
+	}
+	if s.Duplicate {
+		tm.Duplicates++
+	}
+	m.types[s.Type] = tm
+}
+
+// snapshot returns the accumulated Metrics and resets the counters, so memory
+// use is bounded by the number of job types seen between two snapshots.
+func (m *metrics) snapshot() Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	s := Metrics{Since: m.since, Until: now, Types: m.types}
+	m.since = now
+	m.types = make(map[string]TypeMetrics)
+	return s
+}
+
+// EnqueueStats describes a call to one of the Client's Enqueue methods. It is
+// passed to the Client's EnqueueStats func. A call to EnqueueBatch is reported
+// once for every distinct Queue and Type among its Jobs.
+type EnqueueStats struct {
+	Queue string
+	Type  string
+
+	// Count is the number of Jobs of Queue and Type in the call.
+	Count int
+
+	// Duration is the time the whole call took.
+	Duration time.Duration
+
+	// Err is the error returned by the call, or nil if it succeeded.
+	Err error
+}
+
+// observeEnqueue sends the outcome of enqueueing count jobs to the Client's
+// EnqueueStats func.
+func (c *Client) observeEnqueue(queue, typ string, count int, start time.Time, err error) {
+	if c.EnqueueStats == nil {
+		return
+	}
+	c.EnqueueStats(EnqueueStats{
+		Queue:    queue,
+		Type:     typ,
+		Count:    count,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// observeEnqueueBatch is like observeEnqueue for a batch of jobs, grouped by
+// queue and type.
+func (c *Client) observeEnqueueBatch(jobs []*Job, start time.Time, err error) {
+	if c.EnqueueStats == nil {
+		return
+	}
+	type key struct{ queue, typ string }
+	var keys []key
+	counts := make(map[key]int)
+	for _, j := range jobs {
+		k := key{j.Queue, j.Type}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	d := time.Since(start)
+	for _, k := range keys {
+		c.EnqueueStats(EnqueueStats{
+			Queue:    k.queue,
+			Type:     k.typ,
+			Count:    counts[k],
+			Duration: d,
+			Err:      err,
+		})
+	}
+}
+
+// peek returns the accumulated Metrics and the recent errors without resetting
+// anything.
+func (m *metrics) peek() (Metrics, []JobStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	types := make(map[string]TypeMetrics, len(m.types))
+	for typ, tm := range m.types {
+		types[typ] = tm
+	}
+	errs := append([]JobStats(nil), m.recentErrors...)
+	return Metrics{Since: m.since, Until: time.Now(), Types: types}, errs
+}
+
+// pickupDelay returns the time between a job's runAt and lockedAt. Both are
+// database times, so clock skew between hosts doesn't affect it.
+func pickupDelay(runAt, lockedAt time.Time) time.Duration {
+	if lockedAt.Before(runAt) {
+		return 0
+	}
+	return lockedAt.Sub(runAt)
+}
@@ -0,0 +1,67 @@
+package que
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMetricsSnapshotResets(t *testing.T) {
+	m := newMetrics()
+	m.observe(JobStats{Type: "ChargeCard"})
+	m.observe(JobStats{Type: "ChargeCard"})
+	m.observe(JobStats{Type: "ChargeCard", Err: errors.New("declined")})
+	m.observe(JobStats{Type: "SendEmail"})
+
+	s := m.snapshot()
+	if want, got := (TypeMetrics{Succeeded: 2, Failed: 1}), s.Types["ChargeCard"]; got != want {
+		t.Errorf("want ChargeCard=%+v, got %+v", want, got)
+	}
+	if want, got := (TypeMetrics{Succeeded: 1}), s.Types["SendEmail"]; got != want {
+		t.Errorf("want SendEmail=%+v, got %+v", want, got)
+	}
+	if s.Until.Before(s.Since) {
+		t.Errorf("want Until >= Since, got %v < %v", s.Until, s.Since)
+	}
+
+	s2 := m.snapshot()
+	if len(s2.Types) != 0 {
+		t.Errorf("want no types after reset, got %+v", s2.Types)
+	}
+	if !s2.Since.Equal(s.Until) {
+		t.Errorf("want Since=%v, got %v", s.Until, s2.Since)
+	}
+}
+
+func TestTypeMetricsSuccessRate(t *testing.T) {
+	tests := []struct {
+		m    TypeMetrics
+		want float64
+	}{
+		{TypeMetrics{}, 1},
+		{TypeMetrics{Succeeded: 19, Failed: 1}, 0.95},
+		{TypeMetrics{Failed: 3}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.SuccessRate(); got != tt.want {
+			t.Errorf("%+v: want SuccessRate=%v, got %v", tt.m, tt.want, got)
+		}
+	}
+}
+
+func TestPickupDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		runAt time.Time
+		want  time.Duration
+	}{
+		{now.Add(-3 * time.Second), 3 * time.Second},
+		{now, 0},
+		{now.Add(time.Minute), 0},
+	}
+	for _, tt := range tests {
+		if got := pickupDelay(tt.runAt, now); got != tt.want {
+			t.Errorf("want pickupDelay=%v, got %v", tt.want, got)
+		}
+	}
+}
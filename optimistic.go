@@ -0,0 +1,69 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoConn is returned by the methods of a Job that need its connection when
+// it has none, because it is leased to run optimistically (see
+// Worker.Optimistic) or Done was already called.
+var ErrNoConn = errors.New("que: job has no connection")
+
+// lease makes j run optimistically: it pushes the RunAt of j lease into the
+// future, then releases its advisory lock and its connection, which is set
+// aside for reacquire if it belongs to the Worker. Other Workers leave j alone
+// until the lease expires. If j is no longer in que_jobs, it returns
+// pgx.ErrNoRows.
+func (j *Job) lease(lease time.Duration) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ctx := context.Background()
+	err := j.conn.QueryRow(ctx, j.stmt("que_lease_job"), j.Queue, j.Priority, j.RunAt, j.ID, lease.Microseconds()).Scan(&j.RunAt)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	_ = j.conn.QueryRow(ctx, j.stmt("que_unlock_job"), j.ID, j.lockKeyspace()).Scan(&ok)
+	j.leased = true
+	if j.keepConn {
+		j.leasedConn = j.conn
+	} else {
+		j.conn.Release()
+	}
+	j.conn = nil
+	return nil
+}
+
+// reacquire gives a leased job the Worker's connection back, or a connection
+// from the pool, to be finished on. It does nothing if the job has a
+// connection.
+func (j *Job) reacquire() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.leasedConn != nil {
+		j.conn, j.leasedConn = j.leasedConn, nil
+	}
+	if j.conn != nil || j.pool == nil {
+		return nil
+	}
+	conn, err := j.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	j.conn = conn
+	return nil
+}
+
+// optimisticLease returns the lease of j if it should run optimistically, or
+// zero.
+func (w *Worker) optimisticLease(j *Job) time.Duration {
+	if w.Optimistic == nil || w.Ack.kind == ackOnCommit {
+		return 0
+	}
+	return w.Optimistic(j)
+}
@@ -0,0 +1,276 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerOptimistic(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, fail := range []bool{false, true} {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			conn   bool
+			locked int
+			runAt  time.Time
+		)
+		w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+			conn = j.Conn() != nil
+			err := c.pool.QueryRow(context.Background(), "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND objid = $1", j.ID).Scan(&locked)
+			if err != nil {
+				return err
+			}
+			if err := c.pool.QueryRow(context.Background(), "SELECT run_at FROM que_jobs WHERE job_id = $1", j.ID).Scan(&runAt); err != nil {
+				return err
+			}
+			if fail {
+				return errors.New("failed")
+			}
+			return nil
+		}})
+		w.Optimistic = func(j *Job) time.Duration { return time.Hour }
+		if !w.WorkOne() {
+			t.Fatal("want job worked")
+		}
+
+		if conn {
+			t.Error("want no connection while the WorkFunc runs")
+		}
+		if locked != 0 {
+			t.Errorf("want job unlocked while the WorkFunc runs, got %d locks", locked)
+		}
+		if until := time.Until(runAt); until < 50*time.Minute {
+			t.Errorf("want job leased for an hour, got run_at in %s", until)
+		}
+
+		j, err := findOneJob(c.pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fail {
+			if j != nil {
+				t.Errorf("want job deleted, got %+v", j)
+			}
+			continue
+		}
+		if j == nil {
+			t.Fatal("want failed job kept for retry, got none")
+		}
+		if j.ErrorCount != 1 || j.LastError.String != "failed" {
+			t.Errorf("want error recorded, got %d %q", j.ErrorCount, j.LastError.String)
+		}
+		if until := time.Until(j.RunAt); until > time.Minute {
+			t.Errorf("want job retried after its retry delay rather than its lease, got run_at in %s", until)
+		}
+	}
+}
+
+func TestWorkerPoolOptimisticBeyondPoolSize(t *testing.T) {
+	c := openTestClientMaxConns(t, 2)
+	defer closePool(c.pool)
+
+	const workers = 4
+	var jobs []*Job
+	for i := 0; i < workers; i++ {
+		jobs = append(jobs, &Job{Type: "MyJob"})
+	}
+	if err := c.EnqueueBatch(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	// every job waits for all of them to run at once, which needs more
+	// connections than the pool has unless they don't hold one
+	var started sync.WaitGroup
+	started.Add(workers)
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	wp := NewWorkerPool(c, WorkMap{"MyJob": func(j *Job) error {
+		started.Done()
+		select {
+		case <-all:
+			return nil
+		case <-time.After(10 * time.Second):
+			return errors.New("not run concurrently")
+		}
+	}}, workers)
+	wp.Interval = 10 * time.Millisecond
+	wp.Optimistic = func(j *Job) time.Duration { return time.Minute }
+	wp.Start()
+	defer wp.Shutdown()
+
+	select {
+	case <-all:
+	case <-time.After(10 * time.Second):
+		t.Fatal("want all jobs running at once")
+	}
+}
+
+// BenchmarkWorkerPoolOptimistic compares how long a pool of 8 Workers sharing
+// 2 connections takes to work Jobs that each wait 5ms, holding their lock or
+// leased.
+func BenchmarkWorkerPoolOptimistic(b *testing.B) {
+	for _, lease := range []time.Duration{0, time.Minute} {
+		name := "locked"
+		if lease > 0 {
+			name = "optimistic"
+		}
+		b.Run(name, func(b *testing.B) {
+			c := openTestClientMaxConns(b, 2)
+			defer closePool(c.pool)
+
+			jobs := make([]*Job, b.N)
+			for i := range jobs {
+				jobs[i] = &Job{Type: "Sleep"}
+			}
+			if err := c.EnqueueBatch(jobs); err != nil {
+				b.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(b.N)
+			wp := NewWorkerPool(c, WorkMap{"Sleep": func(j *Job) error {
+				defer wg.Done()
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			}}, 8)
+			wp.Interval = time.Millisecond
+			wp.Optimistic = func(j *Job) time.Duration { return lease }
+
+			b.ResetTimer()
+			wp.Start()
+			wg.Wait()
+			b.StopTimer()
+			wp.Shutdown()
+		})
+	}
+}
+
+func TestWorkerOptimisticSingleFlightAcrossProcesses(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, key := range []string{"account-7", ""} {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var conn bool
+		w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+			conn = j.Conn() != nil
+			return nil
+		}})
+		w.Optimistic = func(j *Job) time.Duration { return time.Minute }
+		w.SingleFlight = func(j *Job) string { return key }
+		w.SingleFlightAcrossProcesses = true
+		if !w.WorkOne() {
+			t.Fatal("want job worked")
+		}
+
+		if want := key != ""; conn != want {
+			t.Errorf("key %q: want connection kept=%v, got %v", key, want, conn)
+		}
+		if j, err := findOneJob(c.pool); err != nil || j != nil {
+			t.Errorf("key %q: want job deleted, got %+v, %v", key, j, err)
+		}
+	}
+
+	// the single-flight lock was released with its connection still held
+	var locks int
+	if err := c.pool.QueryRow(context.Background(), "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory'").Scan(&locks); err != nil {
+		t.Fatal(err)
+	}
+	if locks != 0 {
+		t.Errorf("want no advisory locks left, got %d", locks)
+	}
+}
+
+func TestWorkerOptimisticNoConn(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(map[string]error)
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		errs["Delete"] = j.Delete()
+		errs["Error"] = j.Error("failed")
+		errs["DeadLetter"] = j.DeadLetter("failed")
+		errs["Advance"] = j.Advance(map[string]int{"step": 2}, time.Now())
+		errs["Checkpoint"] = j.Checkpoint()
+		errs["SetResult"] = j.SetResult("done")
+		return nil
+	}})
+	w.Optimistic = func(j *Job) time.Duration { return time.Minute }
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	for method, err := range errs {
+		if err != ErrNoConn {
+			t.Errorf("%s: want ErrNoConn, got %v", method, err)
+		}
+	}
+	if j, err := findOneJob(c.pool); err != nil || j != nil {
+		t.Errorf("want job deleted by the Worker, got %+v, %v", j, err)
+	}
+}
+
+func TestWorkerOptimisticBatched(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, typ := range []string{"GoodJob", "BadJob"} {
+		if err := c.Enqueue(&Job{Type: typ}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns := 0
+	check := func(j *Job) {
+		if j.Conn() != nil {
+			conns++
+		}
+	}
+	w := NewWorker(c, WorkMap{
+		"GoodJob": func(j *Job) error { check(j); return nil },
+		"BadJob":  func(j *Job) error { check(j); return errors.New("failed") },
+	})
+	w.Ack = AckBatched(10, time.Hour)
+	w.ErrorBatchWindow = time.Hour
+	w.Optimistic = func(j *Job) time.Duration { return time.Hour }
+	defer w.releaseAckConn()
+
+	for i := 0; i < 2; i++ {
+		if !w.WorkOne() {
+			t.Fatal("want job worked")
+		}
+	}
+	if conns != 0 {
+		t.Errorf("want no connection while the WorkFuncs run, got %d", conns)
+	}
+	if len(w.acks) != 1 || w.acks[0].locked || len(w.failures) != 1 || w.failures[0].locked {
+		t.Fatalf("want one unlocked ack and failure pending, got %+v and %+v", w.acks, w.failures)
+	}
+
+	w.Flush()
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil || j.Type != "BadJob" || j.ErrorCount != 1 {
+		t.Errorf("want only the failed job kept with its error, got %+v", j)
+	}
+}
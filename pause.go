@@ -0,0 +1,75 @@
+package que
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// PauseQueue pauses queue in every process at once, for instance during the
+// outage of a service its Jobs depend on: Workers with a PauseCheckInterval
+// stop locking Jobs from queue until ResumeQueue is called. Jobs can still be
+// enqueued, and Jobs already running finish as usual. The flag is stored in
+// the que_queue_state table.
+//
+// Workers cache the flag for their PauseCheckInterval, so they stop locking
+// Jobs up to PauseCheckInterval after PauseQueue returns. After ResumeQueue,
+// they start again within PauseCheckInterval plus their Interval.
+func (c *Client) PauseQueue(queue string) error {
+	return c.setQueuePaused(queue, true)
+}
+
+// ResumeQueue resumes a queue paused with PauseQueue.
+func (c *Client) ResumeQueue(queue string) error {
+	return c.setQueuePaused(queue, false)
+}
+
+func (c *Client) setQueuePaused(queue string, paused bool) error {
+	_, err := c.pool.Exec(context.Background(), c.stmt("que_set_queue_paused"), queue, paused)
+	return err
+}
+
+// QueuePaused reports whether queue was paused with PauseQueue.
+func (c *Client) QueuePaused(queue string) (bool, error) {
+	var paused bool
+	err := c.pool.QueryRow(context.Background(), c.stmt("que_queue_paused"), queue).Scan(&paused)
+	return paused, err
+}
+
+// pauseCache caches the paused flag of a queue for the Workers working it.
+type pauseCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	paused  bool
+}
+
+// queuePaused reports whether the Worker's Queue is paused, checking the
+// database at most every PauseCheckInterval. If the check fails, the queue is
+// assumed not to be paused, so that a broken kill switch doesn't stop work.
+func (w *Worker) queuePaused() bool {
+	if w.PauseCheckInterval <= 0 {
+		return false
+	}
+	if w.pause == nil {
+		w.pause = &pauseCache{}
+	}
+
+	p := w.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.checked) < w.PauseCheckInterval {
+		return p.paused
+	}
+	paused, err := w.c.QueuePaused(w.Queue)
+	if err != nil {
+		log.Printf("attempting to check whether queue %q is paused: %v", w.Queue, err)
+		paused = false
+	}
+	if paused != p.paused {
+		log.Printf("event=queue_paused queue=%q paused=%t", w.Queue, paused)
+	}
+	p.checked, p.paused = time.Now(), paused
+	return paused
+}
@@ -0,0 +1,64 @@
+package que
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseQueue(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PauseQueue(""); err != nil {
+		t.Fatal(err)
+	}
+	paused, err := c.QueuePaused("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !paused {
+		t.Fatal("want queue paused")
+	}
+	if paused, err := c.QueuePaused("other"); err != nil || paused {
+		t.Errorf("want other queue not paused, got %v, %v", paused, err)
+	}
+
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error { return nil }})
+	w.PauseCheckInterval = time.Hour
+	if w.WorkOne() {
+		t.Fatal("want no job worked from a paused queue")
+	}
+
+	// the flag is cached until the next check
+	if err := c.ResumeQueue(""); err != nil {
+		t.Fatal(err)
+	}
+	if w.WorkOne() {
+		t.Fatal("want the cached paused flag honored")
+	}
+
+	w.pause.checked = time.Time{}
+	if !w.WorkOne() {
+		t.Error("want job worked once the queue is resumed")
+	}
+}
+
+func TestWorkerIgnoresPauseByDefault(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PauseQueue(""); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error { return nil }})
+	if !w.WorkOne() {
+		t.Error("want job worked without a PauseCheckInterval")
+	}
+}
@@ -3,6 +3,8 @@ package que
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -45,11 +47,93 @@ type Job struct {
 	// failed. It is ignored on job creation.
 	LastError pgtype.Text
 
+	// UniqueKey identifies the Job among the pending jobs, e.g.
+	// "rebuild-index:tenant-42". It is only used by EnqueueUnique, which skips
+	// the Job if another pending job has the same UniqueKey.
+	UniqueKey string
+
+	// RoutingKey names the shard of state the Job works on, such as
+	// "cache-shard-12". Workers that own the shard prefer it, see
+	// Worker.RoutingShards. It is optional.
+	RoutingKey string
+
 	mu         sync.Mutex
 	finalized  bool
 	reschedule bool
 	pool       *pgxpool.Pool
 	conn       *pgxpool.Conn
+	schema     string
+
+	// pickupDelay is the time between RunAt and the job being locked.
+	pickupDelay time.Duration
+
+	// ctx is cancelled when the Worker working the job starts shutting down.
+	ctx context.Context
+
+	// retryPolicy is the RetryPolicy of the Worker working the job.
+	retryPolicy RetryPolicy
+
+	// client is the Client that locked the job, and followups are the jobs to
+	// enqueue with it when the job is finalized.
+	client    *Client
+	followups []*Job
+
+	// duplicate is set when the Worker detects that the job was already
+	// worked.
+	duplicate bool
+
+	// keepConn is set when conn belongs to the Worker rather than the job, so
+	// Done must not release it.
+	keepConn bool
+
+	// leased is set when the job was leased to run optimistically, which
+	// released its advisory lock.
+	leased bool
+
+	// leasedConn is the Worker's connection, set aside while the job is
+	// leased.
+	leasedConn *pgxpool.Conn
+
+	// tx is the transaction the job is worked in with AckOnCommit.
+	tx pgx.Tx
+
+	// cancelled is set to 1 when the Worker sees that the job's cancellation
+	// was requested.
+	cancelled int32
+
+	// argsOmitted is set when the job was listed without its Args.
+	argsOmitted bool
+
+	// goroutineDelta is the change in the number of goroutines while the
+	// job's WorkFunc ran, if the Worker detects goroutine leaks.
+	goroutineDelta int
+
+	// argsErr is set when the job's Args couldn't be decompressed, and is
+	// returned when decoding them.
+	argsErr error
+
+	// argsNull is set when the job's Args were NULL and were replaced by the
+	// Client's NullArgs.
+	argsNull bool
+
+	// tenant is the tenant the job was locked for, if it was locked by a
+	// Worker with a TenantKey.
+	tenant string
+}
+
+// Context returns a context that is cancelled when the Worker working this job
+// starts shutting down. Long-running WorkFuncs can watch it to checkpoint and
+// return early instead of delaying the shutdown. For jobs not being worked by
+// a Worker, it returns a context that is never cancelled.
+//
+// A WorkFunc that stops because this context is cancelled should return
+// ctx.Err(), or an error wrapping it, rather than nil, so that its Job is
+// retried instead of completed; see Worker.TreatCancelledSuccessAsRetry.
+func (j *Job) Context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
 }
 
 // Conn returns the pgx connection that this job is locked to. You may initiate
@@ -64,6 +148,15 @@ func (j *Job) Conn() *pgxpool.Conn {
 	return j.conn
 }
 
+// isFinalized reports whether the job was already deleted, rescheduled or
+// dead-lettered.
+func (j *Job) isFinalized() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.finalized
+}
+
 // Delete marks this job as complete by deleting it form the database.
 //
 // You must also later call Done() to return this job's database connection to
@@ -76,7 +169,10 @@ func (j *Job) Delete() error {
 		return nil
 	}
 
-	_, err := j.conn.Exec(context.Background(), "que_destroy_job", j.Queue, j.Priority, j.RunAt, j.ID)
+	err := j.execFinalize(
+		stmtArgs{j.stmt("que_destroy_job"), []interface{}{j.Queue, j.Priority, j.RunAt, j.ID}},
+		stmtArgs{j.stmt("que_release_children"), []interface{}{[]int64{j.ID}}},
+	)
 	if err != nil {
 		return err
 	}
@@ -101,16 +197,22 @@ func (j *Job) Update() error {
 		return ErrMissingType
 	}
 
-	_, err := j.conn.Exec(context.Background(), "que_update_job",
+	args, compression, compressed, err := compressArgs(j.Args, j.argsCompression())
+	if err != nil {
+		return err
+	}
+	err = j.execFinalize(stmtArgs{j.stmt("que_update_job"), []interface{}{
 		j.ID,
 		j.Priority,
 		j.RunAt,
 		j.Type,
-		j.Args,
+		args,
 		j.ErrorCount,
 		j.LastError,
 		j.Queue,
-	)
+		compression,
+		compressed,
+	}})
 
 	if err != nil {
 		return err
@@ -143,16 +245,26 @@ func (j *Job) Done() {
 		return
 	}
 
-	var ok bool
-	// Swallow this error because we don't want an unlock failure to cause work to
-	// stop.
-	_ = j.conn.QueryRow(context.Background(), "que_unlock_job", j.ID).Scan(&ok)
+	if !j.leased {
+		var ok bool
+		// Swallow this error because we don't want an unlock failure to cause work to
+		// stop.
+		_ = j.conn.QueryRow(context.Background(), j.stmt("que_unlock_job"), j.ID, j.lockKeyspace()).Scan(&ok)
+	}
 
-	j.conn.Release()
+	j.releaseConn()
 	j.pool = nil
 	j.conn = nil
 }
 
+// lockKeyspace returns the LockKeyspace of the Client that locked this job.
+func (j *Job) lockKeyspace() int32 {
+	if j.client == nil {
+		return 0
+	}
+	return j.client.LockKeyspace
+}
+
 // Reschedule this job for a later time
 func (j *Job) Reschedule(runAt time.Time) {
 	j.RunAt = runAt
@@ -169,17 +281,27 @@ func (j *Job) ResetError() {
 
 }
 
-// Error marks the job as failed and schedules it to be reworked. An error
-// message or backtrace can be provided as msg, which will be saved on the job.
-// It will also increase the error count.
+// Error marks the job as failed and schedules it to be reworked after the delay
+// given by the RetryPolicy of the Worker working it, RubyQueBackoff by default.
+// An error message or backtrace can be provided as msg, which will be saved on
+// the job. It will also increase the error count.
 //
 // You must also later call Done() to return this job's database connection to
 // the pool.
 func (j *Job) Error(msg string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil {
+		return ErrNoConn
+	}
 	errorCount := j.ErrorCount + 1
-	delay := intPow(int(errorCount), 4) + 3 // TODO: configurable delay
+	delay := j.retryDelay(errorCount)
 
-	_, err := j.conn.Exec(context.Background(), "que_set_error", errorCount, delay, msg, j.Queue, j.Priority, j.RunAt, j.ID)
+	err := j.healing("error", func() error {
+		_, err := j.conn.Exec(context.Background(), j.stmt("que_set_error"), errorCount, delay.Microseconds(), msg, j.Queue, j.Priority, j.RunAt, j.ID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -189,14 +311,111 @@ func (j *Job) Error(msg string) error {
 // Client is a Que client that can add jobs to the queue and remove jobs from
 // the queue.
 type Client struct {
-	pool *pgxpool.Pool
+	// Notify makes Enqueue, EnqueueUnique, EnqueueBatch and EnqueueSpread
+	// send a notification on the que_jobs channel for every new job, which
+	// lets a WorkerPool with Listen set start working it without waiting for
+	// its next poll. A Client created with NewClientWithSchema uses the
+	// channel "<schema>.que_jobs" instead, so that Clients of different
+	// schemas don't wake each other. The payload is a small JSON object
+	// holding the job's id, queue, priority and run_at. Queue names longer
+	// than 1024 bytes are sent as null to stay well within PostgreSQL's 8000
+	// byte payload limit.
+	//
+	// Notifications are sent when the enqueueing transaction commits, and
+	// sending them serializes commits, so leave Notify off for very high
+	// enqueue rates.
+	Notify bool
+
+	// EnqueueStats, if set, is called after every call to Enqueue,
+	// EnqueueInTx, EnqueueUnique or EnqueueBatch, so that processes that only
+	// enqueue Jobs can report on them. It is called synchronously and may be
+	// called concurrently, so it should return quickly.
+	EnqueueStats func(EnqueueStats)
+
+	// MaxConcurrentEnqueues caps the number of calls to Enqueue,
+	// EnqueueUnique and EnqueueBatch that use a connection from the pool at
+	// the same time. Further calls wait in-process for a slot, so that bursts
+	// of enqueues can't take all of the pool's connections away from the
+	// Workers. EnqueueInTx uses the caller's transaction and isn't limited.
+	// It must be set before the Client is first used. The default, zero,
+	// means no limit. See also ReserveWorkerConns.
+	MaxConcurrentEnqueues int
+
+	// LockKeyspace separates the advisory locks on this Client's Jobs from
+	// those of other que deployments sharing the database. By default, as in
+	// Ruby que, a Job is locked with the single-key advisory lock on its ID.
+	// Two deployments with separate que_jobs tables, for instance in different
+	// schemas, then lock the same keys for Jobs with the same ID, and a Worker
+	// of one skips a Job while the other works the Job with the same ID.
+	//
+	// A non-zero LockKeyspace locks Jobs with the two-key form instead, with
+	// LockKeyspace as the first key and the low 32 bits of the Job's ID as the
+	// second, so deployments with different LockKeyspaces never block each
+	// other. Within a deployment, only Jobs whose IDs are 2^32 apart share a
+	// key, and a shared key only delays one of them, never runs either twice.
+	//
+	// All of the Clients, Workers and Ruby processes working a table must use
+	// the same LockKeyspace, and it must not be changed while Jobs are locked.
+	// Ruby que only supports the default, zero.
+	//
+	// Schedulers and SingleFlightAcrossProcesses lock two-key advisory locks
+	// too, with the first key hashtext('que_scheduler') and
+	// hashtext('que_single_flight') respectively. Don't use either value,
+	// which SELECT hashtext('que_scheduler') shows, as a LockKeyspace: Job
+	// locks would then share keys with those locks and delay each other.
+	LockKeyspace int32
+
+	// NullArgs replaces the Args of the Jobs locked by this Client when they
+	// are NULL, either SQL NULL or the JSON null, which rows written by other
+	// tools or older Ruby versions may hold. WorkFuncs then see valid JSON
+	// rather than failing to decode empty input. The default, nil, stands for
+	// [], the column's default. Set it to {} for handlers that decode Args into
+	// a struct. If decoding the replacement fails, DecodeInto and ScanArgs
+	// return an error wrapping ErrNullArgs.
+	NullArgs []byte
+
+	// TraceInjector, if set, stores the trace of the context passed to
+	// EnqueueContext in the Job. See TraceparentInjector.
+	TraceInjector TraceInjector
+
+	// MaxFutureRunAt and MaxPastRunAt, if set, make the Client refuse to
+	// enqueue Jobs whose RunAt is further in the future or in the past than
+	// they allow, with a *RunAtError, rather than letting a bug in duration
+	// math schedule a Job for the year 9999, where it would sit forever
+	// unnoticed. They are checked against the local clock, so leave room for
+	// clock skew. A zero RunAt, which means now, is always allowed. The
+	// defaults, zero, allow any RunAt.
+	MaxFutureRunAt time.Duration
+	MaxPastRunAt   time.Duration
+
+	pool   *pgxpool.Pool
+	schema string
+
+	enqueueSlotsOnce sync.Once
+	enqueueSlots     chan struct{}
+
+	// reservedConns is the number of the pool's connections that enqueues
+	// leave to the Workers.
+	reservedConns int
+
+	columns jobColumns
+
+	// argsCompression compresses the Args of enqueued Jobs, see
+	// WithArgsCompression.
+	argsCompression Compression
+
+	held heldConns
 
 	// TODO: add a way to specify default queueing options
 }
 
-// NewClient creates a new Client that uses the pgx pool.
-func NewClient(pool *pgxpool.Pool) *Client {
-	return &Client{pool: pool}
+// NewClient creates a new Client that uses the pgx pool, configured by opts.
+func NewClient(pool *pgxpool.Pool, opts ...ClientOption) *Client {
+	c := &Client{pool: pool}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // ErrMissingType is returned when you attempt to enqueue a job with no Type
@@ -205,7 +424,16 @@ var ErrMissingType = errors.New("job type must be specified")
 
 // Enqueue adds a job to the queue.
 func (c *Client) Enqueue(j *Job) error {
-	return execEnqueue(j, c.pool)
+	start := time.Now()
+	defer c.acquireEnqueueSlot()()
+	err := c.checkRunAt(j)
+	if err == nil {
+		err = c.onConn(context.Background(), "enqueue", func(conn *pgx.Conn) error {
+			return execEnqueue(j, conn, c.insertStmt(), c.argsCompression)
+		})
+	}
+	c.observeEnqueue(j.Queue, j.Type, 1, start, err)
+	return err
 }
 
 // EnqueueInTx adds a job to the queue within the scope of the transaction tx.
@@ -215,14 +443,194 @@ func (c *Client) Enqueue(j *Job) error {
 // It is the caller's responsibility to Commit or Rollback the transaction after
 // this function is called.
 func (c *Client) EnqueueInTx(j *Job, tx pgx.Tx) error {
-	return execEnqueue(j, tx)
+	start := time.Now()
+	err := c.checkRunAt(j)
+	if err == nil {
+		err = execEnqueue(j, tx, c.insertStmt(), c.argsCompression)
+	}
+	c.observeEnqueue(j.Queue, j.Type, 1, start, err)
+	return err
 }
 
-func execEnqueue(j *Job, q queryable) error {
+// EnqueueBatch adds all of jobs to the queue in a single statement, so either
+// all of them are enqueued or none are. The ID of each Job is set to its
+// generated ID, in the same order as jobs, so that they can be correlated with
+// other records.
+func (c *Client) EnqueueBatch(jobs []*Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	start := time.Now()
+	defer c.acquireEnqueueSlot()()
+	err := c.enqueueBatch(jobs)
+	c.observeEnqueueBatch(jobs, start, err)
+	return err
+}
+
+func (c *Client) enqueueBatch(jobs []*Job) error {
+
+	var (
+		queues     = make([]*string, len(jobs))
+		priorities = make([]*int16, len(jobs))
+		runAts     = make([]*time.Time, len(jobs))
+		types      = make([]string, len(jobs))
+		args       = make([]*string, len(jobs))
+		routing    = make([]*string, len(jobs))
+		comps      = make([]*string, len(jobs))
+		compressed = make([][]byte, len(jobs))
+	)
+	for i, j := range jobs {
+		if j.Type == "" {
+			return ErrMissingType
+		}
+		if err := c.checkRunAt(j); err != nil {
+			return err
+		}
+		if j.Queue != "" {
+			queues[i] = &j.Queue
+		}
+		if j.Priority != 0 {
+			priorities[i] = &j.Priority
+		}
+		if !j.RunAt.IsZero() {
+			runAts[i] = &j.RunAt
+		}
+		types[i] = j.Type
+		stored, comp, b, err := compressArgs(j.Args, c.argsCompression)
+		if err != nil {
+			return err
+		}
+		if len(stored) != 0 {
+			s := string(stored)
+			args[i] = &s
+		}
+		comps[i], compressed[i] = comp, b
+		if j.RoutingKey != "" {
+			routing[i] = &j.RoutingKey
+		}
+	}
+
+	stmt := c.stmt("que_insert_jobs")
+	if c.Notify {
+		stmt = c.stmt("que_insert_jobs_notify")
+	}
+	rows, err := c.pool.Query(context.Background(), stmt, queues, priorities, runAts, types, args, routing, comps, compressed)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, len(jobs))
+	for rows.Next() {
+		var id int64
+		dest := []interface{}{&id}
+		if c.Notify {
+			// skip the result of pg_notify
+			dest = append(dest, nil)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) != len(jobs) {
+		return fmt.Errorf("que: enqueued %d jobs, want %d", len(ids), len(jobs))
+	}
+
+	for i, j := range jobs {
+		j.ID = ids[i]
+	}
+	return nil
+}
+
+// ReserveWorkerConns keeps n of the connections of the Client's pool for the
+// Workers and other users of the pool, by capping the number of enqueues that
+// use a connection from the pool at the same time to its MaxConns minus n,
+// like MaxConcurrentEnqueues does. Further calls wait in-process for a slot,
+// so that a burst of enqueues can't starve the Workers that drain the queue:
+// a delayed enqueue only adds latency, while stalled Workers let the backlog
+// grow. If MaxConcurrentEnqueues is also set, the lower of the two caps
+// applies.
+//
+// Only this Client's enqueues are held back, so the reservation only holds if
+// the other users of the pool, such as other Clients, keep within it too.
+// Workers don't take connections from the reservation before others; it is
+// simply never used by this Client's enqueues.
+//
+// It must be called after MaxConcurrentEnqueues is set and before the Client
+// is first used to enqueue. It returns an error if n is negative or leaves no
+// connection for enqueues.
+func (c *Client) ReserveWorkerConns(n int) error {
+	maxConns := int(c.pool.Config().MaxConns)
+	if n < 0 || n >= maxConns {
+		return fmt.Errorf("que: cannot reserve %d of the pool's %d connections for workers", n, maxConns)
+	}
+	reserved := false
+	c.enqueueSlotsOnce.Do(func() {
+		c.reservedConns = n
+		c.initEnqueueSlots()
+		reserved = true
+	})
+	if !reserved {
+		return errors.New("que: ReserveWorkerConns called after the Client was used to enqueue")
+	}
+	return nil
+}
+
+// initEnqueueSlots creates the semaphore that caps the number of concurrent
+// enqueues, if there is a cap.
+func (c *Client) initEnqueueSlots() {
+	slots := c.MaxConcurrentEnqueues
+	if c.reservedConns > 0 {
+		free := int(c.pool.Config().MaxConns) - c.reservedConns
+		if slots <= 0 || free < slots {
+			slots = free
+		}
+	}
+	if slots > 0 {
+		c.enqueueSlots = make(chan struct{}, slots)
+	}
+}
+
+// acquireEnqueueSlot waits until fewer than MaxConcurrentEnqueues enqueues are
+// in flight, or fewer than the connections not reserved for the Workers, and
+// returns the func that frees the slot it takes.
+func (c *Client) acquireEnqueueSlot() (release func()) {
+	c.enqueueSlotsOnce.Do(c.initEnqueueSlots)
+	if c.enqueueSlots == nil {
+		return func() {}
+	}
+	c.enqueueSlots <- struct{}{}
+	return func() { <-c.enqueueSlots }
+}
+
+// insertStmt returns the name of the prepared statement used to insert jobs.
+func (c *Client) insertStmt() string {
+	if c.Notify {
+		return c.stmt("que_insert_job_notify")
+	}
+	return c.stmt("que_insert_job")
+}
+
+func execEnqueue(j *Job, q queryable, stmt string, comp Compression) error {
 	if j.Type == "" {
 		return ErrMissingType
 	}
 
+	args, err := insertArgs(j, comp)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(context.Background(), stmt, args...)
+	return err
+}
+
+// insertArgs returns the arguments of the statements that insert a single job,
+// with its Args compressed with comp.
+func insertArgs(j *Job, comp Compression) ([]interface{}, error) {
 	queue := &pgtype.Text{
 		String: j.Queue,
 		Status: pgtype.Null,
@@ -247,16 +655,27 @@ func execEnqueue(j *Job, q queryable) error {
 		runAt.Status = pgtype.Present
 	}
 
+	stored, compression, compressed, err := compressArgs(j.Args, comp)
+	if err != nil {
+		return nil, err
+	}
 	args := &pgtype.Bytea{
-		Bytes:  j.Args,
+		Bytes:  stored,
 		Status: pgtype.Null,
 	}
-	if len(j.Args) != 0 {
+	if len(stored) != 0 {
 		args.Status = pgtype.Present
 	}
 
-	_, err := q.Exec(context.Background(), "que_insert_job", queue, priority, runAt, j.Type, args)
-	return err
+	routingKey := &pgtype.Text{
+		String: j.RoutingKey,
+		Status: pgtype.Null,
+	}
+	if j.RoutingKey != "" {
+		routingKey.Status = pgtype.Present
+	}
+
+	return []interface{}{queue, priority, runAt, j.Type, args, routingKey, compression, compressed}, nil
 }
 
 type queryable interface {
@@ -283,6 +702,11 @@ var ErrAgain = errors.New("maximum number of LockJob attempts reached")
 // If a job is found, a session-level Postgres advisory lock is created for the
 // Job's ID. If no job is found, nil will be returned instead of an error.
 //
+// Jobs are locked in order of Priority, then RunAt, then ID. Because IDs are
+// assigned from a sequence, jobs with the same Priority and RunAt are locked
+// in the order they were enqueued. With several workers, jobs may still finish
+// out of that order.
+//
 // Because Que uses session-level advisory locks, we have to hold the
 // same connection throughout the process of getting a job, working it,
 // deleting it, and removing the lock.
@@ -290,29 +714,122 @@ var ErrAgain = errors.New("maximum number of LockJob attempts reached")
 // After the Job has been worked, you must call either Done() or Error() on it
 // in order to return the database connection to the pool and remove the lock.
 func (c *Client) LockJob(queue string) (*Job, error) {
-	conn, err := c.pool.Acquire(context.Background())
-	if err != nil {
-		return nil, err
+	return c.lockJob(queue, lockOptions{})
+}
+
+// lockOptions narrows down the jobs that lockJob may lock.
+type lockOptions struct {
+	// exclude holds the IDs of jobs that must not be locked.
+	exclude []int64
+
+	// pollBatchSize is the maximum number of candidate jobs to try to lock. A
+	// value of zero or less means no limit.
+	pollBatchSize int
+
+	// If partitions is greater than one, only jobs whose ID modulo partitions
+	// equals partition are locked.
+	partitions int
+	partition  int
+
+	// If routingShards is greater than one, only jobs whose routing key hashes
+	// to routingShard are locked.
+	routingShards int
+	routingShard  int
+
+	// filter, if not nil, is ANDed into the lock query.
+	filter *LockFilter
+
+	// If tenant is not nil, the job is taken from the tenant that follows
+	// lastTenant among those with ready jobs, wrapping around.
+	tenant     *TenantKey
+	lastTenant string
+
+	// next, if not nil, is set to how long until the next job becomes ready
+	// if no job was locked, or to zero if there is none.
+	next *time.Duration
+
+	// conn, if not nil, is used to lock the job instead of a connection from
+	// the pool, and is not released with the job.
+	conn *pgxpool.Conn
+}
+
+// lockJob is like LockJob, but only locks the jobs allowed by opts.
+func (c *Client) lockJob(queue string, opts lockOptions) (*Job, error) {
+	conn := opts.conn
+	if conn == nil {
+		var err error
+		if conn, err = c.pool.Acquire(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	j := Job{pool: c.pool, conn: conn, schema: c.schema, client: c, keepConn: opts.conn != nil}
+	var err error
+
+	sql := c.stmt("que_lock_job")
+	args := []interface{}{queue, opts.exclude, opts.pollBatchSize,
+		opts.partitions, opts.partition, opts.routingShards, opts.routingShard, c.LockKeyspace}
+	if opts.filter != nil {
+		sql = opts.filter.lockSQL(c.schema)
+		args = append(args, opts.filter.args...)
+	}
+	if opts.tenant != nil {
+		sql = opts.tenant.fairLockSQL(c.schema, opts.filter)
+		args = append(args, opts.tenant.args...)
+		args = append(args, opts.lastTenant)
+	}
+
+	if opts.next != nil {
+		*opts.next = 0
 	}
-	j := Job{pool: c.pool, conn: conn}
 
 	for i := 0; i < maxLockJobAttempts; i++ {
 
-		err = conn.QueryRow(context.Background(), "que_lock_job", queue).Scan(
+		var (
+			id          pgtype.Int8
+			stored      []byte
+			compression pgtype.Text
+			lockedAt    time.Time
+			nextRunAt   pgtype.Timestamptz
+		)
+		dest := []interface{}{
 			&j.Queue,
 			&j.Priority,
 			&j.RunAt,
-			&j.ID,
+			&id,
 			&j.Type,
-			&j.Args,
+			&stored,
+			&compression,
 			&j.ErrorCount,
 			&j.LastError,
-		)
+			&j.RoutingKey,
+			&lockedAt,
+			&nextRunAt,
+		}
+		if opts.tenant != nil {
+			dest = append(dest, &j.tenant)
+		}
+		err = withHealing(context.Background(), conn.Conn(), c.schema, "lock", func() error {
+			return conn.QueryRow(context.Background(), sql, args...).Scan(dest...)
+		})
+		if err == nil && id.Status != pgtype.Present {
+			// no job was locked, but one will be ready at nextRunAt
+			if opts.next != nil {
+				*opts.next = nextRunAt.Time.Sub(lockedAt)
+			}
+			err = pgx.ErrNoRows
+		}
+		if err == nil {
+			j.setStoredArgs(stored, compression.String)
+		}
+		if err == nil && j.argsErr == nil && isNullArgs(j.Args) {
+			j.Args, j.argsNull = c.nullArgs(), true
+		}
+		j.ID = id.Int
 		// set the last error
 		// j.LastError.Set(lastError)
 
 		if err != nil {
-			j.conn.Release()
+			j.releaseConn()
 			if err == pgx.ErrNoRows {
 				return nil, nil
 			}
@@ -331,8 +848,11 @@ func (c *Client) LockJob(queue string) (*Job, error) {
 		// I'm not sure how to reliably commit a transaction that deletes
 		// the job in a separate thread between lock_job and check_job.
 		var ok bool
-		err = conn.QueryRow(context.Background(), "que_check_job", j.Queue, j.Priority, j.RunAt, j.ID).Scan(&ok)
+		err = withHealing(context.Background(), conn.Conn(), c.schema, "lock", func() error {
+			return conn.QueryRow(context.Background(), c.stmt("que_check_job"), j.Queue, j.Priority, j.RunAt, j.ID).Scan(&ok)
+		})
 		if err == nil {
+			j.pickupDelay = pickupDelay(j.RunAt, lockedAt)
 			return &j, nil
 		} else if err == pgx.ErrNoRows {
 			// Encountered job race condition; start over from the beginning.
@@ -341,31 +861,70 @@ func (c *Client) LockJob(queue string) (*Job, error) {
 			// eventually causing the server to run out of locks.
 			//
 			// Also swallow the possible error, exactly like in Done.
-			_ = conn.QueryRow(context.Background(), "que_unlock_job", j.ID).Scan(&ok)
+			_ = conn.QueryRow(context.Background(), c.stmt("que_unlock_job"), j.ID, c.LockKeyspace).Scan(&ok)
 			continue
 		} else {
-			j.conn.Release()
+			j.releaseConn()
 			return nil, err
 		}
 	}
-	j.conn.Release()
+	j.releaseConn()
 	return nil, ErrAgain
 }
 
 var preparedStatements = map[string]string{
-	"que_check_job":   sqlCheckJob,
-	"que_destroy_job": sqlDeleteJob,
-	"que_insert_job":  sqlInsertJob,
-	"que_update_job":  sqlUpdateJob,
-	"que_lock_job":    sqlLockJob,
-	"que_set_error":   sqlSetError,
-	"que_unlock_job":  sqlUnlockJob,
+	"que_ack_jobs":                 sqlAckJobs,
+	"que_advance_job":              sqlAdvanceJob,
+	"que_cancel_requested":         sqlCancelRequested,
+	"que_check_job":                sqlCheckJob,
+	"que_checkpoint_job":           sqlCheckpointJob,
+	"que_clear_locked_at":          sqlClearLockedAt,
+	"que_dead_jobs":                sqlDeadJobs,
+	"que_dead_job_args":            sqlDeadJobArgs,
+	"que_replay_dead_job":          sqlReplayDeadJob,
+	"que_dead_letter_job":          sqlDeadLetterJob,
+	"que_fail_children":            sqlFailChildren,
+	"que_lock_parent":              sqlLockParent,
+	"que_parent_failed":            sqlParentFailed,
+	"que_release_children":         sqlReleaseChildren,
+	"que_delete_jobs":              sqlDeleteJobs,
+	"que_destroy_job":              sqlDeleteJob,
+	"que_insert_job":               sqlInsertJob,
+	"que_job_result":               sqlJobResult,
+	"que_lease_job":                sqlLeaseJob,
+	"que_purge_job_results":        sqlPurgeJobResults,
+	"que_set_job_result":           sqlSetJobResult,
+	"que_insert_job_after":         sqlInsertJobAfter,
+	"que_insert_jobs":              sqlInsertJobs,
+	"que_insert_jobs_notify":       sqlInsertJobsNotify,
+	"que_insert_job_notify":        sqlInsertJobNotify,
+	"que_insert_job_unique":        sqlInsertJobUnique,
+	"que_insert_job_unique_notify": sqlInsertJobUniqueNotify,
+	"que_update_job":               sqlUpdateJob,
+	"que_lock_job":                 sqlLockJob,
+	"que_ping":                     sqlPing,
+	"que_queue_paused":             sqlQueuePaused,
+	"que_request_cancel":           sqlRequestCancel,
+	"que_reap_stuck_jobs":          sqlReapStuckJobs,
+	"que_scheduler_lock":           sqlSchedulerLock,
+	"que_scheduler_unlock":         sqlSchedulerUnlock,
+	"que_set_error":                sqlSetError,
+	"que_set_errors":               sqlSetErrors,
+	"que_set_panic":                sqlSetPanic,
+	"que_set_queue_paused":         sqlSetQueuePaused,
+	"que_single_flight_lock":       sqlSingleFlightLock,
+	"que_single_flight_unlock":     sqlSingleFlightUnlock,
+	"que_unlock_job":               sqlUnlockJob,
 }
 
 // PrepareStatements prepares the required statements to run que on the provided
 // *pgx.Conn. Typically it is used as an AfterConnect func for a
 // *pgx.ConnPool. Every connection used by que must have the statements prepared
 // ahead of time.
+//
+// The statements of features whose columns or tables are missing from a
+// que_jobs table created by an older schema.sql are skipped, and those
+// features fail with ErrSchemaOutdated until schema.sql is re-run.
 func PrepareStatements(ctx context.Context, conn *pgx.Conn) error {
 	return PrepareStatementsWithPreparer(ctx, conn)
 }
@@ -381,10 +940,144 @@ type Preparer interface {
 // *pgx.ConnPool after it is created, or on a *pg.Tx. Every connection used by
 // que must have the statements prepared ahead of time.
 func PrepareStatementsWithPreparer(ctx context.Context, p Preparer) error {
-	for name, sql := range preparedStatements {
-		if _, err := p.Prepare(ctx, name, sql); err != nil {
-			return err
+	_, err := prepareStatements(ctx, p, "")
+	return err
+}
+
+// Ping checks that the Client can reach the database and that que's prepared
+// statements and the que_jobs table are usable, without touching any jobs. It
+// is cheap enough to back a readiness probe that runs every few seconds.
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, c.stmt("que_ping"))
+	return err
+}
+
+// Reprepare invalidates and re-prepares the statements que uses on every
+// connection in the Client's pool. Call it after a migration that alters
+// que_jobs on a live database, since statements prepared against the old
+// table definition fail until their connections are recycled.
+//
+// Each connection is taken out of the pool while its statements are
+// re-prepared, which briefly pauses queue operations that need it. Connections
+// that are in use, such as those holding a locked Job, are handled once they
+// are returned to the pool, so Reprepare blocks until every connection has been
+// re-prepared or ctx is done. The connections that are kept for as long as
+// their owner runs, those of listening WorkerPools, of Workers with AckBatched
+// or ErrorBatchWindow and of leading Schedulers, are instead re-prepared by
+// their owner before it next uses or releases them, and Reprepare doesn't
+// wait for them.
+func (c *Client) Reprepare(ctx context.Context) error {
+	c.columns.forget()
+	seen := make(map[*pgx.Conn]bool)
+	for {
+		for _, conn := range c.pool.AcquireAllIdle(ctx) {
+			var err error
+			if !seen[conn.Conn()] {
+				_, err = reprepareConn(ctx, conn.Conn(), c.schema)
+				seen[conn.Conn()] = true
+			}
+			conn.Release()
+			if err != nil {
+				return err
+			}
+		}
+		c.held.markStale(seen)
+		if len(seen) >= int(c.pool.Stat().TotalConns()) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			// wait for busy connections to be released
 		}
 	}
-	return nil
+}
+
+// heldConns tracks the connections that are kept out of the pool for as long
+// as their owner runs, so that Reprepare doesn't wait for them.
+type heldConns struct {
+	mu sync.Mutex
+	// stale holds whether each connection's statements must be re-prepared
+	stale map[*pgx.Conn]bool
+}
+
+// markStale marks the held connections that aren't in seen for re-preparing,
+// and adds them to seen.
+func (h *heldConns) markStale(seen map[*pgx.Conn]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn := range h.stale {
+		if !seen[conn] {
+			h.stale[conn] = true
+			seen[conn] = true
+		}
+	}
+}
+
+// hold records that conn is kept out of the pool until releaseHeld.
+func (c *Client) hold(conn *pgxpool.Conn) {
+	c.held.mu.Lock()
+	defer c.held.mu.Unlock()
+
+	if c.held.stale == nil {
+		c.held.stale = make(map[*pgx.Conn]bool)
+	}
+	c.held.stale[conn.Conn()] = false
+}
+
+// refresh re-prepares que's statements on conn, a held connection, if
+// Reprepare was called since they were prepared. Owners call it before using
+// conn.
+func (c *Client) refresh(ctx context.Context, conn *pgxpool.Conn) error {
+	c.held.mu.Lock()
+	stale := c.held.stale[conn.Conn()]
+	if stale {
+		c.held.stale[conn.Conn()] = false
+	}
+	c.held.mu.Unlock()
+
+	if !stale {
+		return nil
+	}
+	_, err := reprepareConn(ctx, conn.Conn(), c.schema)
+	return err
+}
+
+// releaseHeld refreshes conn, a held connection, and returns it to the pool.
+// A connection that can't be refreshed is closed instead.
+func (c *Client) releaseHeld(conn *pgxpool.Conn) {
+	if !conn.Conn().IsClosed() {
+		if err := c.refresh(context.Background(), conn); err != nil {
+			log.Printf("re-preparing statements of released connection: %v", err)
+			conn.Conn().Close(context.Background())
+		}
+	}
+
+	c.held.mu.Lock()
+	delete(c.held.stale, conn.Conn())
+	c.held.mu.Unlock()
+	conn.Release()
+}
+
+func reprepareConn(ctx context.Context, conn *pgx.Conn, schema string) (*outdatedError, error) {
+	if sc := conn.StatementCache(); sc != nil {
+		if err := sc.Clear(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for name := range preparedStatements {
+		// Swallow this error because the statement may not have been prepared
+		// on this connection yet.
+		_ = conn.Deallocate(ctx, stmtName(schema, name))
+	}
+	return prepareStatements(ctx, conn, schema)
 }
@@ -3,6 +3,7 @@ package que
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -21,7 +22,7 @@ func openTestClientMaxConns(t testing.TB, maxConnections int32) *Client {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err := pool.Exec(context.Background(), "TRUNCATE TABLE que_jobs"); err != nil {
+	if _, err := pool.Exec(context.Background(), "TRUNCATE TABLE que_jobs, que_dead_jobs, que_queue_state, que_job_results"); err != nil {
 		panic(err)
 	}
 
@@ -60,3 +61,117 @@ func findOneJob(q queryable) (*Job, error) {
 	}
 	return j, nil
 }
+
+func TestReprepare(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	// simulate an online migration of que_jobs
+	if _, err := c.pool.Exec(context.Background(), "ALTER TABLE que_jobs ALTER COLUMN last_error TYPE varchar"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := c.pool.Exec(context.Background(), "ALTER TABLE que_jobs ALTER COLUMN last_error TYPE text"); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := c.Reprepare(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	if err = j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReprepareWaitsForBusyConns(t *testing.T) {
+	c := openTestClientMaxConns(t, 2)
+	defer closePool(c.pool)
+
+	conn, err := c.pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Reprepare(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v while a conn is busy, got %v", context.DeadlineExceeded, err)
+	}
+
+	conn.Release()
+	if err := c.Reprepare(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReprepareSkipsHeldConns(t *testing.T) {
+	c := openTestClientMaxConns(t, 2)
+	defer closePool(c.pool)
+
+	wp := NewWorkerPool(c, WorkMap{}, 1)
+	wp.Listen = true
+	wp.Start()
+	defer wp.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.held.mu.Lock()
+		n := len(c.held.stale)
+		c.held.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the listener's connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Reprepare(ctx); err != nil {
+		t.Fatalf("want Reprepare to leave the listener's connection to it, got %v", err)
+	}
+	c.held.mu.Lock()
+	for _, stale := range c.held.stale {
+		if !stale {
+			t.Error("want the listener's connection marked for re-preparing")
+		}
+	}
+	c.held.mu.Unlock()
+}
+
+func TestPing(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPingWithoutPreparedStatements(t *testing.T) {
+	pool, err := pgxpool.Connect(context.Background(), testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closePool(pool)
+
+	if err := NewClient(pool).Ping(context.Background()); err == nil {
+		t.Error("want error when statements are not prepared")
+	}
+}
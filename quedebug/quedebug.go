@@ -0,0 +1,133 @@
+// Package quedebug provides an http.Handler that renders the live state of a
+// que WorkerPool and its queues, in the spirit of net/http/pprof. Mount it on
+// a private debug server:
+//
+//	mux.Handle("/debug/que", quedebug.Handler(qc, workers))
+//
+// Add ?format=json to the URL to get the same data as JSON.
+package quedebug
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gadelkareem/que"
+)
+
+// state is what the handler renders.
+type state struct {
+	Now          time.Time
+	Pool         *que.PoolState   `json:",omitempty"`
+	RecentErrors []jobError       `json:",omitempty"`
+	Queues       []que.QueueStats `json:",omitempty"`
+	QueueError   string           `json:",omitempty"`
+	Conns        *que.PoolStats   `json:",omitempty"`
+}
+
+// jobError is a failed job with its error as a string, which encodes to JSON.
+type jobError struct {
+	que.JobStats
+	Err string
+}
+
+// Handler returns an http.Handler that renders the state of pool, and the
+// contents of the queues and the connection pool of c. Either may be nil to
+// leave it out.
+func Handler(c *que.Client, pool *que.WorkerPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := state{Now: time.Now()}
+		if pool != nil {
+			ps := pool.Inspect()
+			for _, js := range ps.RecentErrors {
+				s.RecentErrors = append(s.RecentErrors, jobError{js, js.Err.Error()})
+			}
+			ps.RecentErrors = nil
+			s.Pool = &ps
+		}
+		if c != nil {
+			queues, err := c.QueueStats()
+			if err != nil {
+				s.QueueError = err.Error()
+			}
+			s.Queues = queues
+			ps := c.PoolStats()
+			s.Conns = &ps
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(s)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := page.Execute(w, s); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+var page = template.Must(template.New("que").Funcs(template.FuncMap{
+	"since": func(now, t time.Time) time.Duration {
+		return now.Sub(t).Round(time.Millisecond)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>que</title></head>
+<body>
+<h1>que</h1>
+<p>{{.Now.Format "2006-01-02 15:04:05 MST"}}</p>
+{{with .Pool}}
+<h2>Configuration</h2>
+<table>
+<tr><td>Queue</td><td>{{printf "%q" .Queue}}</td></tr>
+<tr><td>Interval</td><td>{{.Interval}}</td></tr>
+<tr><td>PollBatchSize</td><td>{{.PollBatchSize}}</td></tr>
+<tr><td>MaxPanics</td><td>{{.MaxPanics}}</td></tr>
+<tr><td>Affinity</td><td>{{.Affinity}}</td></tr>
+<tr><td>Listen</td><td>{{.Listen}}</td></tr>
+</table>
+<h2>Workers</h2>
+<table>
+<tr><th>#</th><th>Queue</th><th>Partition</th><th>Job</th><th>Type</th><th>Running for</th></tr>
+{{range $i, $w := .Workers}}<tr><td>{{$i}}</td><td>{{printf "%q" $w.Queue}}</td><td>{{$w.Partition}}</td>{{if $w.Busy}}<td>{{$w.JobID}}</td><td>{{$w.JobType}}</td><td>{{since $.Now $w.JobStartedAt}}</td>{{else}}<td colspan="3">idle</td>{{end}}</tr>
+{{else}}<tr><td colspan="6">not started</td></tr>
+{{end}}</table>
+<h2>Metrics since {{.Metrics.Since.Format "15:04:05"}}</h2>
+<table>
+<tr><th>Type</th><th>Succeeded</th><th>Failed</th><th>Duplicates</th><th>Success rate</th></tr>
+{{range $typ, $m := .Metrics.Types}}<tr><td>{{$typ}}</td><td>{{$m.Succeeded}}</td><td>{{$m.Failed}}</td><td>{{$m.Duplicates}}</td><td>{{printf "%.3f" $m.SuccessRate}}</td></tr>
+{{end}}</table>
+<h2>Recent errors</h2>
+<table>
+<tr><th>Job</th><th>Queue</th><th>Type</th><th>Duration</th><th>Error</th></tr>
+{{range $.RecentErrors}}<tr><td>{{.ID}}</td><td>{{printf "%q" .Queue}}</td><td>{{.Type}}</td><td>{{.Duration}}</td><td>{{.Err}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Queues</h2>
+{{with .QueueError}}<p>error: {{.}}</p>{{end}}
+<table>
+<tr><th>Queue</th><th>Type</th><th>Count</th><th>Working</th><th>Errored</th><th>Highest error count</th><th>Oldest run_at</th></tr>
+{{range .Queues}}<tr><td>{{printf "%q" .Queue}}</td><td>{{.Type}}</td><td>{{.Count}}</td><td>{{.Working}}</td><td>{{.Errored}}</td><td>{{.HighestErrorCount}}</td><td>{{.OldestRunAt.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+{{with .Conns}}
+<h2>Connections</h2>
+<table>
+<tr><td>Max</td><td>{{.MaxConns}}</td></tr>
+<tr><td>Total</td><td>{{.TotalConns}}</td></tr>
+<tr><td>Acquired</td><td>{{.AcquiredConns}}</td></tr>
+<tr><td>Idle</td><td>{{.IdleConns}}</td></tr>
+<tr><td>Constructing</td><td>{{.ConstructingConns}}</td></tr>
+<tr><td>Acquires</td><td>{{.AcquireCount}}</td></tr>
+<tr><td>Acquires that waited</td><td>{{.EmptyAcquireCount}}</td></tr>
+<tr><td>Acquires canceled</td><td>{{.CanceledAcquireCount}}</td></tr>
+<tr><td>Time acquiring</td><td>{{.AcquireDuration}}</td></tr>
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,48 @@
+package quedebug
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gadelkareem/que"
+)
+
+func TestHandlerHTML(t *testing.T) {
+	pool := que.NewWorkerPool(nil, que.WorkMap{}, 2)
+	pool.Queue = "emails"
+
+	rec := httptest.NewRecorder()
+	Handler(nil, pool).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/que", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("want status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`&#34;emails&#34;`, "not started", "<h2>Queues</h2>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want body to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandlerJSON(t *testing.T) {
+	pool := que.NewWorkerPool(nil, que.WorkMap{}, 2)
+	pool.Queue = "emails"
+
+	rec := httptest.NewRecorder()
+	Handler(nil, pool).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/que?format=json", nil))
+
+	var s struct {
+		Pool struct {
+			Queue string
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Pool.Queue != "emails" {
+		t.Errorf("want Queue=emails, got %q", s.Pool.Queue)
+	}
+}
@@ -0,0 +1,58 @@
+// Package quetest provides helpers for tests of code that uses que.
+package quetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gadelkareem/que"
+)
+
+// AssertEmpty fails t if any Job is left in queue, listing the Jobs that are,
+// to catch tests that enqueue Jobs without working them.
+func AssertEmpty(t testing.TB, c *que.Client, queue string) {
+	t.Helper()
+
+	jobs, err := c.ListJobs(que.JobFilter{Queue: queue, IncludeArgs: true})
+	if err != nil {
+		t.Fatalf("quetest: listing jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "quetest: want queue %q empty, got %d jobs:", queue, len(jobs))
+	now := time.Now()
+	for _, j := range jobs {
+		fmt.Fprintf(&b, "\n  job %d: type=%s args=%s state=%s", j.ID, j.Type, j.Args, state(j, now))
+		if j.LastError.String != "" {
+			fmt.Fprintf(&b, " last_error=%q", j.LastError.String)
+		}
+	}
+	t.Error(b.String())
+}
+
+// state describes where j is in its lifecycle.
+func state(j *que.Job, now time.Time) string {
+	switch {
+	case j.ErrorCount > 0:
+		return fmt.Sprintf("retrying (%d errors)", j.ErrorCount)
+	case j.RunAt.After(now):
+		return "scheduled for " + j.RunAt.Format(time.RFC3339)
+	default:
+		return "ready"
+	}
+}
+
+// Truncate deletes all of the Jobs in all queues, to start a test from a clean
+// slate.
+func Truncate(t testing.TB, c *que.Client) {
+	t.Helper()
+
+	if _, err := c.DeleteJobs(que.JobFilter{AllQueues: true}); err != nil {
+		t.Fatalf("quetest: deleting jobs: %v", err)
+	}
+}
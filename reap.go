@@ -0,0 +1,57 @@
+package que
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ReapStuck makes jobs that have been locked by a Go worker for longer than
+// maxRuntime available to be worked again, and returns how many it reaped.
+// It is a backstop for handlers that wedge without respecting cancellation,
+// such as a goroutine deadlock: run it periodically from one process with a
+// maxRuntime comfortably above the longest legitimate job.
+//
+// Because the advisory lock on a job lasts as long as the session that took
+// it, the only way to release it is to end that session. ReapStuck terminates
+// the backend of every connection holding the lock on a stuck job, which
+// requires the database role to be allowed to signal those backends. Any other
+// job locked on the same connection is released as well.
+//
+// If the original worker is still making progress rather than wedged, the job
+// runs twice: once on the reaped worker, which fails when it next uses its
+// connection, and again on whichever worker locks it next. The job's row is
+// never modified by ReapStuck, so it is not rescheduled or marked as failed.
+//
+// Only jobs locked by Go workers are considered, since Ruby workers don't
+// record when they locked a job.
+func (c *Client) ReapStuck(maxRuntime time.Duration) (int, error) {
+	rows, err := c.pool.Query(context.Background(), c.stmt("que_reap_stuck_jobs"), maxRuntime.Microseconds(), c.LockKeyspace)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	reaped := 0
+	for rows.Next() {
+		var (
+			id         int64
+			terminated bool
+		)
+		if err := rows.Scan(&id, &terminated); err != nil {
+			return reaped, err
+		}
+		if terminated {
+			log.Printf("event=job_reaped job_id=%d", id)
+			reaped++
+		}
+	}
+	return reaped, rows.Err()
+}
+
+// clearLockedAt records that this job is no longer locked, for a job that is
+// about to be unlocked without being deleted or updated.
+func (j *Job) clearLockedAt() error {
+	_, err := j.conn.Exec(context.Background(), j.stmt("que_clear_locked_at"), j.Queue, j.Priority, j.RunAt, j.ID)
+	return err
+}
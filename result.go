@@ -0,0 +1,97 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrNoResult is returned by GetResult if no result was stored for the Job,
+// because it hasn't finished yet, didn't call SetResult, or its result was
+// purged.
+var ErrNoResult = errors.New("que: no result for job")
+
+// SetResult stores v, encoded as JSON, as the result of this job, to be
+// fetched with Client.GetResult by whoever enqueued it. This turns a Job into
+// a lightweight asynchronous call: enqueue it, then poll GetResult with its ID.
+// WorkFuncs should call it right before returning nil. Calling it again
+// replaces the result.
+//
+// The result is stored in the que_job_results table rather than on the job,
+// so the job is deleted once worked as usual, and only its result outlives it.
+// Results are kept until they are purged with PurgeResults or SweepResults, so
+// something must purge them, or que_job_results grows forever. With
+// AckOnCommit, the result is stored in the Job's transaction and is discarded
+// if the Job fails; otherwise it is stored right away and is kept even if the
+// WorkFunc then fails, until the Job is retried and sets it again.
+func (j *Job) SetResult(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ctx := context.Background()
+	if j.tx != nil {
+		_, err = j.tx.Exec(ctx, j.stmt("que_set_job_result"), j.ID, j.Type, b)
+		return err
+	}
+	if j.conn == nil {
+		return ErrNoConn
+	}
+	_, err = j.conn.Exec(ctx, j.stmt("que_set_job_result"), j.ID, j.Type, b)
+	return err
+}
+
+// GetResult returns the JSON result stored by the Job with the given id with
+// SetResult. It returns ErrNoResult if there is none (yet).
+func (c *Client) GetResult(id int64) ([]byte, error) {
+	var result []byte
+	err := c.pool.QueryRow(context.Background(), c.stmt("que_job_result"), id).Scan(&result)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNoResult
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PurgeResults deletes the results stored more than retention ago, and returns
+// how many it deleted. The retention must leave the enqueueing side enough
+// time to fetch the results it is waiting for.
+func (c *Client) PurgeResults(retention time.Duration) (int64, error) {
+	tag, err := c.pool.Exec(context.Background(), c.stmt("que_purge_job_results"), retention.Microseconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SweepResults calls PurgeResults with retention every interval until ctx is
+// done, so it should be run in its own goroutine. Running it in one process is
+// enough, but running it in several is harmless.
+func (c *Client) SweepResults(ctx context.Context, retention, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		n, err := c.PurgeResults(retention)
+		if err != nil {
+			log.Printf("purging job results: %v", err)
+		} else if n > 0 {
+			log.Printf("event=job_results_purged count=%d", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package que
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobResult(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "Add", Args: []byte(`[2,3]`)}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	id := j.ID
+	if _, err := c.GetResult(id); err != ErrNoResult {
+		t.Fatalf("want ErrNoResult before the job is worked, got %v", err)
+	}
+
+	w := NewWorker(c, WorkMap{"Add": func(j *Job) error {
+		var args []int
+		if err := json.Unmarshal(j.Args, &args); err != nil {
+			return err
+		}
+		return j.SetResult(map[string]int{"sum": args[0] + args[1]})
+	}})
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	if j, err := findOneJob(c.pool); err != nil || j != nil {
+		t.Fatalf("want job deleted, got %+v, %v", j, err)
+	}
+	b, err := c.GetResult(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct{ Sum int }
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Sum != 5 {
+		t.Errorf("want sum 5, got %d", result.Sum)
+	}
+}
+
+func TestJobResultAckOnCommitFailed(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	j := &Job{Type: "Fails"}
+	if err := c.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(c, WorkMap{"Fails": func(j *Job) error {
+		if err := j.SetResult("partial"); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	}})
+	w.Ack = AckOnCommit
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	if _, err := c.GetResult(j.ID); err != ErrNoResult {
+		t.Errorf("want the result of a failed job discarded, got %v", err)
+	}
+}
+
+func TestPurgeResults(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	ctx := context.Background()
+	for id, age := range map[int64]string{1: "2 days", 2: "1 minute"} {
+		_, err := c.pool.Exec(ctx, "INSERT INTO que_job_results (job_id, job_class, result, finished_at) VALUES ($1, 'MyJob', '{}', now() - $2::interval)", id, age)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := c.PurgeResults(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 result purged, got %d", n)
+	}
+	if _, err := c.GetResult(1); err != ErrNoResult {
+		t.Errorf("want old result purged, got %v", err)
+	}
+	if _, err := c.GetResult(2); err != nil {
+		t.Errorf("want recent result kept, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package que
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy returns how long to wait before retrying a Job that has failed
+// errorCount times, counting the failure being handled.
+type RetryPolicy func(errorCount int32) time.Duration
+
+// RubyQueBackoff is the default RetryPolicy, which waits errorCount^4 + 3
+// seconds like the Ruby que library.
+func RubyQueBackoff(errorCount int32) time.Duration {
+	return time.Duration(intPow(int(errorCount), 4)+3) * time.Second
+}
+
+// ConstantBackoff returns a RetryPolicy that always waits d.
+func ConstantBackoff(d time.Duration) RetryPolicy {
+	return func(int32) time.Duration {
+		return d
+	}
+}
+
+// FullJitterBackoff returns a RetryPolicy that waits a random duration between
+// zero and min(max, base * 2^errorCount), the "full jitter" strategy, which
+// spreads out the retries of Jobs that failed at the same time.
+func FullJitterBackoff(base, max time.Duration) RetryPolicy {
+	return func(errorCount int32) time.Duration {
+		ceil := base
+		for i := int32(0); i < errorCount && ceil < max; i++ {
+			ceil *= 2
+		}
+		if ceil > max {
+			ceil = max
+		}
+		if ceil <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(ceil) + 1))
+	}
+}
+
+// retryDelay returns the delay before retrying the job after its errorCount'th
+// failure.
+func (j *Job) retryDelay(errorCount int32) time.Duration {
+	if j.retryPolicy == nil {
+		return RubyQueBackoff(errorCount)
+	}
+	return j.retryPolicy(errorCount)
+}
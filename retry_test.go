@@ -0,0 +1,103 @@
+package que
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRubyQueBackoff(t *testing.T) {
+	for errorCount, want := range map[int32]time.Duration{
+		1: 4 * time.Second,
+		2: 19 * time.Second,
+		3: 84 * time.Second,
+	} {
+		if got := RubyQueBackoff(errorCount); got != want {
+			t.Errorf("errorCount=%d: want %v, got %v", errorCount, want, got)
+		}
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	p := ConstantBackoff(time.Minute)
+	for _, errorCount := range []int32{1, 2, 10} {
+		if got := p(errorCount); got != time.Minute {
+			t.Errorf("errorCount=%d: want %v, got %v", errorCount, time.Minute, got)
+		}
+	}
+}
+
+func TestFullJitterBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, 5*time.Second
+	p := FullJitterBackoff(base, max)
+
+	for errorCount := int32(0); errorCount < 100; errorCount++ {
+		ceil := max
+		if errorCount < 6 {
+			ceil = base << uint(errorCount)
+		}
+		var maxSeen time.Duration
+		for i := 0; i < 200; i++ {
+			d := p(errorCount)
+			if d < 0 || d > ceil {
+				t.Fatalf("errorCount=%d: want delay in [0, %v], got %v", errorCount, ceil, d)
+			}
+			if d > maxSeen {
+				maxSeen = d
+			}
+		}
+		// the delays are spread over the whole range
+		if maxSeen < ceil/2 {
+			t.Errorf("errorCount=%d: want delays up to %v, got at most %v", errorCount, ceil, maxSeen)
+		}
+	}
+
+	if got := FullJitterBackoff(0, time.Second)(3); got != 0 {
+		t.Errorf("want 0 delay for zero base, got %v", got)
+	}
+}
+
+func TestWorkerRetryCooldown(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "FailFast", Priority: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&Job{Type: "Ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed, succeeded int
+	w := NewWorker(c, WorkMap{
+		"FailFast": func(j *Job) error {
+			failed++
+			return errors.New("bad config")
+		},
+		"Ok": func(j *Job) error {
+			succeeded++
+			return nil
+		},
+	})
+	w.RetryPolicy = ConstantBackoff(0)
+	w.RetryCooldown = time.Minute
+
+	for i := 0; i < 2; i++ {
+		if !w.WorkOne() {
+			t.Fatalf("want job worked on attempt %d", i)
+		}
+	}
+	if failed != 1 || succeeded != 1 {
+		t.Errorf("want failed=1 succeeded=1, got failed=%d succeeded=%d", failed, succeeded)
+	}
+
+	// the failed job is ready again, but still cooling down
+	if w.WorkOne() {
+		t.Error("want failed job not locked during its cooldown")
+	}
+
+	w.skipped = make(map[int64]time.Time)
+	if !w.WorkOne() || failed != 2 {
+		t.Errorf("want failed job retried after its cooldown, got failed=%d", failed)
+	}
+}
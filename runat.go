@@ -0,0 +1,44 @@
+package que
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunAtError is returned when enqueueing a Job whose RunAt is further in the
+// future than the Client's MaxFutureRunAt, or further in the past than its
+// MaxPastRunAt. The Job is not enqueued.
+type RunAtError struct {
+	RunAt time.Time
+
+	// Past is true if RunAt is too far in the past, and false if it is too
+	// far in the future.
+	Past bool
+
+	// Max is the MaxPastRunAt or MaxFutureRunAt that RunAt exceeds.
+	Max time.Duration
+}
+
+func (e *RunAtError) Error() string {
+	if e.Past {
+		return fmt.Sprintf("que: job run_at %s is more than %s in the past", e.RunAt.Format(time.RFC3339), e.Max)
+	}
+	return fmt.Sprintf("que: job run_at %s is more than %s in the future", e.RunAt.Format(time.RFC3339), e.Max)
+}
+
+// checkRunAt returns a *RunAtError if the RunAt of j is outside of the
+// Client's bounds. A zero RunAt means now, which is always allowed. The bounds
+// are checked against the local clock.
+func (c *Client) checkRunAt(j *Job) error {
+	if j.RunAt.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	if c.MaxFutureRunAt > 0 && j.RunAt.After(now.Add(c.MaxFutureRunAt)) {
+		return &RunAtError{RunAt: j.RunAt, Max: c.MaxFutureRunAt}
+	}
+	if c.MaxPastRunAt > 0 && j.RunAt.Before(now.Add(-c.MaxPastRunAt)) {
+		return &RunAtError{RunAt: j.RunAt, Past: true, Max: c.MaxPastRunAt}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckRunAt(t *testing.T) {
+	c := &Client{MaxFutureRunAt: time.Hour, MaxPastRunAt: time.Minute}
+	now := time.Now()
+
+	for _, runAt := range []time.Time{{}, now, now.Add(59 * time.Minute), now.Add(-59 * time.Second)} {
+		if err := c.checkRunAt(&Job{RunAt: runAt}); err != nil {
+			t.Errorf("want run_at %s allowed, got %v", runAt, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		runAt time.Time
+		past  bool
+		max   time.Duration
+	}{
+		{now.Add(61 * time.Minute), false, time.Hour},
+		{time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), false, time.Hour},
+		{now.Add(-61 * time.Second), true, time.Minute},
+	} {
+		err := c.checkRunAt(&Job{RunAt: tc.runAt})
+		var rerr *RunAtError
+		if !errors.As(err, &rerr) {
+			t.Errorf("want *RunAtError for run_at %s, got %v", tc.runAt, err)
+			continue
+		}
+		if rerr.Past != tc.past || rerr.Max != tc.max || !rerr.RunAt.Equal(tc.runAt) {
+			t.Errorf("want past=%v max=%s, got %+v", tc.past, tc.max, rerr)
+		}
+	}
+
+	unbounded := &Client{}
+	if err := unbounded.checkRunAt(&Job{RunAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Errorf("want any run_at allowed by default, got %v", err)
+	}
+}
+
+func TestEnqueueMaxFutureRunAt(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	c.MaxFutureRunAt = time.Hour
+	c.MaxPastRunAt = time.Hour
+
+	if err := c.Enqueue(&Job{Type: "MyJob", RunAt: time.Now().Add(59 * time.Minute)}); err != nil {
+		t.Fatalf("want job just inside the horizon enqueued, got %v", err)
+	}
+
+	var rerr *RunAtError
+	err := c.Enqueue(&Job{Type: "MyJob", RunAt: time.Now().Add(61 * time.Minute)})
+	if !errors.As(err, &rerr) || rerr.Past {
+		t.Errorf("want *RunAtError for the future, got %v", err)
+	}
+	err = c.EnqueueBatch([]*Job{{Type: "MyJob"}, {Type: "MyJob", RunAt: time.Now().Add(-61 * time.Minute)}})
+	if !errors.As(err, &rerr) || !rerr.Past {
+		t.Errorf("want *RunAtError for the past, got %v", err)
+	}
+
+	var count int
+	if err := c.pool.QueryRow(context.Background(), "SELECT count(*) FROM que_jobs").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("want only the job inside the horizon enqueued, got %d jobs", count)
+	}
+}
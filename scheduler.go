@@ -0,0 +1,201 @@
+package que
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Scheduler enqueues a Job at every tick of a fixed schedule, such as every
+// hour on the hour, exactly once across all the processes running a Scheduler
+// with the same Name. It is meant for periodic maintenance: run a Scheduler in
+// every process, and a single Job is enqueued per tick, to be worked by a
+// single Worker like any other Job.
+//
+// Two mechanisms prevent duplicate Jobs. First, the Schedulers elect a leader
+// with a PostgreSQL advisory lock held on a dedicated connection, and only the
+// leader enqueues. If the leader's process dies its connection is closed, the
+// lock is released, and another Scheduler takes over at its next Interval.
+// Second, the leader enqueues the Job of the next tick ahead of time with
+// EnqueueUnique, using the Name and the tick as UniqueKey, so a new leader
+// taking over while the Job is pending doesn't enqueue it again. Ticks are
+// computed from the database clock, and only ticks in the future are ever
+// enqueued, so a Job whose tick has passed and that has already been worked
+// isn't enqueued again at the tick boundary either, regardless of clock skew
+// between processes.
+type Scheduler struct {
+	// Name identifies the schedule. Schedulers with the same Name share a
+	// leader and their Jobs.
+	Name string
+
+	// Every is the period of the schedule. Ticks are the multiples of Every
+	// since the zero time, in UTC, so an Every of an hour ticks on the hour.
+	Every time.Duration
+
+	// NewJob returns the Job to enqueue for tick. Its RunAt and UniqueKey are
+	// overwritten.
+	NewJob func(tick time.Time) *Job
+
+	// Interval is how often the Scheduler tries to become the leader, and the
+	// leader checks that the next Job is enqueued. It should be well below
+	// Every.
+	Interval time.Duration
+
+	c *Client
+}
+
+// NewScheduler returns a Scheduler that enqueues the Job returned by newJob
+// with the Client every period of every. Its Interval defaults to that of a
+// Worker.
+func NewScheduler(c *Client, name string, every time.Duration, newJob func(tick time.Time) *Job) *Scheduler {
+	return &Scheduler{
+		Name:     name,
+		Every:    every,
+		NewJob:   newJob,
+		Interval: defaultWakeInterval,
+		c:        c,
+	}
+}
+
+// Run runs the Scheduler until ctx is done, so it should be run in its own
+// goroutine. While it is the leader, it holds one connection from the pool.
+func (s *Scheduler) Run(ctx context.Context) {
+	var (
+		conn   *pgxpool.Conn
+		leader bool
+		err    error
+	)
+	defer func() {
+		if conn != nil {
+			s.release(conn, leader)
+		}
+	}()
+
+	for {
+		if conn == nil {
+			conn, err = s.c.pool.Acquire(ctx)
+			if err != nil {
+				conn = nil
+				if ctx.Err() == nil {
+					log.Printf("scheduler %s: acquiring connection: %v", s.Name, err)
+				}
+			} else {
+				s.c.hold(conn)
+			}
+		}
+
+		if conn != nil {
+			var now time.Time
+			err = s.c.refresh(ctx, conn)
+			if err == nil {
+				err = conn.QueryRow(ctx, s.c.stmt("que_scheduler_lock"), s.Name, leader).Scan(&leader, &now)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("scheduler %s: electing leader: %v", s.Name, err)
+				}
+				// the lock, if held, goes away with the connection
+				conn.Conn().Close(context.Background())
+				s.c.releaseHeld(conn)
+				conn, leader = nil, false
+			} else if leader {
+				if err := s.enqueueNext(now); err != nil {
+					log.Printf("scheduler %s: enqueueing job: %v", s.Name, err)
+				}
+			} else {
+				// only the leader keeps its connection
+				s.c.releaseHeld(conn)
+				conn = nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.Interval):
+		}
+	}
+}
+
+// enqueueNext enqueues the Job of the first tick after now, unless it is
+// already enqueued.
+func (s *Scheduler) enqueueNext(now time.Time) error {
+	tick := now.UTC().Truncate(s.Every).Add(s.Every)
+
+	j := s.NewJob(tick)
+	j.RunAt = tick
+	j.UniqueKey = fmt.Sprintf("%s@%s", s.Name, tick.Format(time.RFC3339Nano))
+	inserted, err := s.c.EnqueueUnique(j)
+	if err != nil {
+		return err
+	}
+	if inserted {
+		log.Printf("event=job_scheduled job_id=%d job_type=%s run_at=%s", j.ID, j.Type, tick.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// release returns conn to the pool, giving up the leader lock first if held.
+func (s *Scheduler) release(conn *pgxpool.Conn, leader bool) {
+	if leader {
+		var ok bool
+		err := conn.QueryRow(context.Background(), s.c.stmt("que_scheduler_unlock"), s.Name).Scan(&ok)
+		if err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}
+	s.c.releaseHeld(conn)
+}
+
+// RescheduleAligned reschedules this job, typically a recurring job that
+// reschedules itself each time it runs, to the first tick after now of the
+// schedule that starts at its RunAt and repeats every interval. Because the
+// next run is computed from the scheduled time rather than from when the job
+// ran or finished, the schedule doesn't drift: a job that first runs on the
+// hour keeps running on the hour. If the job ran so late that ticks were
+// missed, it is not run once for each of them: it skips to the next tick in
+// the future.
+//
+// An interval that is a whole number of days keeps the wall-clock time of
+// RunAt in its Location across daylight saving time transitions, so a daily
+// job at 09:00 stays at 09:00 local time. Other intervals are exact
+// durations.
+//
+// RescheduleAligned panics if interval is not positive.
+func (j *Job) RescheduleAligned(interval time.Duration) {
+	j.Reschedule(nextAligned(j.RunAt, time.Now(), interval))
+}
+
+// nextAligned returns the first time after both anchor and now that is a whole
+// number of intervals after anchor.
+func nextAligned(anchor, now time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		panic("que: RescheduleAligned: interval must be positive")
+	}
+
+	// the number of intervals to add, starting from an estimate
+	k := int64(1)
+	if now.After(anchor) {
+		k = int64(now.Sub(anchor)/interval) + 1
+	}
+
+	const day = 24 * time.Hour
+	tick := func(k int64) time.Time {
+		if interval%day == 0 {
+			return anchor.AddDate(0, 0, int(k*int64(interval/day)))
+		}
+		return anchor.Add(time.Duration(k) * interval)
+	}
+
+	// the estimate can be off by one where days are not 24 hours long
+	for !tick(k).After(now) {
+		k++
+	}
+	for k > 1 && tick(k-1).After(now) {
+		k--
+	}
+	return tick(k)
+}
@@ -0,0 +1,131 @@
+package que
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerEnqueuesOncePerTick(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	newJob := func(tick time.Time) *Job {
+		return &Job{Type: "Cleanup"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		s := NewScheduler(c, "cleanup", time.Hour, newJob)
+		s.Interval = 10 * time.Millisecond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(ctx)
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	var leaders int
+	err := c.pool.QueryRow(context.Background(), `
+SELECT count(*) FROM pg_locks
+WHERE locktype = 'advisory' AND objsubid = 2 AND granted`).Scan(&leaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaders != 1 {
+		t.Errorf("want 1 leader, got %d", leaders)
+	}
+
+	cancel()
+	wg.Wait()
+
+	if n := countJobs(t, c.pool, "Cleanup"); n != 1 {
+		t.Fatalf("want 1 scheduled job, got %d", n)
+	}
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().UTC().Truncate(time.Hour).Add(time.Hour); !j.RunAt.Equal(want) {
+		t.Errorf("want RunAt=%v, got %v", want, j.RunAt)
+	}
+
+	// the leader lock was released
+	err = c.pool.QueryRow(context.Background(), `
+SELECT count(*) FROM pg_locks
+WHERE locktype = 'advisory' AND objsubid = 2`).Scan(&leaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaders != 0 {
+		t.Errorf("want no leader after shutdown, got %d", leaders)
+	}
+}
+
+func TestNextAligned(t *testing.T) {
+	anchor := time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		{"on time", anchor.Add(3 * time.Second), time.Hour, anchor.Add(time.Hour)},
+		{"slow job", anchor.Add(59 * time.Minute), time.Hour, anchor.Add(time.Hour)},
+		{"late by one tick", anchor.Add(time.Hour + time.Minute), time.Hour, anchor.Add(2 * time.Hour)},
+		{"many ticks missed", anchor.Add(5*time.Hour + 30*time.Minute), time.Hour, anchor.Add(6 * time.Hour)},
+		{"exactly on a tick", anchor.Add(2 * time.Hour), time.Hour, anchor.Add(3 * time.Hour)},
+		{"early", anchor.Add(-time.Minute), time.Hour, anchor.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		if got := nextAligned(anchor, tt.now, tt.interval); !got.Equal(tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNextAlignedDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// DST starts on 2020-03-08, so that day is 23 hours long
+	anchor := time.Date(2020, 3, 7, 9, 0, 0, 0, loc)
+	now := anchor.Add(2 * time.Minute)
+	if got, want := nextAligned(anchor, now, 24*time.Hour), time.Date(2020, 3, 8, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("daily: want %v, got %v", want, got)
+	}
+
+	// missed ticks across the transition still land on 09:00
+	now = time.Date(2020, 3, 10, 12, 0, 0, 0, loc)
+	if got, want := nextAligned(anchor, now, 24*time.Hour), time.Date(2020, 3, 11, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("daily, late: want %v, got %v", want, got)
+	}
+	now = time.Date(2020, 3, 8, 8, 59, 0, 0, loc)
+	if got, want := nextAligned(anchor, now, 24*time.Hour), time.Date(2020, 3, 8, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("daily, just before the tick: want %v, got %v", want, got)
+	}
+
+	// hourly jobs keep exact durations, skipping the missing 02:00
+	anchor = time.Date(2020, 3, 8, 1, 0, 0, 0, loc)
+	if got, want := nextAligned(anchor, anchor.Add(time.Minute), time.Hour), time.Date(2020, 3, 8, 3, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("hourly: want %v, got %v", want, got)
+	}
+}
+
+func TestRescheduleAligned(t *testing.T) {
+	j := &Job{RunAt: time.Now().Add(-90 * time.Minute)}
+	anchor := j.RunAt
+	j.RescheduleAligned(time.Hour)
+
+	if !j.reschedule {
+		t.Error("want job rescheduled")
+	}
+	if want := anchor.Add(2 * time.Hour); !j.RunAt.Equal(want) {
+		t.Errorf("want RunAt=%v, got %v", want, j.RunAt)
+	}
+}
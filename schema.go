@@ -0,0 +1,124 @@
+package que
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// schemaNameRE matches the schema names que accepts: unquoted PostgreSQL
+// identifiers of at most 63 bytes.
+var schemaNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// tableRefRE matches the references to que's tables in its SQL.
+var tableRefRE = regexp.MustCompile(`\b(FROM|INTO|UPDATE|JOIN)(\s+)(que_jobs|que_dead_jobs|que_queue_state|que_job_results)\b`)
+
+func validateSchema(schema string) error {
+	if !schemaNameRE.MatchString(schema) {
+		return fmt.Errorf("que: invalid schema name %q", schema)
+	}
+	return nil
+}
+
+// NewClientWithSchema creates a new Client that uses the pgx pool and the
+// que_jobs table in schema, regardless of the search_path of its connections,
+// configured by opts.
+// This suits multi-tenant databases that switch search_path per request, which
+// would otherwise change which que_jobs table unqualified statements use.
+//
+// The statements for schema must be prepared on every connection of the pool
+// with PrepareSchemaStatements, typically from an AfterConnect func:
+//
+//	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+//	    return que.PrepareSchemaStatements(ctx, conn, "jobs")
+//	}
+//
+// Statements for different schemas have different names, so a single pool
+// can serve Clients for several schemas if it prepares all of them. To create
+// que's tables in schema, run schema.sql with search_path set to schema.
+//
+// schema must be an unquoted identifier: letters, digits and underscores, not
+// starting with a digit.
+func NewClientWithSchema(pool *pgxpool.Pool, schema string, opts ...ClientOption) (*Client, error) {
+	if err := validateSchema(schema); err != nil {
+		return nil, err
+	}
+	c := NewClient(pool, opts...)
+	c.schema = schema
+	return c, nil
+}
+
+// PrepareSchemaStatements is like PrepareStatementsWithPreparer, but prepares
+// the statements used by a Client created with NewClientWithSchema, which use
+// the tables in schema.
+func PrepareSchemaStatements(ctx context.Context, p Preparer, schema string) error {
+	if err := validateSchema(schema); err != nil {
+		return err
+	}
+	_, err := prepareStatements(ctx, p, schema)
+	return err
+}
+
+// prepareStatements prepares que's statements for the tables in schema on p.
+// Statements that use columns or tables missing from an older schema are
+// skipped, so that upgrading que before re-running schema.sql only breaks the
+// features that need them, and returned as an *outdatedError.
+func prepareStatements(ctx context.Context, p Preparer, schema string) (*outdatedError, error) {
+	names := make([]string, 0, len(preparedStatements))
+	for name := range preparedStatements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// que_ping fails if que_jobs itself is missing, which no upgrade explains
+	if _, err := p.Prepare(ctx, stmtName(schema, "que_ping"), qualifySQL(schema, sqlPing)); err != nil {
+		return nil, err
+	}
+	var outdated *outdatedError
+	for _, name := range names {
+		_, err := p.Prepare(ctx, stmtName(schema, name), qualifySQL(schema, preparedStatements[name]))
+		if isSchemaOutdated(err) {
+			if outdated == nil {
+				outdated = &outdatedError{err: err}
+			}
+			outdated.names = append(outdated.names, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outdated, nil
+}
+
+// qualifySQL returns sql with its references to que's tables, and its
+// notification channel, qualified with schema.
+func qualifySQL(schema, sql string) string {
+	if schema == "" {
+		return sql
+	}
+	sql = tableRefRE.ReplaceAllString(sql, "$1$2"+pgx.Identifier{schema}.Sanitize()+".$3")
+	return strings.Replace(sql, "pg_notify('que_jobs'", "pg_notify('"+notifyChannel(schema)+"'", -1)
+}
+
+// stmtName returns the name under which the statement called name is prepared
+// for the tables in schema.
+func stmtName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+func (c *Client) stmt(name string) string {
+	return stmtName(c.schema, name)
+}
+
+func (j *Job) stmt(name string) string {
+	return stmtName(j.schema, name)
+}
@@ -13,3 +13,68 @@ CREATE TABLE IF NOT EXISTS que_jobs
 );
 
 COMMENT ON TABLE que_jobs IS '3';
+
+-- Columns used only by the Go workers. Ruby Que ignores them.
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS panic_count integer NOT NULL DEFAULT 0;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS locked_at   timestamptz;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS unique_key  text;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS routing_key text;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS cancel_requested boolean NOT NULL DEFAULT false;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS blocked_by  bigint;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS on_parent_failure text;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS args_compression text;
+ALTER TABLE que_jobs ADD COLUMN IF NOT EXISTS compressed_args bytea;
+
+-- Finding the jobs enqueued with EnqueueAfter when their parent finishes.
+CREATE INDEX IF NOT EXISTS que_jobs_blocked_by ON que_jobs (blocked_by)
+  WHERE blocked_by IS NOT NULL;
+
+-- At most one pending job per unique_key. Jobs are deleted once worked, so
+-- this only covers jobs that are still pending.
+CREATE UNIQUE INDEX IF NOT EXISTS que_jobs_unique_key ON que_jobs (unique_key)
+  WHERE unique_key IS NOT NULL;
+
+-- Queues paused with PauseQueue, in all processes.
+CREATE TABLE IF NOT EXISTS que_queue_state
+(
+  queue      text        NOT NULL,
+  paused     boolean     NOT NULL DEFAULT false,
+  updated_at timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT que_queue_state_pkey PRIMARY KEY (queue)
+);
+
+-- Jobs that were given up on, e.g. because they panicked too many times.
+CREATE TABLE IF NOT EXISTS que_dead_jobs
+(
+  priority    smallint    NOT NULL,
+  run_at      timestamptz NOT NULL,
+  job_id      bigint      NOT NULL,
+  job_class   text        NOT NULL,
+  args        json        NOT NULL,
+  error_count integer     NOT NULL,
+  last_error  text,
+  queue       text        NOT NULL,
+  panic_count integer     NOT NULL DEFAULT 0,
+  died_at     timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT que_dead_jobs_pkey PRIMARY KEY (job_id)
+);
+
+ALTER TABLE que_dead_jobs ADD COLUMN IF NOT EXISTS args_compression text;
+ALTER TABLE que_dead_jobs ADD COLUMN IF NOT EXISTS compressed_args bytea;
+
+-- Results stored with Job.SetResult, kept after their job is deleted until
+-- they are purged with Client.PurgeResults.
+CREATE TABLE IF NOT EXISTS que_job_results
+(
+  job_id      bigint      NOT NULL,
+  job_class   text        NOT NULL,
+  result      jsonb       NOT NULL,
+  finished_at timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT que_job_results_pkey PRIMARY KEY (job_id)
+);
+
+-- Purging results past their retention.
+CREATE INDEX IF NOT EXISTS que_job_results_finished_at ON que_job_results (finished_at);
@@ -0,0 +1,187 @@
+package que
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestValidateSchema(t *testing.T) {
+	for _, schema := range []string{"jobs", "tenant_42", "_private", strings.Repeat("a", 63)} {
+		if err := validateSchema(schema); err != nil {
+			t.Errorf("%q: want valid, got %v", schema, err)
+		}
+	}
+	for _, schema := range []string{"", "42tenant", "my-schema", `jobs"; DROP TABLE que_jobs; --`, "a.b", strings.Repeat("a", 64)} {
+		if err := validateSchema(schema); err == nil {
+			t.Errorf("%q: want invalid", schema)
+		}
+	}
+}
+
+func TestQualifySQL(t *testing.T) {
+	for name, sql := range preparedStatements {
+		qualified := qualifySQL("jobs", sql)
+		unqualified := strings.Replace(qualified, `"jobs".que_jobs`, "", -1)
+		unqualified = strings.Replace(unqualified, `"jobs".que_dead_jobs`, "", -1)
+		unqualified = strings.Replace(unqualified, "pg_notify('jobs.que_jobs'", "", -1)
+		if strings.Contains(unqualified, "que_jobs") || strings.Contains(unqualified, "que_dead_jobs") {
+			t.Errorf("%s: want all table references qualified, got:\n%s", name, qualified)
+		}
+	}
+
+	if got := qualifySQL("", sqlDeleteJob); got != sqlDeleteJob {
+		t.Errorf("want SQL unchanged without a schema, got:\n%s", got)
+	}
+}
+
+func openTestSchemaClient(t testing.TB, schema string) *Client {
+	conn, err := pgx.ConnectConfig(context.Background(), testConnConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	for _, sql := range []string{
+		"CREATE SCHEMA IF NOT EXISTS " + schema,
+		"CREATE TABLE IF NOT EXISTS " + schema + ".que_jobs (LIKE public.que_jobs INCLUDING ALL)",
+		"CREATE TABLE IF NOT EXISTS " + schema + ".que_dead_jobs (LIKE public.que_dead_jobs INCLUDING ALL)",
+		"CREATE TABLE IF NOT EXISTS " + schema + ".que_queue_state (LIKE public.que_queue_state INCLUDING ALL)",
+		"CREATE TABLE IF NOT EXISTS " + schema + ".que_job_results (LIKE public.que_job_results INCLUDING ALL)",
+		"TRUNCATE TABLE " + schema + ".que_jobs, " + schema + ".que_dead_jobs, " + schema + ".que_queue_state, " + schema + ".que_job_results",
+	} {
+		if _, err := conn.Exec(context.Background(), sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connPoolConfig, err := pgxpool.ParseConfig(testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connPoolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if err := PrepareStatements(ctx, conn); err != nil {
+			return err
+		}
+		return PrepareSchemaStatements(ctx, conn, schema)
+	}
+	pool, err := pgxpool.ConnectConfig(context.Background(), connPoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClientWithSchema(pool, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientWithSchema(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	sc := openTestSchemaClient(t, "que_go_test_tenant")
+	defer closePool(sc.pool)
+
+	// switching search_path must not change which table is used
+	if _, err := sc.pool.Exec(context.Background(), "SET search_path TO pg_catalog"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sc.Enqueue(&Job{Type: "SchemaJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Fatalf("want no job in the default schema, got %+v", j)
+	}
+
+	j, err = sc.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	if want := "SchemaJob"; j.Type != want {
+		t.Errorf("want Type=%q, got %q", want, j.Type)
+	}
+	if err := j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewClientWithSchemaInvalid(t *testing.T) {
+	if _, err := NewClientWithSchema(nil, "bad-schema"); err == nil {
+		t.Error("want error for invalid schema name")
+	}
+}
+
+func TestLockKeyspace(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+	sc := openTestSchemaClient(t, "que_go_test_tenant")
+	defer closePool(sc.pool)
+
+	// give the jobs in both tables the same ID, so their default lock keys
+	// collide
+	for _, table := range []string{"que_jobs", "que_go_test_tenant.que_jobs"} {
+		if _, err := c.pool.Exec(context.Background(), "INSERT INTO "+table+" (job_id, job_class) VALUES (1, 'MyJob')"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	sj, err := sc.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sj != nil {
+		sj.Done()
+		t.Fatal("want the default keyspaces to collide, got a job")
+	}
+
+	sc.LockKeyspace = 42
+	sj, err = sc.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sj == nil {
+		t.Fatal("wanted job in another keyspace, got none")
+	}
+
+	stats, err := sc.QueueStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Working != 1 {
+		t.Errorf("want 1 job working in keyspace 42, got %+v", stats)
+	}
+
+	sj.Done()
+	var locks int
+	err = c.pool.QueryRow(context.Background(), "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND classid = 42 AND objsubid = 2").Scan(&locks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks != 0 {
+		t.Errorf("want keyspace 42 lock released, got %d locks", locks)
+	}
+}
@@ -0,0 +1,79 @@
+package que
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// maxApplicationName is the length in bytes beyond which PostgreSQL truncates
+// application_name.
+const maxApplicationName = 63
+
+// WorkerSession sets up the connections of a pool dedicated to Workers, for
+// instance to have them use a role with only the privileges que needs while
+// the application enqueues Jobs through another pool. Use its AfterConnect
+// method as the pool's AfterConnect func, and create the Workers' Client from
+// that pool:
+//
+//	config.AfterConnect = que.WorkerSession{
+//	    Queue: "emails",
+//	    Setup: []string{"SET ROLE que_worker", "SET statement_timeout = '30s'"},
+//	}.AfterConnect
+//	pool, err := pgxpool.ConnectConfig(ctx, config)
+//	...
+//	workers := que.NewWorkerPool(que.NewClient(pool), wm, 4)
+//
+// Every connection gets the application_name que-worker-<Queue>, which shows
+// in pg_stat_activity which Queue a connection serves.
+type WorkerSession struct {
+	// Queue is the Queue of the Workers that use the pool. The default, "",
+	// is the default Queue.
+	Queue string
+
+	// Schema is the schema of que's tables, if the Workers' Client was created
+	// with NewClientWithSchema.
+	Schema string
+
+	// Setup holds statements run on every new connection, in order, after
+	// setting application_name, such as SET ROLE or SET statement_timeout.
+	//
+	// que's statements are prepared after the Setup statements, so the tables
+	// they refer to are looked up with the search_path set by them. PostgreSQL
+	// checks privileges when a statement runs, not when it is prepared, so
+	// the role in effect then needs SELECT, UPDATE and DELETE on que_jobs,
+	// INSERT on que_jobs and que_dead_jobs if Jobs enqueue followups or are
+	// dead-lettered, and the privileges of any other feature in use. A WorkFunc
+	// that changes the role of its Job's connection changes it for the Jobs
+	// worked on that connection afterwards too.
+	Setup []string
+}
+
+// ApplicationName returns the application_name of the session's connections.
+func (s WorkerSession) ApplicationName() string {
+	name := "que-worker"
+	if s.Queue != "" {
+		name += "-" + s.Queue
+	}
+	if len(name) > maxApplicationName {
+		name = name[:maxApplicationName]
+	}
+	return name
+}
+
+// AfterConnect sets up conn for the session and prepares que's statements on
+// it. It is meant to be used as the AfterConnect func of a pgxpool.Config.
+func (s WorkerSession) AfterConnect(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, "SELECT set_config('application_name', $1, false)", s.ApplicationName()); err != nil {
+		return err
+	}
+	for _, sql := range s.Setup {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	if s.Schema != "" {
+		return PrepareSchemaStatements(ctx, conn, s.Schema)
+	}
+	return PrepareStatements(ctx, conn)
+}
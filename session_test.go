@@ -0,0 +1,68 @@
+package que
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestWorkerSessionApplicationName(t *testing.T) {
+	for _, tc := range []struct {
+		queue, want string
+	}{
+		{"", "que-worker"},
+		{"emails", "que-worker-emails"},
+		{strings.Repeat("q", 100), "que-worker-" + strings.Repeat("q", 52)},
+	} {
+		if got := (WorkerSession{Queue: tc.queue}).ApplicationName(); got != tc.want {
+			t.Errorf("want application_name %q for queue %q, got %q", tc.want, tc.queue, got)
+		}
+	}
+}
+
+func TestWorkerSessionAfterConnect(t *testing.T) {
+	config, err := pgxpool.ParseConfig(testConnConfig.ConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AfterConnect = WorkerSession{
+		Queue: "emails",
+		Setup: []string{"SET statement_timeout = '7s'"},
+	}.AfterConnect
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closePool(pool)
+
+	var name, timeout string
+	err = pool.QueryRow(context.Background(), "SELECT current_setting('application_name'), current_setting('statement_timeout')").Scan(&name, &timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "que-worker-emails"; name != want {
+		t.Errorf("want application_name=%q, got %q", want, name)
+	}
+	if want := "7s"; timeout != want {
+		t.Errorf("want statement_timeout=%q, got %q", want, timeout)
+	}
+
+	// the statements were prepared
+	c := NewClient(pool)
+	if err := c.Enqueue(&Job{Type: "MyJob", Queue: "emails"}); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("emails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+	if err := j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
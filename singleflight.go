@@ -0,0 +1,73 @@
+package que
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// singleFlight is the set of single-flight keys of the Jobs being worked in
+// this process.
+type singleFlight struct {
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func newSingleFlight() *singleFlight {
+	return &singleFlight{busy: make(map[string]bool)}
+}
+
+// tryLock marks key as busy, unless it already is. It reports whether it did.
+func (s *singleFlight) tryLock(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.busy[key] {
+		return false
+	}
+	s.busy[key] = true
+	return true
+}
+
+func (s *singleFlight) unlock(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busy, key)
+}
+
+// lockSingleFlight locks key for working j, in this process and, with
+// SingleFlightAcrossProcesses, in the database. It reports whether key was
+// free, in which case release must be called once j has been worked.
+func (w *Worker) lockSingleFlight(j *Job, key string) (release func(), ok bool) {
+	if w.singleFlight == nil {
+		w.singleFlight = newSingleFlight()
+	}
+	if !w.singleFlight.tryLock(key) {
+		return nil, false
+	}
+	if !w.SingleFlightAcrossProcesses {
+		return func() { w.singleFlight.unlock(key) }, true
+	}
+
+	// the lock is taken on the Job's connection, so it is released at the
+	// latest when the connection is closed
+	conn := j.Conn()
+	err := conn.QueryRow(context.Background(), j.stmt("que_single_flight_lock"), key).Scan(&ok)
+	if err != nil {
+		log.Printf("attempting to lock single-flight key %q: %v", key, err)
+	}
+	if !ok {
+		w.singleFlight.unlock(key)
+		return nil, false
+	}
+	return func() {
+		var unlocked bool
+		if err := conn.QueryRow(context.Background(), j.stmt("que_single_flight_unlock"), key).Scan(&unlocked); err != nil {
+			log.Printf("attempting to unlock single-flight key %q: %v", key, err)
+			// don't return a connection still holding the lock to the pool
+			conn.Conn().Close(context.Background())
+		}
+		w.singleFlight.unlock(key)
+	}, true
+}
@@ -0,0 +1,98 @@
+package que
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightTryLock(t *testing.T) {
+	s := newSingleFlight()
+	if !s.tryLock("a") {
+		t.Fatal("want free key locked")
+	}
+	if s.tryLock("a") {
+		t.Error("want busy key not locked")
+	}
+	if !s.tryLock("b") {
+		t.Error("want other key locked")
+	}
+	s.unlock("a")
+	if !s.tryLock("a") {
+		t.Error("want unlocked key locked again")
+	}
+}
+
+func testWorkerPoolSingleFlight(t *testing.T, acrossProcesses bool) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var (
+		mu         sync.Mutex
+		running    = make(map[string]int)
+		maxRunning int
+		worked     int
+	)
+	wm := WorkMap{
+		"RecalculateBalance": func(j *Job) error {
+			key := string(j.Args)
+			mu.Lock()
+			running[key]++
+			if running[key] > maxRunning {
+				maxRunning = running[key]
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			running[key]--
+			worked++
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	for i := 0; i < 6; i++ {
+		args := []byte(`"account-7"`)
+		if i%2 == 1 {
+			args = []byte(`"account-8"`)
+		}
+		if err := c.Enqueue(&Job{Type: "RecalculateBalance", Args: args}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wp := NewWorkerPool(c, wm, 4)
+	wp.Interval = 10 * time.Millisecond
+	wp.SingleFlight = func(j *Job) string { return j.Type + ":" + string(j.Args) }
+	wp.SingleFlightAcrossProcesses = acrossProcesses
+	wp.Start()
+	defer wp.Shutdown()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		done := worked == 6
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for jobs")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if maxRunning != 1 {
+		t.Errorf("want at most 1 job running per key, got %d", maxRunning)
+	}
+}
+
+func TestWorkerPoolSingleFlight(t *testing.T) {
+	testWorkerPoolSingleFlight(t, false)
+}
+
+func TestWorkerPoolSingleFlightAcrossProcesses(t *testing.T) {
+	testWorkerPoolSingleFlight(t, true)
+}
@@ -0,0 +1,62 @@
+package que
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Spread places the i-th of n jobs within a time window, by returning the
+// fraction of the window after which it runs, between 0 and 1. Fractions
+// outside of that range are clamped to it.
+type Spread func(i, n int) float64
+
+// SpreadEven is the Spread that spaces jobs evenly across the window, in
+// order: the first job runs at the start of the window, and the last one a
+// fraction 1/n of the window before its end.
+func SpreadEven(i, n int) float64 {
+	return float64(i) / float64(n)
+}
+
+// SpreadRandom is the Spread that places every job at a uniformly random time
+// within the window, independently of the others.
+func SpreadRandom(i, n int) float64 {
+	return rand.Float64()
+}
+
+// ErrInvalidWindow is returned by EnqueueSpread if the window ends before it
+// starts.
+var ErrInvalidWindow = errors.New("que: spread window ends before it starts")
+
+// EnqueueSpread enqueues jobs like EnqueueBatch, after setting their RunAt to
+// times spread across the window from start to end by spread, SpreadEven if
+// nil. It keeps jobs scheduled in bulk for the same time, such as a day's
+// worth of reminders to send in 24 hours, from all becoming ready at once. The
+// RunAt the jobs had is overwritten.
+func (c *Client) EnqueueSpread(jobs []*Job, start, end time.Time, spread Spread) error {
+	if err := spreadRunAt(jobs, start, end, spread); err != nil {
+		return err
+	}
+	return c.EnqueueBatch(jobs)
+}
+
+// spreadRunAt sets the RunAt of jobs across the window from start to end.
+func spreadRunAt(jobs []*Job, start, end time.Time, spread Spread) error {
+	if end.Before(start) {
+		return ErrInvalidWindow
+	}
+	if spread == nil {
+		spread = SpreadEven
+	}
+	window := end.Sub(start)
+	for i, j := range jobs {
+		f := spread(i, len(jobs))
+		if f < 0 {
+			f = 0
+		} else if f > 1 {
+			f = 1
+		}
+		j.RunAt = start.Add(time.Duration(f * float64(window)))
+	}
+	return nil
+}
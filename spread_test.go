@@ -0,0 +1,91 @@
+package que
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpreadRunAt(t *testing.T) {
+	const (
+		n       = 10000
+		buckets = 10
+	)
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	bucket := end.Sub(start) / buckets
+
+	for name, spread := range map[string]Spread{"even": nil, "random": SpreadRandom} {
+		jobs := make([]*Job, n)
+		for i := range jobs {
+			jobs[i] = &Job{Type: "Remind"}
+		}
+		if err := spreadRunAt(jobs, start, end, spread); err != nil {
+			t.Fatal(err)
+		}
+
+		counts := make([]int, buckets)
+		for _, j := range jobs {
+			if j.RunAt.Before(start) || j.RunAt.After(end) {
+				t.Fatalf("%s: want RunAt within [%v, %v], got %v", name, start, end, j.RunAt)
+			}
+			b := int(j.RunAt.Sub(start) / bucket)
+			if b == buckets {
+				b--
+			}
+			counts[b]++
+		}
+		// each tenth of the window gets about a tenth of the jobs
+		for b, count := range counts {
+			if count < n/buckets*8/10 || count > n/buckets*12/10 {
+				t.Errorf("%s: want about %d jobs in bucket %d, got %d", name, n/buckets, b, count)
+			}
+		}
+	}
+}
+
+func TestSpreadRunAtClamps(t *testing.T) {
+	start := time.Now()
+	end := start.Add(time.Hour)
+	jobs := []*Job{{}, {}}
+	err := spreadRunAt(jobs, start, end, func(i, n int) float64 {
+		return float64(i)*3 - 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jobs[0].RunAt.Equal(start) || !jobs[1].RunAt.Equal(end) {
+		t.Errorf("want RunAt clamped to %v and %v, got %v and %v", start, end, jobs[0].RunAt, jobs[1].RunAt)
+	}
+
+	if err := spreadRunAt(jobs, end, start, nil); err != ErrInvalidWindow {
+		t.Errorf("want ErrInvalidWindow, got %v", err)
+	}
+}
+
+func TestEnqueueSpread(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	end := start.Add(time.Hour)
+	jobs := make([]*Job, 4)
+	for i := range jobs {
+		jobs[i] = &Job{Type: "Remind"}
+	}
+	if err := c.EnqueueSpread(jobs, start, end, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := c.ListJobs(JobFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 4 {
+		t.Fatalf("want 4 jobs, got %d", len(listed))
+	}
+	for i, j := range listed {
+		if want := start.Add(time.Duration(i) * 15 * time.Minute); !j.RunAt.Equal(want) {
+			t.Errorf("want job %d at %v, got %v", i, want, j.RunAt)
+		}
+	}
+}
@@ -27,46 +27,202 @@ package que
 const (
 	sqlLockJob = `
 WITH RECURSIVE jobs AS (
-  SELECT (j).*, pg_try_advisory_lock((j).job_id) AS locked
+  SELECT (j).*, CASE WHEN $8::integer = 0
+              THEN pg_try_advisory_lock((j).job_id)
+              ELSE pg_try_advisory_lock($8::integer, (j).job_id::bit(32)::integer)
+         END AS locked, 1 AS depth
   FROM (
     SELECT j
     FROM que_jobs AS j
     WHERE queue = $1::text
     AND run_at <= now()
-    ORDER BY priority, run_at, job_id
+    AND NOT job_id = ANY(coalesce($2::bigint[], '{}'))
+    AND ($4::integer <= 1 OR job_id % $4::integer = $5::integer)
+    AND ($6::integer <= 1 OR (hashtext(routing_key) & 2147483647) % $6::integer = $7::integer)
+    AND blocked_by IS NULL
+    ORDER BY priority ASC, run_at ASC, job_id ASC
     LIMIT 1
   ) AS t1
   UNION ALL (
-    SELECT (j).*, pg_try_advisory_lock((j).job_id) AS locked
+    SELECT (j).*, CASE WHEN $8::integer = 0
+              THEN pg_try_advisory_lock((j).job_id)
+              ELSE pg_try_advisory_lock($8::integer, (j).job_id::bit(32)::integer)
+         END AS locked, depth
     FROM (
       SELECT (
         SELECT j
         FROM que_jobs AS j
         WHERE queue = $1::text
         AND run_at <= now()
+        AND NOT job_id = ANY(coalesce($2::bigint[], '{}'))
+        AND ($4::integer <= 1 OR job_id % $4::integer = $5::integer)
+        AND ($6::integer <= 1 OR (hashtext(routing_key) & 2147483647) % $6::integer = $7::integer)
+        AND blocked_by IS NULL
         AND (priority, run_at, job_id) > (jobs.priority, jobs.run_at, jobs.job_id)
-        ORDER BY priority, run_at, job_id
+        ORDER BY priority ASC, run_at ASC, job_id ASC
         LIMIT 1
-      ) AS j
+      ) AS j, jobs.depth + 1 AS depth
       FROM jobs
       WHERE jobs.job_id IS NOT NULL
+      AND ($3::integer <= 0 OR jobs.depth < $3::integer)
       LIMIT 1
     ) AS t1
   )
+), locked AS (
+  SELECT queue, priority, run_at, job_id, job_class, coalesce(compressed_args, convert_to(args::text, 'UTF8')) AS args, args_compression, error_count, last_error, coalesce(routing_key, '') AS routing_key, clock_timestamp() AS locked_at
+  FROM jobs
+  WHERE locked
+  LIMIT 1
 )
-SELECT queue, priority, run_at, job_id, job_class, args, error_count, last_error
-FROM jobs
-WHERE locked
-LIMIT 1
+SELECT *, NULL::timestamptz AS next_run_at
+FROM locked
+UNION ALL
+-- if no job was locked, when the next one becomes ready
+SELECT ''::text, 0::smallint, now(), NULL::bigint, ''::text, convert_to('[]', 'UTF8'), NULL::text, 0::integer, NULL::text, ''::text, clock_timestamp(), next.run_at
+FROM (
+  SELECT min(run_at) AS run_at
+  FROM que_jobs
+  WHERE queue = $1::text
+  AND run_at > now()
+  AND NOT job_id = ANY(coalesce($2::bigint[], '{}'))
+  AND ($4::integer <= 1 OR job_id % $4::integer = $5::integer)
+  AND ($6::integer <= 1 OR (hashtext(routing_key) & 2147483647) % $6::integer = $7::integer)
+  AND blocked_by IS NULL
+) AS next
+WHERE next.run_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM locked)
+`
+
+	// sqlLockJobFair is like sqlLockJob, but takes the first $tenant_depth
+	// ready jobs of every tenant, as given by $tenant_key, and tries the
+	// first job of every tenant, then the second, and so on, each round in
+	// the order of their tenants starting after $last_tenant and wrapping
+	// around, so that every tenant with ready jobs gets its turn, and a
+	// tenant whose first job is locked by another worker falls through to
+	// its next one.
+	sqlLockJobFair = `
+WITH RECURSIVE candidates AS (
+  SELECT array_agg(c.j ORDER BY c.rank, c.tenant <= $last_tenant::text, c.tenant) AS js,
+         array_agg(c.tenant ORDER BY c.rank, c.tenant <= $last_tenant::text, c.tenant) AS tenants
+  FROM (
+    SELECT r.j, r.tenant, row_number() OVER (PARTITION BY r.tenant ORDER BY r.priority ASC, r.run_at ASC, r.job_id ASC) AS rank
+    FROM (
+      SELECT j, coalesce($tenant_key::text, '') AS tenant, priority, run_at, job_id
+      FROM que_jobs AS j
+      WHERE queue = $1::text
+      AND run_at <= now()
+      AND NOT job_id = ANY(coalesce($2::bigint[], '{}'))
+      AND ($4::integer <= 1 OR job_id % $4::integer = $5::integer)
+      AND ($6::integer <= 1 OR (hashtext(routing_key) & 2147483647) % $6::integer = $7::integer)
+      AND blocked_by IS NULL
+    ) AS r
+  ) AS c
+  WHERE c.rank <= $tenant_depth
+), jobs AS (
+  SELECT (c.js[1]).*, c.tenants[1] AS tenant, CASE WHEN $8::integer = 0
+              THEN pg_try_advisory_lock((c.js[1]).job_id)
+              ELSE pg_try_advisory_lock($8::integer, (c.js[1]).job_id::bit(32)::integer)
+         END AS locked, 1 AS depth
+  FROM candidates AS c
+  WHERE c.js IS NOT NULL
+  UNION ALL
+  SELECT (c.js[jobs.depth + 1]).*, c.tenants[jobs.depth + 1], CASE WHEN $8::integer = 0
+              THEN pg_try_advisory_lock((c.js[jobs.depth + 1]).job_id)
+              ELSE pg_try_advisory_lock($8::integer, (c.js[jobs.depth + 1]).job_id::bit(32)::integer)
+         END, jobs.depth + 1
+  FROM jobs, candidates AS c
+  WHERE NOT jobs.locked
+  AND jobs.depth < cardinality(c.js)
+  AND ($3::integer <= 0 OR jobs.depth < $3::integer)
+), locked AS (
+  SELECT queue, priority, run_at, job_id, job_class, coalesce(compressed_args, convert_to(args::text, 'UTF8')) AS args, args_compression, error_count, last_error, coalesce(routing_key, '') AS routing_key, clock_timestamp() AS locked_at, tenant
+  FROM jobs
+  WHERE locked
+  LIMIT 1
+)
+SELECT queue, priority, run_at, job_id, job_class, args, args_compression, error_count, last_error, routing_key, locked_at, NULL::timestamptz AS next_run_at, tenant
+FROM locked
+UNION ALL
+-- if no job was locked, when the next one becomes ready
+SELECT ''::text, 0::smallint, now(), NULL::bigint, ''::text, convert_to('[]', 'UTF8'), NULL::text, 0::integer, NULL::text, ''::text, clock_timestamp(), next.run_at, ''::text
+FROM (
+  SELECT min(run_at) AS run_at
+  FROM que_jobs
+  WHERE queue = $1::text
+  AND run_at > now()
+  AND NOT job_id = ANY(coalesce($2::bigint[], '{}'))
+  AND ($4::integer <= 1 OR job_id % $4::integer = $5::integer)
+  AND ($6::integer <= 1 OR (hashtext(routing_key) & 2147483647) % $6::integer = $7::integer)
+  AND blocked_by IS NULL
+) AS next
+WHERE next.run_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM locked)
+`
+
+	// sqlLeaseJob pushes the run_at of a locked job lease microseconds into
+	// the future, so that other workers leave it alone until then even once it
+	// is unlocked.
+	sqlLeaseJob = `
+UPDATE que_jobs
+SET    run_at    = now() + $5::bigint * '1 microsecond'::interval,
+       locked_at = NULL
+WHERE  queue    = $1::text
+AND    priority = $2::smallint
+AND    run_at   = $3::timestamptz
+AND    job_id   = $4::bigint
+RETURNING run_at
 `
 
 	sqlUnlockJob = `
-SELECT pg_advisory_unlock($1)
+SELECT CASE WHEN $2::integer = 0
+            THEN pg_advisory_unlock($1::bigint)
+            ELSE pg_advisory_unlock($2::integer, $1::bigint::bit(32)::integer)
+       END
 `
 
 	sqlCheckJob = `
-SELECT true AS exists
-FROM   que_jobs
+UPDATE que_jobs
+SET    locked_at = now()
+WHERE  queue    = $1::text
+AND    priority = $2::smallint
+AND    run_at   = $3::timestamptz
+AND    job_id   = $4::bigint
+RETURNING true AS exists
+`
+
+	// sqlAdvanceJob matches the job as it was locked, so that it doesn't
+	// overwrite a change made since.
+	sqlAdvanceJob = `
+UPDATE que_jobs
+SET    args             = coalesce($5::json, '[]'::json),
+       args_compression = $7::text,
+       compressed_args  = $8::bytea,
+       run_at           = $6::timestamptz,
+       error_count      = 0,
+       last_error       = NULL,
+       locked_at        = NULL
+WHERE  queue    = $1::text
+AND    priority = $2::smallint
+AND    run_at   = $3::timestamptz
+AND    job_id   = $4::bigint
+RETURNING job_id
+`
+
+	sqlCheckpointJob = `
+UPDATE que_jobs
+SET    args             = coalesce($5::json, '[]'::json),
+       args_compression = $6::text,
+       compressed_args  = $7::bytea,
+       locked_at        = now()
+WHERE  queue    = $1::text
+AND    priority = $2::smallint
+AND    run_at   = $3::timestamptz
+AND    job_id   = $4::bigint
+`
+
+	sqlClearLockedAt = `
+UPDATE que_jobs
+SET    locked_at = NULL
 WHERE  queue    = $1::text
 AND    priority = $2::smallint
 AND    run_at   = $3::timestamptz
@@ -76,31 +232,243 @@ AND    job_id   = $4::bigint
 	sqlSetError = `
 UPDATE que_jobs
 SET error_count = $1::integer,
-    run_at      = now() + $2::bigint * '1 second'::interval,
-    last_error  = $3::text
+    run_at      = now() + $2::bigint * '1 microsecond'::interval,
+    last_error  = $3::text,
+    locked_at   = NULL
 WHERE queue     = $4::text
 AND   priority  = $5::smallint
 AND   run_at    = $6::timestamptz
 AND   job_id    = $7::bigint
+`
+
+	// sqlSetErrors saves the errors of a batch of failed jobs and unlocks
+	// those of them in $9, like sqlAckJobs.
+	sqlSetErrors = `
+WITH failed AS (
+  UPDATE que_jobs AS j
+  SET error_count = f.error_count,
+      run_at      = now() + f.delay * '1 microsecond'::interval,
+      last_error  = f.last_error,
+      locked_at   = NULL
+  FROM unnest($1::text[], $2::smallint[], $3::timestamptz[], $4::bigint[], $5::integer[], $6::bigint[], $7::text[])
+    AS f(queue, priority, run_at, job_id, error_count, delay, last_error)
+  WHERE (j.queue, j.priority, j.run_at, j.job_id) = (f.queue, f.priority, f.run_at, f.job_id)
+)
+SELECT count(*)
+FROM unnest($9::bigint[]) AS t(job_id)
+WHERE CASE WHEN $8::integer = 0
+           THEN pg_advisory_unlock(job_id)
+           ELSE pg_advisory_unlock($8::integer, job_id::bit(32)::integer)
+      END
+`
+
+	sqlSetPanic = `
+UPDATE que_jobs
+SET error_count = $1::integer,
+    panic_count = panic_count + 1,
+    run_at      = now() + $2::bigint * '1 microsecond'::interval,
+    last_error  = $3::text,
+    locked_at   = NULL
+WHERE queue     = $4::text
+AND   priority  = $5::smallint
+AND   run_at    = $6::timestamptz
+AND   job_id    = $7::bigint
+RETURNING panic_count
+`
+
+	// sqlDeadLetterJob also removes the jobs enqueued to run after the job,
+	// dead-lettering those whose policy asks for it.
+	sqlDeadLetterJob = `
+WITH dead AS (
+  DELETE FROM que_jobs
+  WHERE job_id = $1::bigint
+  RETURNING *
+)
+INSERT INTO que_dead_jobs
+(priority, run_at, job_id, job_class, args, args_compression, compressed_args, error_count, last_error, queue, panic_count)
+SELECT priority, run_at, job_id, job_class, args, args_compression, compressed_args, error_count, coalesce($2::text, last_error), queue, panic_count
+FROM dead
+`
+
+	// sqlFailChildren cancels or dead-letters the jobs enqueued to run after
+	// job $1, which failed, and their own children in turn, unless job $1 is
+	// still in que_jobs. It must run in the same transaction as, and after,
+	// the statement that removes job $1: having its own snapshot, it sees the
+	// children committed by EnqueueAfter while that statement waited for the
+	// lock they hold on job $1. Descendants further down are found through
+	// the statement's snapshot, so a grandchild committed while the statement
+	// waits for its parent's row stays blocked.
+	sqlFailChildren = `
+WITH RECURSIVE orphans AS (
+  SELECT job_id
+  FROM que_jobs
+  WHERE blocked_by = $1::bigint
+  AND NOT EXISTS (SELECT 1 FROM que_jobs WHERE job_id = $1::bigint)
+  UNION
+  SELECT c.job_id
+  FROM que_jobs AS c
+  JOIN orphans ON c.blocked_by = orphans.job_id
+), removed AS (
+  DELETE FROM que_jobs
+  WHERE job_id IN (SELECT job_id FROM orphans)
+  RETURNING *
+)
+INSERT INTO que_dead_jobs
+(priority, run_at, job_id, job_class, args, args_compression, compressed_args, error_count, last_error, queue, panic_count)
+SELECT priority, run_at, job_id, job_class, args, args_compression, compressed_args, error_count, 'parent job ' || blocked_by || ' failed', queue, panic_count
+FROM removed
+WHERE on_parent_failure = 'dead_letter'
+`
+
+	sqlDeadJobs = `
+SELECT queue, priority, run_at, job_id, job_class, coalesce(compressed_args, convert_to(args::text, 'UTF8')) AS args, args_compression, error_count, last_error, panic_count, died_at
+FROM que_dead_jobs
+ORDER BY died_at, job_id
+`
+
+	sqlDeadJobArgs = `
+SELECT coalesce(compressed_args, convert_to(args::text, 'UTF8')) AS args, args_compression
+FROM que_dead_jobs
+WHERE job_id = $1::bigint
+`
+
+	// sqlReplayDeadJob moves a dead job back to que_jobs with args $2, stored
+	// with the compression $3 and compressed args $4, or with its own args if
+	// $2 is NULL, ready to run, as a new job but under its original ID.
+	sqlReplayDeadJob = `
+WITH dead AS (
+  DELETE FROM que_dead_jobs
+  WHERE job_id = $1::bigint
+  RETURNING *
+)
+INSERT INTO que_jobs
+(queue, priority, run_at, job_id, job_class, args, args_compression, compressed_args)
+SELECT queue, priority, now(), job_id, job_class, coalesce($2::json, args),
+       CASE WHEN $2::json IS NULL THEN args_compression ELSE $3::text END,
+       CASE WHEN $2::json IS NULL THEN compressed_args ELSE $4::bytea END
+FROM dead
+RETURNING job_id
 `
 
 	sqlInsertJob = `
 INSERT INTO que_jobs
-(queue, priority, run_at, job_class, args)
+(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args)
 VALUES
-(coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json))
+(coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json), $6::text, $7::text, $8::bytea)
+`
+
+	sqlInsertJobs = `
+INSERT INTO que_jobs
+(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args)
+SELECT coalesce(queue, ''::text), coalesce(priority, 100::smallint), coalesce(run_at, now()::timestamptz), job_class, coalesce(args::json, '[]'::json), routing_key, args_compression, compressed_args
+FROM unnest($1::text[], $2::smallint[], $3::timestamptz[], $4::text[], $5::text[], $6::text[], $7::text[], $8::bytea[])
+  WITH ORDINALITY AS t(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args, n)
+ORDER BY n
+RETURNING job_id
+`
+
+	sqlInsertJobsNotify = `
+WITH job AS (
+  INSERT INTO que_jobs
+  (queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args)
+  SELECT coalesce(queue, ''::text), coalesce(priority, 100::smallint), coalesce(run_at, now()::timestamptz), job_class, coalesce(args::json, '[]'::json), routing_key, args_compression, compressed_args
+  FROM unnest($1::text[], $2::smallint[], $3::timestamptz[], $4::text[], $5::text[], $6::text[], $7::text[], $8::bytea[])
+    WITH ORDINALITY AS t(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args, n)
+  ORDER BY n
+  RETURNING job_id, queue, priority, run_at
+)
+SELECT job_id, pg_notify('que_jobs', json_build_object(
+  'id',       job_id,
+  'queue',    CASE WHEN octet_length(queue) <= 1024 THEN queue END,
+  'priority', priority,
+  'run_at',   run_at,
+  'ready',    run_at <= now()
+)::text)
+FROM job
+`
+
+	sqlInsertJobNotify = `
+WITH job AS (
+  INSERT INTO que_jobs
+  (queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args)
+  VALUES
+  (coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json), $6::text, $7::text, $8::bytea)
+  RETURNING job_id, queue, priority, run_at
+)
+SELECT pg_notify('que_jobs', json_build_object(
+  'id',       job_id,
+  'queue',    CASE WHEN octet_length(queue) <= 1024 THEN queue END,
+  'priority', priority,
+  'run_at',   run_at,
+  'ready',    run_at <= now()
+)::text)
+FROM job
+`
+
+	sqlInsertJobUnique = `
+INSERT INTO que_jobs
+(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args, unique_key)
+VALUES
+(coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json), $6::text, $7::text, $8::bytea, $9::text)
+ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+RETURNING job_id
+`
+
+	sqlInsertJobUniqueNotify = `
+WITH job AS (
+  INSERT INTO que_jobs
+  (queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args, unique_key)
+  VALUES
+  (coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json), $6::text, $7::text, $8::bytea, $9::text)
+  ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+  RETURNING job_id, queue, priority, run_at
+)
+SELECT job_id, pg_notify('que_jobs', json_build_object(
+  'id',       job_id,
+  'queue',    CASE WHEN octet_length(queue) <= 1024 THEN queue END,
+  'priority', priority,
+  'run_at',   run_at,
+  'ready',    run_at <= now()
+)::text)
+FROM job
+`
+
+	// sqlLockParent locks the parent of a job enqueued with EnqueueAfter until
+	// the end of the transaction, which makes a concurrent removal of the
+	// parent wait for the child to be committed, so that the statement that
+	// then releases or fails its children sees it.
+	sqlLockParent = `
+SELECT job_id
+FROM que_jobs
+WHERE job_id = $1::bigint
+FOR KEY SHARE
+`
+
+	sqlParentFailed = `
+SELECT EXISTS (SELECT 1 FROM que_dead_jobs WHERE job_id = $1::bigint)
+`
+
+	sqlInsertJobAfter = `
+INSERT INTO que_jobs
+(queue, priority, run_at, job_class, args, routing_key, args_compression, compressed_args, blocked_by, on_parent_failure)
+VALUES
+(coalesce($1::text, ''::text), coalesce($2::smallint, 100::smallint), coalesce($3::timestamptz, now()::timestamptz), $4::text, coalesce($5::json, '[]'::json), $6::text, $7::text, $8::bytea, $9::bigint, $10::text)
+RETURNING job_id
 `
 
 	sqlUpdateJob = `
 UPDATE que_jobs
 SET
-    priority    = $2::smallint,
-    run_at      = $3::timestamptz,
-    job_class   = $4::text,
-    args        = coalesce($5::json, '[]'::json),
-    error_count = $6::integer,
-    last_error  = $7::text,
-    queue       = $8::text
+    priority         = $2::smallint,
+    run_at           = $3::timestamptz,
+    job_class        = $4::text,
+    args             = coalesce($5::json, '[]'::json),
+    args_compression = $9::text,
+    compressed_args  = $10::bytea,
+    error_count      = $6::integer,
+    last_error       = $7::text,
+    queue            = $8::text,
+    locked_at        = NULL
 
  WHERE job_id   = $1::bigint
 `
@@ -111,24 +479,164 @@ WHERE queue    = $1::text
 AND   priority = $2::smallint
 AND   run_at   = $3::timestamptz
 AND   job_id   = $4::bigint
+`
+
+	// sqlReleaseChildren makes the jobs enqueued to run after the jobs $1
+	// ready, for those of the jobs that are gone. Like sqlFailChildren, it
+	// must run after the statement that deletes the jobs, in the same
+	// transaction.
+	sqlReleaseChildren = `
+UPDATE que_jobs AS c
+SET blocked_by = NULL
+WHERE c.blocked_by = ANY($1::bigint[])
+AND NOT EXISTS (SELECT 1 FROM que_jobs AS p WHERE p.job_id = c.blocked_by)
+`
+
+	sqlReapStuckJobs = `
+SELECT j.job_id, pg_terminate_backend(l.pid)
+FROM que_jobs AS j
+JOIN pg_locks AS l
+  ON  l.locktype = 'advisory'
+  AND l.granted
+  AND CASE WHEN $2::integer = 0
+         THEN l.objsubid = 1 AND (l.classid::bigint << 32) + l.objid::bigint = j.job_id
+         ELSE l.objsubid = 2 AND l.classid = $2::integer::oid AND l.objid::bigint = j.job_id & 4294967295
+    END
+WHERE j.locked_at < now() - $1::bigint * '1 microsecond'::interval
+AND   l.pid <> pg_backend_pid()
+`
+
+	// The leader locks use the two-key form of the advisory lock functions,
+	// whose keys never collide with the single-key job locks of the default
+	// LockKeyspace. Job locks of a non-zero LockKeyspace use the two-key form
+	// too, and collide with them if LockKeyspace is hashtext('que_scheduler')
+	// or hashtext('que_single_flight'), which Client.LockKeyspace documents.
+	sqlSchedulerLock = `
+SELECT CASE WHEN $2::boolean THEN true
+            ELSE pg_try_advisory_lock(hashtext('que_scheduler'), hashtext($1::text))
+       END,
+       now()
+`
+
+	sqlSchedulerUnlock = `
+SELECT pg_advisory_unlock(hashtext('que_scheduler'), hashtext($1::text))
+`
+
+	sqlSingleFlightLock = `
+SELECT pg_try_advisory_lock(hashtext('que_single_flight'), hashtext($1::text))
+`
+
+	sqlSingleFlightUnlock = `
+SELECT pg_advisory_unlock(hashtext('que_single_flight'), hashtext($1::text))
+`
+
+	sqlRequestCancel = `
+UPDATE que_jobs
+SET cancel_requested = true
+WHERE job_id = $1::bigint
+RETURNING EXISTS (
+  SELECT 1
+  FROM pg_locks
+  WHERE locktype = 'advisory' AND granted
+  AND CASE WHEN $2::integer = 0
+         THEN objsubid = 1 AND (classid::bigint << 32) + objid::bigint = $1::bigint
+         ELSE objsubid = 2 AND classid = $2::integer::oid AND objid::bigint = $1::bigint & 4294967295
+    END
+)
+`
+
+	sqlCancelRequested = `
+SELECT cancel_requested
+FROM que_jobs
+WHERE job_id = $1::bigint
+`
+
+	// sqlAckJobs deletes the jobs completed in a batch and unlocks those of
+	// them in $6, the ones that weren't leased. The unlocks are in the same
+	// statement so that a job is never unlocked without being deleted.
+	sqlAckJobs = `
+WITH acked AS (
+  DELETE FROM que_jobs
+  WHERE (queue, priority, run_at, job_id) IN (
+    SELECT * FROM unnest($1::text[], $2::smallint[], $3::timestamptz[], $4::bigint[])
+  )
+)
+SELECT count(*)
+FROM unnest($6::bigint[]) AS t(job_id)
+WHERE CASE WHEN $5::integer = 0
+           THEN pg_advisory_unlock(job_id)
+           ELSE pg_advisory_unlock($5::integer, job_id::bit(32)::integer)
+      END
+`
+
+	// The read queries aren't prepared: %s stands for the columns that exist,
+	// see Client.readQuery.
+	sqlListJobs = `
+SELECT %s
+FROM que_jobs
+WHERE ($1::boolean OR queue = $2::text)
+AND ($3::text = '' OR job_class = $3::text)
+ORDER BY priority ASC, run_at ASC, job_id ASC
+LIMIT $4::bigint
+`
+
+	sqlGetJob = `
+SELECT %s
+FROM que_jobs
+WHERE job_id = $1::bigint
+`
+
+	sqlDeleteJobs = `
+DELETE FROM que_jobs
+WHERE ($1::boolean OR queue = $2::text)
+AND ($3::text = '' OR job_class = $3::text)
+`
+
+	sqlSetQueuePaused = `
+INSERT INTO que_queue_state (queue, paused)
+VALUES ($1::text, $2::boolean)
+ON CONFLICT (queue) DO UPDATE
+SET paused = EXCLUDED.paused, updated_at = now()
+`
+
+	sqlQueuePaused = `
+SELECT coalesce((SELECT paused FROM que_queue_state WHERE queue = $1::text), false)
+`
+
+	sqlPing = `
+SELECT 1 FROM que_jobs LIMIT 0
 `
 
 	sqlJobStats = `
 SELECT queue,
        job_class,
        count(*)                    AS count,
-       count(locks.job_id)         AS count_working,
+       count(locks.lock_key)       AS count_working,
        sum((error_count > 0)::int) AS count_errored,
        max(error_count)            AS highest_error_count,
        min(run_at)                 AS oldest_run_at
 FROM que_jobs
 LEFT JOIN (
-  SELECT (classid::bigint << 32) + objid::bigint AS job_id
+  SELECT DISTINCT CASE WHEN $1::integer = 0
+                       THEN (classid::bigint << 32) + objid::bigint
+                       ELSE objid::bigint
+                  END AS lock_key
   FROM pg_locks
   WHERE locktype = 'advisory'
-) locks USING (job_id)
+  AND CASE WHEN $1::integer = 0
+           THEN objsubid = 1
+           ELSE objsubid = 2 AND classid = $1::integer::oid
+      END
+) locks ON locks.lock_key = CASE WHEN $1::integer = 0 THEN job_id ELSE job_id & 4294967295 END
 GROUP BY queue, job_class
 ORDER BY count(*) DESC
+`
+
+	sqlJobTypes = `
+SELECT DISTINCT job_class
+FROM que_jobs
+WHERE queue = $1::text
+ORDER BY job_class
 `
 
 	sqlWorkerStates = `
@@ -147,5 +655,26 @@ JOIN (
   JOIN pg_stat_activity USING (pid)
   WHERE locktype = 'advisory'
 ) pg USING (job_id)
+`
+
+	sqlSetJobResult = `
+INSERT INTO que_job_results
+(job_id, job_class, result)
+VALUES
+($1::bigint, $2::text, $3::jsonb)
+ON CONFLICT (job_id) DO UPDATE
+SET result      = excluded.result,
+    finished_at = now()
+`
+
+	sqlJobResult = `
+SELECT result
+FROM que_job_results
+WHERE job_id = $1::bigint
+`
+
+	sqlPurgeJobResults = `
+DELETE FROM que_job_results
+WHERE finished_at < now() - $1::bigint * '1 microsecond'::interval
 `
 )
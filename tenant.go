@@ -0,0 +1,71 @@
+package que
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TenantKey is the SQL expression that gives the tenant of a Job, for Workers
+// that share a Queue fairly between tenants. Create one with NewTenantKey.
+type TenantKey struct {
+	sql  string
+	args []interface{}
+}
+
+// NewTenantKey returns a TenantKey with the SQL expression expr, whose
+// parameters $1, $2... are args, such as the tenant field of the Jobs' Args:
+//
+//	tk, err := que.NewTenantKey("args->>$1::text", "tenant_id")
+//
+// expr may refer to any column of que_jobs, unqualified, and its value is
+// compared as text; Jobs for which it is NULL share the tenant "". It follows
+// the same rules as the condition of a LockFilter.
+func NewTenantKey(expr string, args ...interface{}) (*TenantKey, error) {
+	if err := checkLockSQL("tenant key", expr, len(args)); err != nil {
+		return nil, err
+	}
+	return &TenantKey{sql: expr, args: args}, nil
+}
+
+// tenantDepth is the number of ready Jobs of each tenant the fair lock query
+// considers, and so the most Jobs of a single tenant that Workers with a
+// TenantKey work at once.
+const tenantDepth = 100
+
+// fairLockSQL returns the lock query that rotates between the tenants of the
+// Jobs, with the filter's condition if any, for the tables in schema. Its
+// parameters are those of the lock query, then the filter's, then the tenant
+// key's, then the last tenant a Job was locked for.
+func (tk *TenantKey) fairLockSQL(schema string, f *LockFilter) string {
+	offset := lockJobParams
+	if f != nil {
+		offset += len(f.args)
+	}
+	sql := f.apply(sqlLockJobFair)
+	sql = strings.Replace(sql, "$tenant_key", "("+renumberParams(tk.sql, offset)+")", -1)
+	sql = strings.Replace(sql, "$last_tenant", "$"+strconv.Itoa(offset+len(tk.args)+1), -1)
+	sql = strings.Replace(sql, "$tenant_depth", strconv.Itoa(tenantDepth), -1)
+	return qualifySQL(schema, sql)
+}
+
+// tenantCursor is the tenant of the last Job locked by a Worker, or by any of
+// the Workers of a WorkerPool, from which the next Job's tenant is chosen.
+type tenantCursor struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (tc *tenantCursor) get() string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	return tc.last
+}
+
+func (tc *tenantCursor) set(tenant string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.last = tenant
+}
@@ -0,0 +1,135 @@
+package que
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewTenantKey(t *testing.T) {
+	tk, err := NewTenantKey("args->>$1::text", "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql := tk.fairLockSQL("", nil)
+	if !strings.Contains(sql, "coalesce((args->>$9::text)::text, '')") {
+		t.Errorf("want tenant key after the lock query's parameters, got:\n%s", sql)
+	}
+	if got := strings.Count(sql, "$10::text"); got != 2 {
+		t.Errorf("want last tenant as $10, got %d in:\n%s", got, sql)
+	}
+
+	f, err := NewLockFilter("job_class = $1::text", "MyJob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql = tk.fairLockSQL("jobs", f)
+	if got := strings.Count(sql, "AND (job_class = $9::text)"); got != 2 {
+		t.Errorf("want filter in the candidates and the next run_at query, got %d in:\n%s", got, sql)
+	}
+	if !strings.Contains(sql, "coalesce((args->>$10::text)::text, '')") || strings.Count(sql, "$11::text") != 2 {
+		t.Errorf("want tenant key parameters after the filter's, got:\n%s", sql)
+	}
+	if strings.Contains(sql, "FROM que_jobs") {
+		t.Errorf("want qualified lock query, got:\n%s", sql)
+	}
+
+	for _, expr := range []string{"", "args->>'tenant'", "args->>$2", "(args->>$1"} {
+		if _, err := NewTenantKey(expr, "tenant"); err == nil {
+			t.Errorf("want error for %q", expr)
+		}
+	}
+}
+
+func TestWorkerTenantKey(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	// a flood from tenant a, enqueued before the Jobs of b and c
+	var jobs []*Job
+	for i := 0; i < 50; i++ {
+		jobs = append(jobs, &Job{Type: "MyJob", Args: []byte(`{"tenant":"a"}`)})
+	}
+	jobs = append(jobs,
+		&Job{Type: "MyJob", Args: []byte(`{"tenant":"b"}`)},
+		&Job{Type: "MyJob", Args: []byte(`{"tenant":"c"}`)},
+		&Job{Type: "MyJob", Args: []byte(`{"tenant":"b"}`)},
+	)
+	if err := c.EnqueueBatch(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	var worked []string
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		var args struct{ Tenant string }
+		if err := json.Unmarshal(j.Args, &args); err != nil {
+			return err
+		}
+		worked = append(worked, args.Tenant)
+		return nil
+	}})
+	var err error
+	if w.TenantKey, err = NewTenantKey("args->>$1::text", "tenant"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if !w.WorkOne() {
+			t.Fatalf("want job %d worked", i)
+		}
+	}
+
+	if got, want := fmt.Sprint(worked), "[a b c a b a]"; got != want {
+		t.Errorf("want tenants worked in turn %s, got %s", want, got)
+	}
+}
+
+func TestWorkerPoolTenantKeySingleTenant(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	const workers = 3
+	var jobs []*Job
+	for i := 0; i < workers; i++ {
+		jobs = append(jobs, &Job{Type: "MyJob", Args: []byte(`{"tenant":"a"}`)})
+	}
+	if err := c.EnqueueBatch(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	// every job waits for all of them to run at once, which needs the
+	// Workers to get past the first job of the tenant, locked by another
+	var started sync.WaitGroup
+	started.Add(workers)
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	wp := NewWorkerPool(c, WorkMap{"MyJob": func(j *Job) error {
+		started.Done()
+		select {
+		case <-all:
+			return nil
+		case <-time.After(10 * time.Second):
+			return errors.New("not run concurrently")
+		}
+	}}, workers)
+	wp.Interval = 10 * time.Millisecond
+	var err error
+	if wp.TenantKey, err = NewTenantKey("args->>$1::text", "tenant"); err != nil {
+		t.Fatal(err)
+	}
+	wp.Start()
+	defer wp.Shutdown()
+
+	select {
+	case <-all:
+	case <-time.After(10 * time.Second):
+		t.Fatal("want all jobs of the tenant running at once")
+	}
+}
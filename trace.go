@@ -0,0 +1,186 @@
+package que
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+)
+
+// TraceExtractor returns a context carrying the trace that a Job was enqueued
+// in, read from the Job, for instance from the traceparent stored by a
+// TraceInjector. It is called with a Job before its WorkFunc runs, and the
+// values of the context it returns are available from the Job's Context, so
+// that the WorkFunc's spans join the trace. Returning nil is like returning
+// context.Background(). See TraceparentExtractor.
+//
+// Only the values of the returned context are used: Job.Context is still
+// cancelled when the Worker shuts down, whatever the returned context's
+// deadline and cancellation.
+type TraceExtractor func(j *Job) context.Context
+
+// TraceInjector stores the trace of ctx in j before it is enqueued, so that a
+// TraceExtractor can continue it when the Job is worked. It is called by
+// Client.EnqueueContext. See TraceparentInjector.
+type TraceInjector func(ctx context.Context, j *Job) error
+
+// EnqueueContext is like Enqueue, but first stores the trace of ctx in j with
+// the Client's TraceInjector, if it has one. If the injector fails, the error
+// is logged and the Job is enqueued without the trace, so that tracing never
+// keeps a Job from being enqueued.
+func (c *Client) EnqueueContext(ctx context.Context, j *Job) error {
+	if c.TraceInjector != nil {
+		if err := c.TraceInjector(ctx, j); err != nil {
+			log.Printf("event=trace_inject_failed job_type=%s error=%q", j.Type, err)
+		}
+	}
+	return c.Enqueue(j)
+}
+
+// tracedContext is the context of a Job with trace values: it is done when
+// the Worker's context is, and looks up values in the trace's context first.
+type tracedContext struct {
+	context.Context
+	trace context.Context
+}
+
+func (c tracedContext) Value(key interface{}) interface{} {
+	if v := c.trace.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// withTrace returns ctx with the values of the trace extracted from j by
+// extract.
+func withTrace(ctx context.Context, j *Job, extract TraceExtractor) context.Context {
+	trace := extract(j)
+	if trace == nil {
+		return ctx
+	}
+	return tracedContext{Context: ctx, trace: trace}
+}
+
+// TraceparentKey is the key of the Args of a Job under which
+// TraceparentInjector stores the W3C traceparent of the trace the Job was
+// enqueued in. Only Args that are JSON objects can hold it, so WorkFuncs must
+// accept, or ignore, this extra field. DecodeInto drops it before decoding
+// with DisallowUnknownFields.
+const TraceparentKey = "_traceparent"
+
+// ErrArgsNotObject is returned by SetTraceparent if the Job's Args are not a
+// JSON object.
+var ErrArgsNotObject = errors.New("que: job args are not a JSON object")
+
+// traceparentRE matches a W3C traceparent of version 00, or a later version
+// that starts the same way.
+var traceparentRE = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}(-.*)?$`)
+
+// ValidTraceparent reports whether tp is a valid W3C traceparent, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ValidTraceparent(tp string) bool {
+	m := traceparentRE.FindStringSubmatch(tp)
+	if m == nil || m[1] == "ff" || m[1] == "00" && m[4] != "" {
+		return false
+	}
+	return m[2] != "00000000000000000000000000000000" && m[3] != "0000000000000000"
+}
+
+// SetTraceparent stores the W3C traceparent tp in the Job's Args, under
+// TraceparentKey. The Args must be a JSON object, or empty, in which case they
+// become an object holding only the traceparent.
+func SetTraceparent(j *Job, tp string) error {
+	args := map[string]json.RawMessage{}
+	if trimmed := bytes.TrimSpace(j.Args); len(trimmed) > 0 {
+		if trimmed[0] != '{' {
+			return ErrArgsNotObject
+		}
+		if err := json.Unmarshal(trimmed, &args); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(tp)
+	if err != nil {
+		return err
+	}
+	args[TraceparentKey] = b
+	j.Args, err = json.Marshal(args)
+	return err
+}
+
+// Traceparent returns the W3C traceparent stored in the Job's Args by
+// SetTraceparent, or "" if there is none or it isn't valid.
+func Traceparent(j *Job) string {
+	trimmed := bytes.TrimSpace(j.Args)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return ""
+	}
+	var args struct {
+		Traceparent string `json:"_traceparent"`
+	}
+	if err := json.Unmarshal(trimmed, &args); err != nil || !ValidTraceparent(args.Traceparent) {
+		return ""
+	}
+	return args.Traceparent
+}
+
+// withoutTraceparent returns args without their TraceparentKey field, which
+// would otherwise fail decoding with DisallowUnknownFields. Args that aren't a
+// JSON object holding the field are returned as they are.
+func withoutTraceparent(args []byte) []byte {
+	trimmed := bytes.TrimSpace(args)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"`+TraceparentKey+`"`)) {
+		return args
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return args
+	}
+	if _, ok := fields[TraceparentKey]; !ok {
+		return args
+	}
+	delete(fields, TraceparentKey)
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return args
+	}
+	return b
+}
+
+// TraceparentInjector returns a TraceInjector that stores the W3C traceparent
+// of ctx, as returned by get, in the Args of Jobs with SetTraceparent. get
+// adapts the tracing library in use, and returns "" if ctx has no trace. Jobs
+// whose Args are not JSON objects, such as the positional Args of Ruby Jobs,
+// are left as they are.
+func TraceparentInjector(get func(ctx context.Context) string) TraceInjector {
+	return func(ctx context.Context, j *Job) error {
+		tp := get(ctx)
+		if tp == "" {
+			return nil
+		}
+		if !ValidTraceparent(tp) {
+			return errors.New("que: invalid traceparent " + tp)
+		}
+		if err := SetTraceparent(j, tp); err != nil && err != ErrArgsNotObject {
+			return err
+		}
+		return nil
+	}
+}
+
+// TraceparentExtractor returns a TraceExtractor that reads the W3C
+// traceparent stored by TraceparentInjector and passes it to set, which
+// adapts the tracing library in use and returns a context carrying the
+// remote span it describes. set isn't called for Jobs without a valid
+// traceparent.
+func TraceparentExtractor(set func(ctx context.Context, traceparent string) context.Context) TraceExtractor {
+	return func(j *Job) context.Context {
+		tp := Traceparent(j)
+		if tp == "" {
+			return nil
+		}
+		return set(context.Background(), tp)
+	}
+}
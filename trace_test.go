@@ -0,0 +1,138 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type traceKey struct{}
+
+func TestValidTraceparent(t *testing.T) {
+	for tp, want := range map[string]bool{
+		testTraceparent: true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":       false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":       false,
+		"": false,
+	} {
+		if got := ValidTraceparent(tp); got != want {
+			t.Errorf("want ValidTraceparent(%q)=%v, got %v", tp, want, got)
+		}
+	}
+}
+
+func TestSetTraceparent(t *testing.T) {
+	for _, args := range []string{"", `{}`, `{"user_id":42}`} {
+		j := &Job{Args: []byte(args)}
+		if err := SetTraceparent(j, testTraceparent); err != nil {
+			t.Fatalf("args %q: %v", args, err)
+		}
+		if got := Traceparent(j); got != testTraceparent {
+			t.Errorf("args %q: want traceparent %q, got %q in %s", args, testTraceparent, got, j.Args)
+		}
+	}
+
+	j := &Job{Args: []byte(`{"user_id":42}`)}
+	if err := SetTraceparent(j, testTraceparent); err != nil {
+		t.Fatal(err)
+	}
+	var args struct {
+		UserID int `json:"user_id"`
+	}
+	if err := j.decodeArgs(&args); err != nil || args.UserID != 42 {
+		t.Errorf("want other args kept, got %+v, %v", args, err)
+	}
+
+	positional := &Job{Args: []byte(`[1,2]`)}
+	if err := SetTraceparent(positional, testTraceparent); err != ErrArgsNotObject {
+		t.Errorf("want ErrArgsNotObject, got %v", err)
+	}
+	if got := Traceparent(positional); got != "" {
+		t.Errorf("want no traceparent, got %q", got)
+	}
+}
+
+func TestTraceparentDisallowUnknownFields(t *testing.T) {
+	j := &Job{Args: []byte(`{"user_id":42}`)}
+	if err := SetTraceparent(j, testTraceparent); err != nil {
+		t.Fatal(err)
+	}
+	var args struct {
+		UserID int `json:"user_id"`
+	}
+	if err := DecodeInto(j, &args, DisallowUnknownFields); err != nil || args.UserID != 42 {
+		t.Errorf("want the traceparent ignored, got %+v, %v", args, err)
+	}
+
+	// other unknown fields still fail
+	j = &Job{Args: []byte(`{"user_id":42,"extra":1}`)}
+	if err := SetTraceparent(j, testTraceparent); err != nil {
+		t.Fatal(err)
+	}
+	var argsErr *ArgsError
+	if err := DecodeInto(j, &args, DisallowUnknownFields); !errors.As(err, &argsErr) || argsErr.Field != "extra" {
+		t.Errorf("want mismatch on field extra, got %v", err)
+	}
+}
+
+func TestTracedContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "worker", "w1"))
+	extract := TraceparentExtractor(func(ctx context.Context, tp string) context.Context {
+		return context.WithValue(ctx, traceKey{}, tp)
+	})
+
+	j := &Job{Args: []byte(`{}`)}
+	if got := withTrace(ctx, j, extract); got != ctx {
+		t.Error("want the Worker's context for a job without a trace")
+	}
+
+	if err := SetTraceparent(j, testTraceparent); err != nil {
+		t.Fatal(err)
+	}
+	traced := withTrace(ctx, j, extract)
+	if got := traced.Value(traceKey{}); got != testTraceparent {
+		t.Errorf("want trace value %q, got %v", testTraceparent, got)
+	}
+	if got := traced.Value("worker"); got != "w1" {
+		t.Errorf("want the Worker's context values, got %v", got)
+	}
+	cancel()
+	if traced.Err() == nil {
+		t.Error("want traced context cancelled with the Worker's")
+	}
+}
+
+func TestEnqueueContextTrace(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	c.TraceInjector = TraceparentInjector(func(ctx context.Context) string {
+		tp, _ := ctx.Value(traceKey{}).(string)
+		return tp
+	})
+	ctx := context.WithValue(context.Background(), traceKey{}, testTraceparent)
+	if err := c.EnqueueContext(ctx, &Job{Type: "MyJob", Args: []byte(`{"user_id":42}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got interface{}
+	w := NewWorker(c, WorkMap{"MyJob": func(j *Job) error {
+		got = j.Context().Value(traceKey{})
+		return nil
+	}})
+	w.TraceExtractor = TraceparentExtractor(func(ctx context.Context, tp string) context.Context {
+		return context.WithValue(ctx, traceKey{}, tp)
+	})
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+	if got != testTraceparent {
+		t.Errorf("want handler context to carry traceparent %q, got %v", testTraceparent, got)
+	}
+}
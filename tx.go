@@ -0,0 +1,102 @@
+package que
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Tx wraps a pgx.Tx so that side effects can be deferred until the transaction
+// has committed. Pass it to EnqueueInTx like any other pgx.Tx, and register the
+// actions that must only happen once the enqueued Job is durable (sending a
+// NOTIFY, updating a cache, emitting a metric) with AfterCommit:
+//
+//	tx := que.NewTx(pgxTx)
+//	defer tx.Rollback(ctx)
+//
+//	if err := qc.EnqueueInTx(j, tx); err != nil {
+//	    return err
+//	}
+//	tx.AfterCommit(func() { enqueued.Inc() })
+//
+//	return tx.Commit(ctx)
+//
+// The callbacks run, in the order they were registered, after Commit succeeds.
+// They are discarded without running if the transaction is rolled back or the
+// commit fails.
+type Tx struct {
+	pgx.Tx
+
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+// NewTx returns a Tx that wraps tx.
+func NewTx(tx pgx.Tx) *Tx {
+	return &Tx{Tx: tx}
+}
+
+// AfterCommit registers f to be called once the transaction has committed
+// successfully.
+func (tx *Tx) AfterCommit(f func()) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.afterCommit = append(tx.afterCommit, f)
+}
+
+// Commit commits the transaction and, if that succeeds, calls the functions
+// registered with AfterCommit.
+func (tx *Tx) Commit(ctx context.Context) error {
+	err := tx.Tx.Commit(ctx)
+	for _, f := range tx.takeAfterCommit() {
+		if err == nil {
+			f()
+		}
+	}
+	return err
+}
+
+// Rollback rolls back the transaction and discards the functions registered
+// with AfterCommit.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	tx.takeAfterCommit()
+	return tx.Tx.Rollback(ctx)
+}
+
+func (tx *Tx) takeAfterCommit() []func() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	fs := tx.afterCommit
+	tx.afterCommit = nil
+	return fs
+}
+
+// InTx runs fn in a new transaction, which it commits if fn returns nil and
+// rolls back otherwise. It implements the transactional outbox pattern with
+// que_jobs as the outbox: write the business records and enqueue the Jobs
+// that must follow from them with EnqueueInTx in fn, and either all of them
+// are committed or none are.
+//
+// Jobs enqueued in the transaction are not visible to Workers before it
+// commits, so a Job is never worked for changes that were rolled back, and a
+// committed Job is never lost. There is no separate relay: once committed, the
+// Jobs are in the queue. Note that Workers can lock the Jobs as soon as the
+// transaction commits, before InTx returns.
+//
+// Functions registered with tx.AfterCommit run once the commit succeeds.
+func (c *Client) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	pgxTx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	tx := NewTx(pgxTx)
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,187 @@
+package que
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrMissingUniqueKey is returned when you attempt to enqueue a unique job with
+// no UniqueKey specified.
+var ErrMissingUniqueKey = errors.New("job unique key must be specified")
+
+// EnqueueUnique adds a job to the queue unless a pending job with the same
+// UniqueKey already exists. It reports whether the job was inserted, and sets
+// the Job's ID if it was.
+//
+// Uniqueness is enforced by the partial unique index que_jobs_unique_key over
+// the unique_key column, created by schema.sql. Jobs are deleted once they are
+// worked, so a job with the same UniqueKey can be enqueued again as soon as the
+// previous one is done.
+func (c *Client) EnqueueUnique(j *Job) (bool, error) {
+	start := time.Now()
+	defer c.acquireEnqueueSlot()()
+	inserted, err := c.enqueueUnique(j)
+	c.observeEnqueue(j.Queue, j.Type, 1, start, err)
+	return inserted, err
+}
+
+// defaultUniqueTarget is the ON CONFLICT target of EnqueueUnique, which
+// matches the que_jobs_unique_key index.
+const defaultUniqueTarget = "(unique_key) WHERE unique_key IS NOT NULL"
+
+// UniqueTarget is the unique index or constraint that decides whether a Job
+// enqueued with EnqueueUniqueOn is a duplicate, as the conflict target of an
+// INSERT ... ON CONFLICT DO NOTHING. Create one with UniqueColumns or
+// UniqueConstraint.
+type UniqueTarget struct {
+	sql string
+}
+
+// UniqueColumns returns the UniqueTarget of the unique index over the columns
+// of que_jobs cols, for instance "job_class" and "routing_key" for at most one
+// pending job of each type per tenant. If the index is partial, its
+// predicate must be given with Where.
+func UniqueColumns(cols ...string) (*UniqueTarget, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("que: unique target needs at least one column")
+	}
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		if !schemaNameRE.MatchString(col) {
+			return nil, fmt.Errorf("que: invalid unique target column %q", col)
+		}
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	return &UniqueTarget{sql: "(" + strings.Join(quoted, ", ") + ")"}, nil
+}
+
+// UniqueConstraint returns the UniqueTarget of the unique constraint of
+// que_jobs called name. A constraint can't be partial, so the target can't
+// have a Where predicate.
+func UniqueConstraint(name string) (*UniqueTarget, error) {
+	if !schemaNameRE.MatchString(name) {
+		return nil, fmt.Errorf("que: invalid unique target constraint %q", name)
+	}
+	return &UniqueTarget{sql: "ON CONSTRAINT " + pgx.Identifier{name}.Sanitize()}, nil
+}
+
+// Where returns a copy of the UniqueTarget for a partial unique index whose
+// predicate is implied by pred, such as "routing_key IS NOT NULL". PostgreSQL
+// only picks a partial index as the conflict target if it can prove that from
+// pred. Like a LockFilter's condition, pred may not contain literals,
+// comments or semicolons; unlike it, it can't have parameters either.
+func (t *UniqueTarget) Where(pred string) (*UniqueTarget, error) {
+	if strings.HasPrefix(t.sql, "ON CONSTRAINT") {
+		return nil, fmt.Errorf("que: unique target %s can't have a predicate", t.sql)
+	}
+	if strings.TrimSpace(pred) == "" {
+		return nil, fmt.Errorf("que: empty unique target predicate")
+	}
+	if m := lockFilterForbidden.FindString(pred); m != "" {
+		return nil, fmt.Errorf("que: unique target predicate %q may not contain %q", pred, m)
+	}
+	if strings.Contains(pred, "$") {
+		return nil, fmt.Errorf("que: unique target predicate %q may not have parameters", pred)
+	}
+	if !balancedParens(pred) {
+		return nil, fmt.Errorf("que: unique target predicate %q has unbalanced parentheses", pred)
+	}
+	return &UniqueTarget{sql: t.sql + " WHERE " + pred}, nil
+}
+
+// EnqueueUniqueOn is like EnqueueUnique, but skips the job if it conflicts
+// with a pending job on target rather than on UniqueKey, for uniqueness
+// defined by other columns of que_jobs. The unique index or constraint of
+// target must exist: que doesn't create it, and enqueueing fails if
+// PostgreSQL finds no index matching target.
+//
+// The Job's UniqueKey is optional, and saved as NULL if empty so that it
+// doesn't conflict in que_jobs_unique_key. A Job that conflicts with a pending
+// job on any other unique index is an error.
+//
+// The statement depends on target, so it is not prepared.
+func (c *Client) EnqueueUniqueOn(j *Job, target *UniqueTarget) (bool, error) {
+	start := time.Now()
+	defer c.acquireEnqueueSlot()()
+	inserted, err := c.enqueueUniqueOn(j, target)
+	c.observeEnqueue(j.Queue, j.Type, 1, start, err)
+	return inserted, err
+}
+
+func (c *Client) enqueueUniqueOn(j *Job, target *UniqueTarget) (bool, error) {
+	if j.Type == "" {
+		return false, ErrMissingType
+	}
+	if err := c.checkRunAt(j); err != nil {
+		return false, err
+	}
+
+	sql := sqlInsertJobUnique
+	if c.Notify {
+		sql = sqlInsertJobUniqueNotify
+	}
+	sql = qualifySQL(c.schema, strings.Replace(sql, defaultUniqueTarget, target.sql, 1))
+
+	uniqueKey := pgtype.Text{String: j.UniqueKey, Status: pgtype.Null}
+	if j.UniqueKey != "" {
+		uniqueKey.Status = pgtype.Present
+	}
+	args, err := insertArgs(j, c.argsCompression)
+	if err != nil {
+		return false, err
+	}
+	args = append(args, uniqueKey)
+	return c.insertUnique(j, sql, args)
+}
+
+func (c *Client) enqueueUnique(j *Job) (bool, error) {
+	if j.Type == "" {
+		return false, ErrMissingType
+	}
+	if err := c.checkRunAt(j); err != nil {
+		return false, err
+	}
+	if j.UniqueKey == "" {
+		return false, ErrMissingUniqueKey
+	}
+
+	stmt := c.stmt("que_insert_job_unique")
+	if c.Notify {
+		stmt = c.stmt("que_insert_job_unique_notify")
+	}
+
+	args, err := insertArgs(j, c.argsCompression)
+	if err != nil {
+		return false, err
+	}
+	args = append(args, j.UniqueKey)
+	return c.insertUnique(j, stmt, args)
+}
+
+// insertUnique runs the unique insert statement or SQL sql, and sets the ID
+// of j if it inserted it.
+func (c *Client) insertUnique(j *Job, sql string, args []interface{}) (bool, error) {
+	var id int64
+	dest := []interface{}{&id}
+	if c.Notify {
+		// skip the result of pg_notify
+		dest = append(dest, nil)
+	}
+
+	err := c.pool.QueryRow(context.Background(), sql, args...).Scan(dest...)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	j.ID = id
+	return true, nil
+}
@@ -0,0 +1,78 @@
+package que
+
+import (
+	"context"
+	"sync"
+)
+
+// weightBudget is the weighted semaphore that caps the total weight of the
+// Jobs being worked by the Workers of a WorkerPool.
+type weightBudget struct {
+	mu      sync.Mutex
+	max     int64
+	used    int64
+	weights map[string]int64
+
+	// changed is closed, and replaced, whenever weight is released.
+	changed chan struct{}
+}
+
+func newWeightBudget() *weightBudget {
+	return &weightBudget{
+		weights: make(map[string]int64),
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *weightBudget) setWeight(typ string, weight int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if weight <= 0 {
+		delete(b.weights, typ)
+		return
+	}
+	b.weights[typ] = weight
+}
+
+// acquire waits until the budget allows a Job of type typ to run and takes
+// its weight, which must be released with the returned func. A Job heavier
+// than the whole budget runs once no other weighted Job is running. It
+// returns false, without taking anything, if ctx is done first.
+func (b *weightBudget) acquire(ctx context.Context, typ string) (release func(), ok bool) {
+	b.mu.Lock()
+	weight := b.weights[typ]
+	if weight == 0 || b.max <= 0 {
+		b.mu.Unlock()
+		return func() {}, true
+	}
+	for b.used > 0 && b.used+weight > b.max {
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, false
+		}
+		b.mu.Lock()
+	}
+	b.used += weight
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.used -= weight
+		close(b.changed)
+		b.changed = make(chan struct{})
+	}, true
+}
+
+// SetWeight declares the approximate cost, such as the memory used, of
+// working a Job of type typ, for MaxWeight. Types without a weight, or with a
+// weight of zero or less, are not limited by MaxWeight. It may be called while
+// the pool runs.
+func (w *WorkerPool) SetWeight(typ string, weight int64) {
+	w.weights.setWeight(typ, weight)
+}
@@ -0,0 +1,148 @@
+package que
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWeightBudget(t *testing.T) {
+	b := newWeightBudget()
+	b.max = 4
+	b.setWeight("Heavy", 3)
+	b.setWeight("Light", 1)
+
+	var (
+		wg        sync.WaitGroup
+		used, max int64
+	)
+	for i := 0; i < 40; i++ {
+		typ := "Light"
+		if i%3 == 0 {
+			typ = "Heavy"
+		}
+		wg.Add(1)
+		go func(typ string) {
+			defer wg.Done()
+			release, ok := b.acquire(context.Background(), typ)
+			if !ok {
+				t.Error("want acquired")
+				return
+			}
+			defer release()
+
+			weight := b.weights[typ]
+			now := atomic.AddInt64(&used, weight)
+			for {
+				m := atomic.LoadInt64(&max)
+				if now <= m || atomic.CompareAndSwapInt64(&max, m, now) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&used, -weight)
+		}(typ)
+	}
+	wg.Wait()
+
+	if max > 4 {
+		t.Errorf("want at most weight 4 in flight, got %d", max)
+	}
+	if b.used != 0 {
+		t.Errorf("want all weight released, got %d", b.used)
+	}
+}
+
+func TestWeightBudgetUnweightedAndOversized(t *testing.T) {
+	b := newWeightBudget()
+	b.max = 2
+	b.setWeight("Huge", 5)
+
+	// a job heavier than the budget runs alone
+	release, ok := b.acquire(context.Background(), "Huge")
+	if !ok {
+		t.Fatal("want oversized job admitted when nothing runs")
+	}
+	// unweighted jobs aren't held back
+	if _, ok := b.acquire(context.Background(), "Other"); !ok {
+		t.Error("want unweighted job admitted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := b.acquire(ctx, "Huge"); ok {
+		t.Error("want second oversized job to wait")
+	}
+	release()
+	if _, ok := b.acquire(context.Background(), "Huge"); !ok {
+		t.Error("want oversized job admitted after release")
+	}
+}
+
+func TestWorkerPoolMaxWeight(t *testing.T) {
+	c := openTestClientMaxConns(t, 10)
+	defer closePool(c.pool)
+
+	var (
+		mu        sync.Mutex
+		used, max int64
+		worked    int
+	)
+	work := func(weight int64) WorkFunc {
+		return func(j *Job) error {
+			mu.Lock()
+			used += weight
+			if used > max {
+				max = used
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			used -= weight
+			worked++
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	const jobs = 12
+	for i := 0; i < jobs; i++ {
+		typ := "Light"
+		if i%2 == 0 {
+			typ = "Heavy"
+		}
+		if err := c.Enqueue(&Job{Type: typ}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pool := NewWorkerPool(c, WorkMap{"Heavy": work(3), "Light": work(1)}, 6)
+	pool.Interval = 10 * time.Millisecond
+	pool.MaxWeight = 4
+	pool.SetWeight("Heavy", 3)
+	pool.SetWeight("Light", 1)
+	pool.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := worked == jobs
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	pool.Shutdown()
+
+	if worked != jobs {
+		t.Errorf("want %d jobs worked, got %d", jobs, worked)
+	}
+	if max > 4 {
+		t.Errorf("want at most weight 4 in flight, got %d", max)
+	}
+}
@@ -769,3 +769,307 @@ func TestJobErrorUpdate(t *testing.T) {
 	}
 
 }
+
+func TestLockJobPollBatchSize(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for i := 0; i < 2; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// hold the lock on the job at the head of the queue
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	j2, err := c.lockJob("", lockOptions{pollBatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j2 != nil {
+		j2.Done()
+		t.Fatalf("want no job when only the locked head is a candidate, got %+v", j2)
+	}
+
+	j2, err = c.lockJob("", lockOptions{pollBatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j2 == nil {
+		t.Fatal("want second job to be locked")
+	}
+	defer j2.Done()
+	if j2.ID == j.ID {
+		t.Errorf("want a different job than %d", j.ID)
+	}
+}
+
+func TestLockJobNextReady(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	next := time.Duration(-1)
+	j, err := c.lockJob("", lockOptions{next: &next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil || next != 0 {
+		t.Fatalf("want no job and next=0 on an empty queue, got %+v and %v", j, next)
+	}
+
+	for _, runAt := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(time.Minute)} {
+		if err := c.Enqueue(&Job{Type: "MyJob", RunAt: runAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Enqueue(&Job{Type: "MyJob", Queue: "other", RunAt: time.Now().Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = c.lockJob("", lockOptions{next: &next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		j.Done()
+		t.Fatalf("want no ready job, got %+v", j)
+	}
+	if next < 59*time.Second || next > time.Minute {
+		t.Errorf("want next job of the queue ready in about a minute, got %v", next)
+	}
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+	j, err = c.lockJob("", lockOptions{next: &next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want ready job locked")
+	}
+	defer j.Done()
+	if next != 0 {
+		t.Errorf("want next=0 when a job was locked, got %v", next)
+	}
+}
+
+func TestLockJobOrderSamePriorityAndRunAt(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	runAt := time.Now().Add(-time.Minute)
+	for i := 0; i < 20; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob", RunAt: runAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var worked []int64
+	w := NewWorker(c, WorkMap{
+		"MyJob": func(j *Job) error {
+			worked = append(worked, j.ID)
+			return nil
+		},
+	})
+	for w.WorkOne() {
+	}
+
+	if len(worked) != 20 {
+		t.Fatalf("want 20 jobs worked, got %d", len(worked))
+	}
+	for i := 1; i < len(worked); i++ {
+		if worked[i] <= worked[i-1] {
+			t.Fatalf("want jobs worked in enqueue order, got %v", worked)
+		}
+	}
+}
+
+func TestLockJobPartition(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for i := 0; i < 4; i++ {
+		if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for partition := 0; partition < 2; partition++ {
+		opts := lockOptions{partitions: 2, partition: partition}
+		for i := 0; i < 2; i++ {
+			j, err := c.lockJob("", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j == nil {
+				t.Fatalf("partition %d: wanted job, got none", partition)
+			}
+			if got := int(j.ID % 2); got != partition {
+				t.Errorf("want job in partition %d, got job %d", partition, j.ID)
+			}
+			if err := j.Delete(); err != nil {
+				t.Fatal(err)
+			}
+			j.Done()
+		}
+
+		j, err := c.lockJob("", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j != nil {
+			j.Done()
+			t.Errorf("partition %d: want no job left, got %d", partition, j.ID)
+		}
+	}
+}
+
+func TestReapStuck(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	// a job that was just locked isn't stuck
+	reaped, err := c.ReapStuck(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reaped != 0 {
+		t.Errorf("want 0 reaped, got %d", reaped)
+	}
+
+	if _, err := c.pool.Exec(context.Background(), "UPDATE que_jobs SET locked_at = now() - '1 hour'::interval"); err != nil {
+		t.Fatal(err)
+	}
+	reaped, err = c.ReapStuck(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reaped != 1 {
+		t.Errorf("want 1 reaped, got %d", reaped)
+	}
+
+	// the backend is terminated asynchronously, so wait for the lock to go
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j2, err := c.LockJob("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j2 != nil {
+			if j2.ID != j.ID {
+				t.Errorf("want job %d, got %d", j.ID, j2.ID)
+			}
+			j2.Done()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want stuck job to be lockable after reaping")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestLockJobSetsLockedAt(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	var lockedAt pgtype.Timestamptz
+	if err := c.pool.QueryRow(context.Background(), "SELECT locked_at FROM que_jobs").Scan(&lockedAt); err != nil {
+		t.Fatal(err)
+	}
+	if lockedAt.Status != pgtype.Present {
+		t.Error("want locked_at to be set")
+	}
+
+	if err := j.Error("failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.pool.QueryRow(context.Background(), "SELECT locked_at FROM que_jobs").Scan(&lockedAt); err != nil {
+		t.Fatal(err)
+	}
+	if lockedAt.Status == pgtype.Present {
+		t.Errorf("want locked_at cleared on error, got %v", lockedAt.Time)
+	}
+}
+
+func TestWorkerPrefersRoutedJobs(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	// find a routing key in each of two shards
+	keys := make(map[int]string)
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("cache-shard-%d", i)
+		var shard int
+		err := c.pool.QueryRow(context.Background(), "SELECT (hashtext($1) & 2147483647) % 2", key).Scan(&shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := keys[shard]; !ok {
+			keys[shard] = key
+		}
+	}
+
+	// the other shard's job is first in line
+	if err := c.Enqueue(&Job{Type: "Warm", Priority: 1, RoutingKey: keys[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&Job{Type: "Warm", Priority: 2, RoutingKey: keys[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	var worked []string
+	w := NewWorker(c, WorkMap{
+		"Warm": func(j *Job) error {
+			worked = append(worked, j.RoutingKey)
+			return nil
+		},
+	})
+	w.RoutingShards = 2
+	w.RoutingShard = 0
+
+	for i := 0; i < 2; i++ {
+		if !w.WorkOne() {
+			t.Fatal("want didWork=true")
+		}
+	}
+	// the Worker's own job first, then the fallback
+	if want := []string{keys[0], keys[1]}; len(worked) != 2 || worked[0] != want[0] || worked[1] != want[1] {
+		t.Errorf("want jobs worked in order %v, got %v", want, worked)
+	}
+}
@@ -2,6 +2,8 @@ package que
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,12 +11,61 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 // WorkFunc is a function that performs a Job. If an error is returned, the job
 // is reenqueued with exponential backoff.
 type WorkFunc func(j *Job) error
 
+// ErrSkip can be returned, possibly wrapped, by a WorkFunc to leave its Job
+// untouched for another worker or process. The Job's advisory lock is released without deleting,
+// erroring or rescheduling it, so it is immediately available again.
+//
+// To keep a Job that is always skipped from spinning, the Worker that skipped
+// it won't lock it again until its Interval has passed. Other Workers may lock
+// it right away.
+var ErrSkip = errors.New("que: skip job")
+
+// ErrNotHandled can be returned, possibly wrapped, by a WorkFunc that
+// recognizes its Job's type but can't handle this Job in this process, for
+// instance because it needs a runtime or configuration that only a Ruby worker
+// or another deployment has. Its Job is released like with ErrSkip: untouched,
+// without an error or backoff, so that another worker can take it, and the
+// Worker that returned it won't lock it again until its Interval has passed.
+//
+// Use ErrSkip when this Worker could work the Job, just not right now, and
+// ErrNotHandled when this Worker is the wrong one for it. The two differ in
+// how they are logged: ErrNotHandled with event=job_not_handled and the
+// wrapping error's message, which tells why.
+var ErrNotHandled = errors.New("que: job not handled by this worker")
+
+// Permanent marks err as not worth retrying. When a WorkFunc returns an error
+// wrapped with Permanent, its Job is moved to the dead-letter table instead of
+// being rescheduled with backoff. Permanent returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// IsPermanent reports whether err, or any error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
 // WorkMap is a map of Job names to WorkFuncs that are used to perform Jobs of a
 // given type.
 type WorkMap map[string]WorkFunc
@@ -23,15 +74,288 @@ type WorkMap map[string]WorkFunc
 // is found, the Worker will sleep for Interval seconds.
 type Worker struct {
 	// Interval is the amount of time that this Worker should sleep before trying
-	// to find another Job.
+	// to find another Job. If a Job of the Queue is scheduled to become ready
+	// sooner, the Worker sleeps until then instead: the query that finds no
+	// Job to lock also returns when the next one is due.
 	Interval time.Duration
 
 	// Queue is the name of the queue to pull Jobs off of. The default value, "",
 	// is usable and is the default for both que and the ruby que library.
 	Queue string
 
-	c *Client
-	m WorkMap
+	// PollBatchSize is the maximum number of candidate Jobs the Worker tries to
+	// lock each time it polls the Queue. Candidates are tried in order until
+	// one is locked, so the limit only matters when the Jobs at the head of
+	// the Queue are already locked by other Workers. A small value bounds the
+	// work done by each poll at the cost of polling again (after Interval) when
+	// all candidates were taken; a large value finds a Job in a single
+	// round-trip under heavy contention. A reasonable starting point is the
+	// number of Workers sharing the Queue, plus one. The default, zero, means
+	// no limit.
+	PollBatchSize int
+
+	// Partitions and Partition restrict the Worker to a slice of the Queue:
+	// if Partitions is greater than one, the Worker only locks Jobs whose ID
+	// modulo Partitions equals Partition. Giving each Worker sharing a Queue
+	// its own Partition keeps them from contending for the same Jobs at the
+	// head of the Queue. The cost is load balancing: a Job waits for the
+	// Worker of its partition even while other Workers are idle, and a
+	// partition without a Worker is never worked. See WorkerPool.Affinity.
+	Partitions int
+	Partition  int
+
+	// RoutingShards and RoutingShard declare that the Worker owns a shard of
+	// the Jobs' RoutingKeys, for instance because it holds a local cache of
+	// that shard's data: if RoutingShards is greater than one, a Job belongs
+	// to the shard given by PostgreSQL's hashtext(RoutingKey) modulo
+	// RoutingShards, ignoring the sign bit. The Worker first polls for Jobs of
+	// its own RoutingShard and, if there are none, falls back to any Job.
+	//
+	// This is a soft affinity: a Job is worked by another Worker whenever that
+	// Worker runs out of Jobs of its own shard first, and a Job without a
+	// RoutingKey may be worked by any Worker. Use Partitions for a hard
+	// assignment.
+	RoutingShards int
+	RoutingShard  int
+
+	// MaxPanics is the number of times a Job may panic before it is considered
+	// poisonous and moved to the dead-letter table, where it can be listed
+	// with Client.DeadJobs. Panics are counted separately from other errors.
+	// Zero or less disables quarantining. The default is 3.
+	MaxPanics int
+
+	// RetryPolicy decides how long a Job that failed waits before it is
+	// retried. The default is RubyQueBackoff.
+	RetryPolicy RetryPolicy
+
+	// RetryCooldown keeps a Job that just failed from being locked again by
+	// the same Worker for that long, even if its RetryPolicy makes it ready
+	// sooner. It keeps a Job that fails instantly with a short backoff from
+	// monopolizing the Worker, which works other Jobs in the meantime. Other
+	// Workers may still lock the Job. At most 1000 Jobs are cooled down at a
+	// time. The default, zero, disables the cooldown.
+	RetryCooldown time.Duration
+
+	// ErrorBatchWindow makes the Worker save the errors of failed Jobs in
+	// batches rather than one by one, which eases the load on the database
+	// when many Jobs fail at once, such as during the outage of a service they
+	// depend on. The Worker keeps the failed Jobs locked and saves their
+	// errors, and their next RunAt, with a single statement at least every
+	// ErrorBatchWindow, whenever 100 are pending, and whenever it runs out of
+	// Jobs. A failed Job's backoff starts when its error is saved.
+	//
+	// If the process crashes within the window, the pending errors are lost:
+	// the Jobs are unlocked with their previous ErrorCount and RunAt, and
+	// worked again as if they hadn't failed. Like AckBatched, it keeps a
+	// connection from the pool for as long as the Worker runs. Panics are
+	// always saved right away. The default, zero, disables batching.
+	ErrorBatchWindow time.Duration
+
+	// DetectGoroutineLeaks makes the Worker count the goroutines before and
+	// after each WorkFunc, to find WorkFuncs that start goroutines that
+	// outlive their Job. The difference is reported in
+	// JobStats.GoroutineDelta, and a warning with event=goroutine_leak is
+	// logged when the Jobs of a type grew the number of goroutines by more
+	// than one per two Jobs, on average over 100 Jobs. This is a heuristic,
+	// not a guarantee: goroutines started or stopped concurrently by other
+	// Workers and the rest of the process skew the counts, and goroutines
+	// that exit shortly after their Job are counted as leaked. It adds a
+	// little overhead to every Job. The default is off.
+	DetectGoroutineLeaks bool
+
+	// MaxJobsBeforeRecycle and MaxConnAge make the Worker recycle the
+	// connection it keeps from the pool, with AckBatched or ErrorBatchWindow,
+	// after it locked that many Jobs on it or held it for that long: the
+	// Worker flushes its pending batches, closes the connection, and opens a
+	// new one from the pool before locking the next Job. This bounds the
+	// state a long-lived connection accumulates, like the pool's
+	// MaxConnLifetime does for idle ones. Recycling only happens between
+	// Jobs. Workers that don't keep a connection take a fresh one from the
+	// pool for every Job, so the settings have no effect on them. The
+	// defaults, zero, disable recycling.
+	MaxJobsBeforeRecycle int
+	MaxConnAge           time.Duration
+
+	// Stats, if set, is called with the outcome of every Job the Worker works.
+	// It is called synchronously, so it should return quickly.
+	Stats func(JobStats)
+
+	// Labels, if set, is called for every Job the Worker works to set the
+	// Labels of its JobStats, such as the tenant or region a Job is for. See
+	// LabelFunc.
+	Labels LabelFunc
+
+	// TraceExtractor, if set, continues the trace each Job was enqueued in,
+	// in the context returned by the Job's Context method. See
+	// TraceparentExtractor.
+	TraceExtractor TraceExtractor
+
+	// DuplicateWindow enables the detection of duplicate executions, which
+	// que's at-least-once delivery allows: for that long after a Job was
+	// worked, the Worker remembers its ID and attempt, and if it runs the
+	// WorkFunc of a Job that was already completed, or of an attempt whose
+	// outcome was already recorded, it logs it and counts it in
+	// TypeMetrics.Duplicates. Only executions by the same Worker, or the same
+	// WorkerPool, are detected. It must be set before the Worker is started.
+	// The default, zero, disables tracking.
+	DuplicateWindow time.Duration
+
+	// Ack is how the Worker acknowledges completed Jobs: AckImmediate, the
+	// default, AckBatched or AckOnCommit. It must not be changed while the
+	// Worker is working.
+	Ack AckMode
+
+	// CancelCheckInterval enables cancelling running Jobs from any process
+	// with Client.RequestCancel: while a Job runs, the Worker checks every
+	// CancelCheckInterval whether its cancellation was requested, and if so
+	// cancels the context returned by the Job's Context method. Only
+	// WorkFuncs that watch that context can be cancelled. A cancelled
+	// WorkFunc that returns an error has its Job moved to the dead-letter
+	// table; one that returns nil completes its Job as usual, unless
+	// TreatCancelledSuccessAsRetry is set. Each check uses a connection from
+	// the pool. The default, zero, disables checking.
+	CancelCheckInterval time.Duration
+
+	// TreatCancelledSuccessAsRetry makes the Worker distrust a WorkFunc that
+	// returns nil after the context returned by its Job's Context method was
+	// cancelled, because the Worker is shutting down or the Job's
+	// cancellation was requested. Such a WorkFunc may have cut its work short
+	// without reporting it, so instead of completing the Job, the Worker
+	// records an error on it to be retried like any failed Job, or moves it
+	// to the dead-letter table if its cancellation was requested. A Job the
+	// WorkFunc finalized itself, for instance with Delete, or rescheduled
+	// with Reschedule, as BatchJob does when it stops early, is left as it is.
+	//
+	// WorkFuncs should return ctx.Err(), or an error wrapping it, when they
+	// stop because their context is cancelled, and nil only once their work
+	// is done; this guards against those that don't. The default is off.
+	TreatCancelledSuccessAsRetry bool
+
+	// SingleFlight, if set, returns the single-flight key of a Job, such as
+	// "recalculate-balance:account-7", or "" if the Job has none. Jobs with
+	// the same key are never worked at the same time by Workers of the same
+	// WorkerPool: a Worker that locks a Job whose key is busy releases it
+	// like ErrSkip, and works other Jobs in the meantime. See
+	// SingleFlightAcrossProcesses for other processes.
+	SingleFlight func(*Job) string
+
+	// Admit, if set, is called with every Job the Worker locks, before it
+	// runs, to decide from live conditions such as a feature flag, a
+	// maintenance mode or the Job's Args whether to run it (AdmitRun),
+	// release it to be worked again later like ErrSkip (AdmitSkip), or move
+	// it to the dead-letter table (AdmitDeadLetter), with the error, if any,
+	// as its last error. If Admit returns an error with any other decision,
+	// the Job is released like with AdmitSkip and the error is logged.
+	//
+	// Unlike wrapping a WorkFunc, which can only run code around the Job,
+	// Admit decides whether the Job runs at all, and how it is finished if
+	// not. It is called before SingleFlight, duplicate tracking and the
+	// WorkerPool's MaxWeight, so Jobs it turns away never hold a
+	// single-flight key or weight. Jobs turned away are not counted in the
+	// Worker's Metrics, except dead-lettered ones, which count as failed. It
+	// delays the Job, so it should return quickly.
+	Admit func(*Job) (AdmitDecision, error)
+
+	// Optimistic, if set, returns the lease of a Job to run it
+	// optimistically, or zero to run it as usual. The Worker runs a Job while
+	// holding its advisory lock and a connection from the pool, so a pool of
+	// N connections runs at most N Jobs at once. An optimistic Job is instead
+	// leased: its RunAt is pushed lease into the future, its lock is released
+	// and its connection is returned to the pool before its WorkFunc runs.
+	// Once the WorkFunc returns, the Worker takes a connection again to
+	// finish the Job as usual: deleting it if it succeeded, or recording the
+	// error to retry it later if it failed. Short, I/O-bound Jobs can then
+	// run on many more Workers than the pool has connections. To run every
+	// Job of the Worker's Queue optimistically, return the same lease for all
+	// of them; to pick job types, switch on the Job's Type.
+	//
+	// This weakens the delivery guarantee: a leased Job is not locked, so if
+	// its WorkFunc runs longer than the lease, or the process dies while it
+	// runs, the Job is worked again by another Worker once the lease
+	// expires. Only use it for idempotent Jobs that run well within their
+	// lease, for which an occasional duplicate run is acceptable. The
+	// WorkFunc of a leased Job has no connection: its Conn method returns
+	// nil, and the Job's methods that use the connection, such as Delete,
+	// Error, Checkpoint, Advance or SetResult, return ErrNoConn; Reschedule and
+	// EnqueueFollowups work as usual. Client.RequestCancel reports leased
+	// Jobs as not running. Optimistic is ignored with AckOnCommit, whose
+	// transaction needs the connection, and for Jobs holding a
+	// SingleFlightAcrossProcesses key, whose lock is held on the connection.
+	Optimistic func(*Job) (lease time.Duration)
+
+	// SingleFlightAcrossProcesses extends SingleFlight to all processes by
+	// also taking a PostgreSQL advisory lock on a hash of the key for as long
+	// as the Job runs. The guarantee holds for any number of processes as
+	// long as they all set it. Distinct keys whose hashes collide are
+	// serialized too, which is safe but may delay them.
+	SingleFlightAcrossProcesses bool
+
+	// PauseCheckInterval makes the Worker honor Client.PauseQueue: before
+	// locking a Job, it checks whether its Queue is paused, and if so doesn't
+	// lock any. The flag is read from the database at most once every
+	// PauseCheckInterval, which bounds how long pausing and resuming take to
+	// reach the Worker. The que_queue_state table must exist. The default,
+	// zero, disables checking.
+	PauseCheckInterval time.Duration
+
+	// LockFilter, if set, restricts the Jobs the Worker locks to those that
+	// satisfy its condition. See NewLockFilter.
+	LockFilter *LockFilter
+
+	// TenantKey, if set, makes the Worker share its Queue fairly between the
+	// tenants of the Jobs, as given by the TenantKey, so that a tenant that
+	// enqueues a flood of Jobs doesn't hold up the Jobs of the others. Rather
+	// than the first ready Job by Priority and RunAt, the Worker locks the
+	// first ready Job of the tenant that follows, in text order, the tenant of
+	// the last Job it locked, wrapping around. If that Job is locked by
+	// another Worker, it tries the first Jobs of the other tenants, then the
+	// second Job of every tenant, and so on. Every tenant with ready Jobs
+	// gets the same share of the Worker; Priority and RunAt only order the
+	// Jobs of each tenant. The Workers of a WorkerPool take turns together.
+	// Only the first 100 ready Jobs of each tenant are considered, so at most
+	// 100 Jobs of a single tenant are worked at once by all Workers with a
+	// TenantKey.
+	//
+	// Each poll reads all of the ready Jobs of the Queue to find those of
+	// every tenant, so it gets slower as the backlog grows. An index on
+	// que_jobs of (queue, tenant key expression, priority, run_at, job_id)
+	// helps. See NewTenantKey.
+	TenantKey *TenantKey
+
+	c             *Client
+	ackConn       *pgxpool.Conn
+	ackConnSince  time.Time
+	ackConnJobs   int
+	acks          []ackedJob
+	acksSince     time.Time
+	failures      []failedJob
+	failuresSince time.Time
+	duplicates    *duplicates
+	leaks         *leakDetector
+	weights       *weightBudget
+	pause         *pauseCache
+	singleFlight  *singleFlight
+	tenants       *tenantCursor
+	state         workerState
+	m             WorkMap
+	metrics       *metrics
+
+	// wake, if not nil, receives a value when a Job that may be worked was
+	// just enqueued.
+	wake <-chan struct{}
+
+	// nextReady is how long until the next Job of the Queue becomes ready, as
+	// of the last poll that found no Job, or zero if unknown.
+	nextReady time.Duration
+
+	// skipped holds the IDs of the Jobs recently skipped with ErrSkip or
+	// cooling down after failing, and when they may be locked again.
+	skipped map[int64]time.Time
+
+	// ctx is passed on to the Jobs being worked, and cancel cancels it when
+	// shutdown starts.
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	mu   sync.Mutex
 	done bool
@@ -40,6 +364,8 @@ type Worker struct {
 
 var defaultWakeInterval = 5 * time.Second
 
+const defaultMaxPanics = 3
+
 func init() {
 	if v := os.Getenv("QUE_WAKE_INTERVAL"); v != "" {
 		if newInt, err := strconv.Atoi(v); err == nil {
@@ -58,12 +384,18 @@ func init() {
 // these settings can be changed on the returned Worker before it is started
 // with Work().
 func NewWorker(c *Client, m WorkMap) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Worker{
-		Interval: defaultWakeInterval,
-		Queue:    os.Getenv("QUE_QUEUE"),
-		c:        c,
-		m:        m,
-		ch:       make(chan struct{}),
+		Interval:  defaultWakeInterval,
+		Queue:     os.Getenv("QUE_QUEUE"),
+		MaxPanics: defaultMaxPanics,
+		c:         c,
+		m:         m,
+		metrics:   newMetrics(),
+		skipped:   make(map[int64]time.Time),
+		ctx:       ctx,
+		cancel:    cancel,
+		ch:        make(chan struct{}),
 	}
 }
 
@@ -71,6 +403,7 @@ func NewWorker(c *Client, m WorkMap) *Worker {
 // returns after Shutdown() is called, so it should be run in its own goroutine.
 func (w *Worker) Work() {
 	defer log.Println("worker done")
+	defer w.releaseAckConn()
 	for {
 		// Try to work a job
 		if w.WorkOne() {
@@ -82,19 +415,74 @@ func (w *Worker) Work() {
 				// continue in loop
 			}
 		} else {
-			// No work found, block until exit or timer expires
+			// No work found, acknowledge what was done so far and block until
+			// exit or timer expires
+			w.Flush()
 			select {
 			case <-w.ch:
 				return
-			case <-time.After(w.Interval):
+			case <-time.After(w.pollWait()):
 				// continue in loop
+			case <-w.wake:
+				// a job was enqueued, continue in loop
 			}
 		}
 	}
 }
 
+// pollWait returns how long to wait before polling again after finding no
+// Job: until the next Job becomes ready if that's sooner than the Interval.
+// Jobs enqueued in the meantime by processes that don't notify the Worker are
+// picked up within the Interval as usual.
+func (w *Worker) pollWait() time.Duration {
+	if w.nextReady > 0 && w.nextReady < w.Interval {
+		return w.nextReady
+	}
+	return w.Interval
+}
+
 func (w *Worker) WorkOne() (didWork bool) {
-	j, err := w.c.LockJob(w.Queue)
+	w.nextReady = 0
+	if w.flushDue() {
+		w.Flush()
+	}
+	if w.recycleDue() {
+		w.recycleAckConn()
+	}
+	if w.queuePaused() {
+		return
+	}
+	conn, err := w.ackBatchConn()
+	if err != nil {
+		log.Printf("attempting to acquire connection: %v", err)
+		return
+	}
+
+	opts := lockOptions{
+		exclude:       w.pendingIDs(w.skippedIDs()),
+		pollBatchSize: w.PollBatchSize,
+		partitions:    w.Partitions,
+		partition:     w.Partition,
+		filter:        w.LockFilter,
+		next:          &w.nextReady,
+		conn:          conn,
+	}
+	if w.TenantKey != nil {
+		if w.tenants == nil {
+			w.tenants = &tenantCursor{}
+		}
+		opts.tenant, opts.lastTenant = w.TenantKey, w.tenants.get()
+	}
+	var j *Job
+	if w.RoutingShards > 1 {
+		// prefer the Jobs routed to this Worker's shard
+		routed := opts
+		routed.routingShards, routed.routingShard = w.RoutingShards, w.RoutingShard
+		j, err = w.c.lockJob(w.Queue, routed)
+	}
+	if j == nil && err == nil {
+		j, err = w.c.lockJob(w.Queue, opts)
+	}
 	if err != nil {
 		log.Printf("attempting to lock job: %v", err)
 		return
@@ -102,8 +490,73 @@ func (w *Worker) WorkOne() (didWork bool) {
 	if j == nil {
 		return // no job was available
 	}
+	if w.TenantKey != nil {
+		w.tenants.set(j.tenant)
+	}
+	if conn != nil {
+		w.ackConnJobs++
+	}
 	defer j.Done()
-	defer recoverPanic(j)
+	w.state.set(j)
+	defer w.state.set(nil)
+	j.ctx = w.ctx
+	if w.TraceExtractor != nil {
+		j.ctx = withTrace(j.ctx, j, w.TraceExtractor)
+	}
+	if w.CancelCheckInterval > 0 {
+		var cancel context.CancelFunc
+		j.ctx, cancel = context.WithCancel(j.ctx)
+		defer w.watchCancel(j, cancel)()
+	}
+	j.retryPolicy = w.RetryPolicy
+
+	if !w.admit(j) {
+		return true
+	}
+
+	// the single-flight lock across processes lives on the Job's connection,
+	// which it must keep
+	var flightLocked bool
+	if w.SingleFlight != nil {
+		if key := w.SingleFlight(j); key != "" {
+			release, ok := w.lockSingleFlight(j, key)
+			if !ok {
+				w.skip(j)
+				log.Printf("event=job_single_flight_busy job_id=%d job_type=%s key=%q", j.ID, j.Type, key)
+				return true
+			}
+			defer release()
+			flightLocked = w.SingleFlightAcrossProcesses
+		}
+	}
+
+	if w.DuplicateWindow > 0 && w.duplicates == nil {
+		w.duplicates = newDuplicates(w.DuplicateWindow)
+	}
+	if w.duplicates != nil && w.duplicates.started(j) {
+		j.duplicate = true
+		log.Printf("event=job_duplicate job_id=%d job_type=%s error_count=%d", j.ID, j.Type, j.ErrorCount)
+	}
+	if w.weights != nil {
+		release, ok := w.weights.acquire(w.ctx, j.Type)
+		if !ok {
+			// shutting down: leave the Job to be worked again
+			w.skip(j)
+			log.Printf("event=job_weight_wait_cancelled job_id=%d job_type=%s", j.ID, j.Type)
+			return
+		}
+		defer release()
+	}
+	if lease := w.optimisticLease(j); lease > 0 && !flightLocked {
+		if err := j.lease(lease); err != nil {
+			if err != pgx.ErrNoRows {
+				log.Printf("attempting to lease job %d: %v", j.ID, err)
+			}
+			return
+		}
+	}
+	start := time.Now()
+	defer w.recoverPanic(j, start)
 
 	didWork = true
 
@@ -111,47 +564,229 @@ func (w *Worker) WorkOne() (didWork bool) {
 	if !ok {
 		msg := fmt.Sprintf("unknown job type: %q", j.Type)
 		log.Println(msg)
-		if err = j.Error(msg); err != nil {
+		if err = j.reacquire(); err == nil {
+			err = j.Error(msg)
+		}
+		if err != nil {
 			log.Printf("attempting to save error on job %d: %v", j.ID, err)
 		}
+		w.cooldown(j)
+		w.observe(j, start, errors.New(msg))
 		return
 	}
 
-	if err = wf(j); err != nil {
-		j.Error(err.Error())
+	if w.Ack.kind == ackOnCommit {
+		tx, err := j.conn.Begin(context.Background())
+		if err != nil {
+			log.Printf("attempting to begin transaction for job %d: %v", j.ID, err)
+			return
+		}
+		j.tx = tx
+	}
+
+	var goroutines int
+	if w.DetectGoroutineLeaks {
+		goroutines = runtime.NumGoroutine()
+	}
+	err = wf(j)
+	if err := j.reacquire(); err != nil {
+		log.Printf("attempting to reacquire connection for job %d: %v", j.ID, err)
+		return
+	}
+	if w.DetectGoroutineLeaks {
+		j.goroutineDelta = runtime.NumGoroutine() - goroutines
+		if w.leaks == nil {
+			w.leaks = newLeakDetector()
+		}
+		w.leaks.observe(j.Type, j.goroutineDelta)
+	}
+	if err == nil && w.TreatCancelledSuccessAsRetry && j.Context().Err() != nil && !j.reschedule && !j.isFinalized() {
+		// the WorkFunc may have ignored the cancellation and not finished
+		log.Printf("event=job_cancelled_success_retried job_id=%d job_type=%s", j.ID, j.Type)
+		err = fmt.Errorf("que: WorkFunc returned nil after its context was cancelled: %w", j.Context().Err())
+	}
+	if err != nil {
+		j.rollback()
+	}
+	if err != nil && !errors.Is(err, ErrSkip) && !errors.Is(err, ErrNotHandled) && j.cancelRequested() {
+		// the WorkFunc gave up because it was asked to
+		log.Printf("event=job_cancelled job_id=%d job_type=%s", j.ID, j.Type)
+		err = Permanent(fmt.Errorf("cancelled by request: %w", err))
+	}
+	if errors.Is(err, ErrSkip) {
+		w.skip(j)
+		log.Printf("event=job_skipped job_id=%d job_type=%s", j.ID, j.Type)
+		return
+	} else if errors.Is(err, ErrNotHandled) {
+		w.skip(j)
+		log.Printf("event=job_not_handled job_id=%d job_type=%s reason=%q", j.ID, j.Type, err)
+		return
+	} else if IsPermanent(err) {
+		if derr := j.DeadLetter(err.Error()); derr != nil {
+			log.Printf("attempting to dead-letter job %d: %v", j.ID, derr)
+		}
+		log.Printf("event=job_dead_lettered job_id=%d job_type=%s", j.ID, j.Type)
+		w.observe(j, start, err)
+		return
+	} else if err != nil {
+		if w.ErrorBatchWindow > 0 {
+			err := w.errorLater(j, err.Error())
+			if err != nil {
+				log.Printf("attempting to save error on job %d: %v", j.ID, err)
+			}
+		} else {
+			j.Error(err.Error())
+		}
+		w.cooldown(j)
+		w.observe(j, start, err)
+		return
+	}
+	w.observe(j, start, nil)
+
+	if w.Ack.kind == ackBatched && !j.reschedule && len(j.followups) == 0 {
+		w.ackLater(j)
+		log.Printf("event=job_worked job_id=%d job_type=%s", j.ID, j.Type)
 		return
 	}
 
 	if err = j.Finalize(); err != nil {
 		log.Printf("attempting to finalize job %d: %v", j.ID, err)
 	}
+	if err = j.commit(); err != nil {
+		log.Printf("attempting to commit job %d: %v", j.ID, err)
+	}
 
 	log.Printf("event=job_worked job_id=%d job_type=%s", j.ID, j.Type)
 	return
 }
 
+// skip releases j without working it, and keeps the Worker from locking it
+// again until its Interval has passed.
+func (w *Worker) skip(j *Job) {
+	if err := j.clearLockedAt(); err != nil {
+		log.Printf("attempting to skip job %d: %v", j.ID, err)
+	}
+	w.skipped[j.ID] = time.Now().Add(w.Interval)
+	if w.duplicates != nil {
+		w.duplicates.forget(j)
+	}
+}
+
+// maxCooldownJobs bounds the number of failed Jobs a Worker cools down at a
+// time, and so the number of IDs it excludes when polling.
+const maxCooldownJobs = 1000
+
+// cooldown keeps the Worker from locking j, which just failed, again until
+// its RetryCooldown has passed.
+func (w *Worker) cooldown(j *Job) {
+	if w.RetryCooldown <= 0 || len(w.skipped) >= maxCooldownJobs {
+		return
+	}
+	until := time.Now().Add(w.RetryCooldown)
+	if until.After(w.skipped[j.ID]) {
+		w.skipped[j.ID] = until
+	}
+}
+
+// skippedIDs returns the IDs of the Jobs that were skipped too recently to be
+// locked again, forgetting those whose cooldown has passed.
+func (w *Worker) skippedIDs() []int64 {
+	if len(w.skipped) == 0 {
+		return nil
+	}
+	now := time.Now()
+	ids := make([]int64, 0, len(w.skipped))
+	for id, until := range w.skipped {
+		if now.After(until) {
+			delete(w.skipped, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// observe records the outcome of working j in the Worker's metrics and sends
+// it to the Stats func.
+func (w *Worker) observe(j *Job, start time.Time, err error) {
+	s := JobStats{
+		ID:          j.ID,
+		Queue:       j.Queue,
+		Type:        j.Type,
+		PickupDelay: j.pickupDelay,
+		Duration:    time.Since(start),
+		Err:         err,
+		Duplicate:   j.duplicate,
+
+		GoroutineDelta: j.goroutineDelta,
+	}
+	if w.duplicates != nil {
+		w.duplicates.finished(j, err == nil)
+	}
+	w.metrics.observe(s)
+	if w.Stats != nil {
+		if w.Labels != nil {
+			s.Labels = w.Labels(j)
+		}
+		w.Stats(s)
+	}
+}
+
+// Metrics returns the per-type outcomes of the Jobs worked since the previous
+// call to Metrics, and resets them.
+func (w *Worker) Metrics() Metrics {
+	return w.metrics.snapshot()
+}
+
 // Shutdown tells the worker to finish processing its current job and then stop.
-// There is currently no timeout for in-progress jobs. This function blocks
-// until the Worker has stopped working. It should only be called on an active
-// Worker.
+// There is no timeout for in-progress jobs. This function blocks until the
+// Worker has stopped working. It should only be called on an active Worker.
 func (w *Worker) Shutdown() {
+	w.ShutdownContext(context.Background())
+}
+
+// ShutdownContext is like Shutdown, but gives up waiting for the current job
+// when ctx is done.
+//
+// Shutting down happens in two steps. First, the context returned by the
+// current Job's Context method is cancelled as soon as ShutdownContext is
+// called: this asks the WorkFunc to wrap up, e.g. by saving its progress and
+// returning, and the job is then finished as usual. Second, ctx is the hard
+// deadline: if the WorkFunc hasn't returned by the time ctx is done,
+// ShutdownContext returns ctx.Err() without waiting for it any longer. The
+// WorkFunc keeps running in the background until it returns, and the Worker
+// stops right after.
+func (w *Worker) ShutdownContext(ctx context.Context) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	if w.done {
-		return
+		return nil
 	}
 
 	log.Println("worker shutting down gracefully...")
-	w.ch <- struct{}{}
+	w.cancel()
+	var err error
+	select {
+	case w.ch <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 	w.done = true
 	close(w.ch)
+	return err
 }
 
 // recoverPanic tries to handle panics in job execution.
 // A stacktrace is stored into Job last_error.
-func recoverPanic(j *Job) {
+func (w *Worker) recoverPanic(j *Job, start time.Time) {
 	if r := recover(); r != nil {
+		j.rollback()
+		if err := j.reacquire(); err != nil {
+			log.Printf("attempting to reacquire connection for job %d: %v", j.ID, err)
+			return
+		}
+
 		// record an error on the job with panic message and stacktrace
 		stackBuf := make([]byte, 1024)
 		n := runtime.Stack(stackBuf, false)
@@ -162,9 +797,14 @@ func recoverPanic(j *Job) {
 		fmt.Fprintln(buf, "[...]")
 		stacktrace := buf.String()
 		log.Printf("event=panic job_id=%d job_type=%s\n%s", j.ID, j.Type, stacktrace)
-		if err := j.Error(stacktrace); err != nil {
+		if dead, err := j.panicked(stacktrace, w.MaxPanics); err != nil {
 			log.Printf("attempting to save error on job %d: %v", j.ID, err)
+		} else if dead {
+			log.Printf("event=job_quarantined job_id=%d job_type=%s", j.ID, j.Type)
+		} else {
+			w.cooldown(j)
 		}
+		w.observe(j, start, fmt.Errorf("panic: %v", r))
 	}
 }
 
@@ -175,19 +815,147 @@ type WorkerPool struct {
 	Interval time.Duration
 	Queue    string
 
-	c       *Client
-	workers []*Worker
-	mu      sync.Mutex
-	done    bool
+	// PollBatchSize is passed on to each of the Workers in the pool. See
+	// Worker.PollBatchSize.
+	PollBatchSize int
+
+	// MaxPanics is passed on to each of the Workers in the pool. See
+	// Worker.MaxPanics.
+	MaxPanics int
+
+	// RetryPolicy is passed on to each of the Workers in the pool. See
+	// Worker.RetryPolicy.
+	RetryPolicy RetryPolicy
+
+	// RetryCooldown is passed on to each of the Workers in the pool. See
+	// Worker.RetryCooldown.
+	RetryCooldown time.Duration
+
+	// ErrorBatchWindow is passed on to each of the Workers in the pool. See
+	// Worker.ErrorBatchWindow.
+	ErrorBatchWindow time.Duration
+
+	// CancelCheckInterval is passed on to each of the Workers in the pool.
+	// See Worker.CancelCheckInterval.
+	CancelCheckInterval time.Duration
+
+	// TreatCancelledSuccessAsRetry is passed on to each of the Workers in the
+	// pool. See Worker.TreatCancelledSuccessAsRetry.
+	TreatCancelledSuccessAsRetry bool
+
+	// DetectGoroutineLeaks is passed on to each of the Workers in the pool,
+	// which share the counts by job type. See Worker.DetectGoroutineLeaks.
+	DetectGoroutineLeaks bool
+
+	// MaxJobsBeforeRecycle and MaxConnAge are passed on to each of the
+	// Workers in the pool. See Worker.MaxJobsBeforeRecycle.
+	MaxJobsBeforeRecycle int
+	MaxConnAge           time.Duration
+
+	// Affinity partitions the Queue between the Workers in the pool by Job ID,
+	// so that they don't contend for the same Jobs. Without it, Workers that
+	// poll at the same time all try to lock the Job at the head of the Queue
+	// and the losers move on to the next one, which gets expensive for large
+	// pools on a single busy Queue. With it, each Worker only looks at its own
+	// slice, at the cost of less even load balancing: a Job may wait for its
+	// Worker while others are idle. Pools of the same size in other processes
+	// share the same partitions. It is off by default. See Worker.Partitions.
+	Affinity bool
+
+	// Listen makes the pool LISTEN for the notifications sent by a Client with
+	// Notify set, so an idle Worker starts working a new Job on Queue as soon
+	// as it is committed rather than at its next poll. Notifications about
+	// other queues or about Jobs scheduled for later are ignored. Listening
+	// holds one connection from the pool for as long as the pool runs.
+	Listen bool
+
+	// ListenMaxPriority, if not zero, limits the notifications that wake
+	// idle Workers to those about Jobs with a Priority of at most
+	// ListenMaxPriority, that is, at least as urgent. Other Jobs are found at
+	// the next poll.
+	ListenMaxPriority int16
+
+	// Stats, if set, is called with the outcome of every Job worked by any of
+	// the Workers in the pool. It may be called concurrently.
+	Stats func(JobStats)
+
+	// Labels is passed on to each of the Workers in the pool. It may be called
+	// concurrently. See Worker.Labels.
+	Labels LabelFunc
+
+	// TraceExtractor is passed on to each of the Workers in the pool. It may
+	// be called concurrently. See Worker.TraceExtractor.
+	TraceExtractor TraceExtractor
+
+	// DuplicateWindow enables the detection of duplicate executions by any of
+	// the Workers in the pool. See Worker.DuplicateWindow.
+	DuplicateWindow time.Duration
+
+	// Ack is passed on to each of the Workers in the pool. See Worker.Ack.
+	Ack AckMode
+
+	// RoutingShards and RoutingShard are passed on to each of the Workers in
+	// the pool, which all own the same shard. See Worker.RoutingShards.
+	RoutingShards int
+	RoutingShard  int
+
+	// SingleFlight and SingleFlightAcrossProcesses are passed on to each of
+	// the Workers in the pool, which share a single set of busy keys. See
+	// Worker.SingleFlight.
+	SingleFlight                func(*Job) string
+	SingleFlightAcrossProcesses bool
+
+	// Admit is passed on to each of the Workers in the pool. It may be called
+	// concurrently. See Worker.Admit.
+	Admit func(*Job) (AdmitDecision, error)
+
+	// Optimistic is passed on to each of the Workers in the pool. It may be
+	// called concurrently. See Worker.Optimistic.
+	Optimistic func(*Job) (lease time.Duration)
+
+	// PauseCheckInterval is passed on to each of the Workers in the pool,
+	// which share a single cached flag. See Worker.PauseCheckInterval.
+	PauseCheckInterval time.Duration
+
+	// LockFilter is passed on to each of the Workers in the pool. See
+	// Worker.LockFilter.
+	LockFilter *LockFilter
+
+	// TenantKey is passed on to each of the Workers in the pool, which take
+	// turns between the tenants together. See Worker.TenantKey.
+	TenantKey *TenantKey
+
+	// MaxWeight caps the total weight of the Jobs being worked at once by the
+	// Workers in the pool, where the weight of a Job is the one set for its
+	// type with SetWeight, to keep Jobs that need a lot of memory from running
+	// all at once. A Worker that locked a Job which doesn't fit in what is
+	// left of the budget waits, keeping the Job locked, until enough weight is
+	// released; a Job heavier than MaxWeight runs alone among weighted Jobs.
+	// If the pool shuts down in the meantime, the Job is unlocked without
+	// being worked. Jobs of types without a weight are never held back. The
+	// default, zero, disables the limit.
+	MaxWeight int64
+
+	c          *Client
+	weights    *weightBudget
+	metrics    *metrics
+	workers    []*Worker
+	stopListen context.CancelFunc
+	listenDone chan struct{}
+	mu         sync.Mutex
+	done       bool
 }
 
 // NewWorkerPool creates a new WorkerPool with count workers using the Client c.
 func NewWorkerPool(c *Client, wm WorkMap, count int) *WorkerPool {
 	return &WorkerPool{
-		c:        c,
-		WorkMap:  wm,
-		Interval: defaultWakeInterval,
-		workers:  make([]*Worker, count),
+		c:         c,
+		WorkMap:   wm,
+		Interval:  defaultWakeInterval,
+		MaxPanics: defaultMaxPanics,
+		metrics:   newMetrics(),
+		weights:   newWeightBudget(),
+		workers:   make([]*Worker, count),
 	}
 }
 
@@ -196,36 +964,124 @@ func (w *WorkerPool) Start() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	var wake chan struct{}
+	if w.Listen {
+		wake = make(chan struct{})
+		var ctx context.Context
+		ctx, w.stopListen = context.WithCancel(context.Background())
+		w.listenDone = make(chan struct{})
+		go func() {
+			defer close(w.listenDone)
+			listen(ctx, w.c, w.Queue, w.ListenMaxPriority, wake)
+		}()
+	}
+
+	var dupes *duplicates
+	if w.DuplicateWindow > 0 {
+		dupes = newDuplicates(w.DuplicateWindow)
+	}
+	flights := newSingleFlight()
+	pause := &pauseCache{}
+	leaks := newLeakDetector()
+	tenants := &tenantCursor{}
+	w.weights.mu.Lock()
+	w.weights.max = w.MaxWeight
+	w.weights.mu.Unlock()
+
 	for i := range w.workers {
 		w.workers[i] = NewWorker(w.c, w.WorkMap)
+		w.workers[i].wake = wake
 		w.workers[i].Interval = w.Interval
 		w.workers[i].Queue = w.Queue
+		w.workers[i].PollBatchSize = w.PollBatchSize
+		w.workers[i].MaxPanics = w.MaxPanics
+		w.workers[i].RetryPolicy = w.RetryPolicy
+		w.workers[i].RetryCooldown = w.RetryCooldown
+		w.workers[i].ErrorBatchWindow = w.ErrorBatchWindow
+		w.workers[i].DetectGoroutineLeaks = w.DetectGoroutineLeaks
+		w.workers[i].CancelCheckInterval = w.CancelCheckInterval
+		w.workers[i].TreatCancelledSuccessAsRetry = w.TreatCancelledSuccessAsRetry
+		w.workers[i].MaxJobsBeforeRecycle = w.MaxJobsBeforeRecycle
+		w.workers[i].MaxConnAge = w.MaxConnAge
+		w.workers[i].leaks = leaks
+		if w.Affinity {
+			w.workers[i].Partitions = len(w.workers)
+			w.workers[i].Partition = i
+		}
+		w.workers[i].Stats = w.Stats
+		w.workers[i].Labels = w.Labels
+		w.workers[i].TraceExtractor = w.TraceExtractor
+		w.workers[i].DuplicateWindow = w.DuplicateWindow
+		w.workers[i].duplicates = dupes
+		w.workers[i].Ack = w.Ack
+		w.workers[i].RoutingShards = w.RoutingShards
+		w.workers[i].RoutingShard = w.RoutingShard
+		w.workers[i].SingleFlight = w.SingleFlight
+		w.workers[i].Admit = w.Admit
+		w.workers[i].Optimistic = w.Optimistic
+		w.workers[i].SingleFlightAcrossProcesses = w.SingleFlightAcrossProcesses
+		w.workers[i].singleFlight = flights
+		w.workers[i].PauseCheckInterval = w.PauseCheckInterval
+		w.workers[i].pause = pause
+		w.workers[i].LockFilter = w.LockFilter
+		w.workers[i].TenantKey = w.TenantKey
+		w.workers[i].tenants = tenants
+		w.workers[i].weights = w.weights
+		w.workers[i].metrics = w.metrics
 		go w.workers[i].Work()
 	}
 }
 
+// Metrics returns the per-type outcomes of the Jobs worked by all of the
+// Workers in the pool since the previous call to Metrics, and resets them.
+func (w *WorkerPool) Metrics() Metrics {
+	return w.metrics.snapshot()
+}
+
 // Shutdown sends a Shutdown signal to each of the Workers in the WorkerPool and
 // waits for them all to finish shutting down.
 func (w *WorkerPool) Shutdown() {
+	w.ShutdownContext(context.Background())
+}
+
+// ShutdownContext is like Shutdown, but gives up waiting for the Workers' current
+// jobs when ctx is done. The contexts of all the jobs being worked are cancelled
+// right away, so they can wrap up before the deadline; see
+// Worker.ShutdownContext. It returns ctx.Err() if any Worker was still working
+// a job when ctx was done.
+func (w *WorkerPool) ShutdownContext(ctx context.Context) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	if w.done {
-		return
+		return nil
 	}
 	var wg sync.WaitGroup
 	wg.Add(len(w.workers))
 
-	for _, worker := range w.workers {
-		go func(worker *Worker) {
+	errs := make([]error, len(w.workers))
+	for i, worker := range w.workers {
+		go func(i int, worker *Worker) {
 			// If Shutdown is called before Start has been called,
 			// then these are nil, so don't try to close them
 			if worker != nil {
-				worker.Shutdown()
+				errs[i] = worker.ShutdownContext(ctx)
 			}
 			wg.Done()
-		}(worker)
+		}(i, worker)
 	}
 	wg.Wait()
+
+	if w.stopListen != nil {
+		w.stopListen()
+		<-w.listenDone
+	}
 	w.done = true
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
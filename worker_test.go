@@ -2,12 +2,15 @@ package que
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgtype"
 )
@@ -88,6 +91,85 @@ func BenchmarkWorker(b *testing.B) {
 	}
 }
 
+// BenchmarkWorkerPollBatchSize measures locking a job from behind a number of
+// jobs already locked by other workers, for several PollBatchSize values.
+func BenchmarkWorkerPollBatchSize(b *testing.B) {
+	const locked = 20
+
+	for _, size := range []int{0, 1, 5, locked + 1} {
+		b.Run(fmt.Sprintf("PollBatchSize=%d", size), func(b *testing.B) {
+			c := openTestClientMaxConns(b, locked+2)
+			defer closePool(c.pool)
+
+			for i := 0; i < locked; i++ {
+				if err := c.Enqueue(&Job{Type: "Nil", Priority: 1}); err != nil {
+					b.Fatal(err)
+				}
+				j, err := c.LockJob("")
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer j.Done()
+			}
+
+			w := NewWorker(c, WorkMap{"Nil": nilWorker})
+			w.PollBatchSize = size
+			for i := 0; i < b.N; i++ {
+				if err := c.Enqueue(&Job{Type: "Nil", Priority: 2}); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.WorkOne()
+			}
+		})
+	}
+}
+
+func TestWorkerPollWait(t *testing.T) {
+	w := &Worker{Interval: 5 * time.Second}
+	for _, tc := range []struct{ next, want time.Duration }{
+		{0, 5 * time.Second},
+		{time.Second, time.Second},
+		{time.Minute, 5 * time.Second},
+	} {
+		w.nextReady = tc.next
+		if got := w.pollWait(); got != tc.want {
+			t.Errorf("want pollWait()=%v with the next job in %v, got %v", tc.want, tc.next, got)
+		}
+	}
+}
+
+// BenchmarkWorkerScheduledPolls measures the number of polls it takes a Worker
+// on an otherwise idle queue to work a job scheduled shortly in the future,
+// sleeping like Work does between polls. Each poll is a single query, which
+// also tells the Worker when to poll next, so it takes two polls and about
+// 35ms rather than either a second or a poll every few milliseconds.
+func BenchmarkWorkerScheduledPolls(b *testing.B) {
+	c := openTestClient(b)
+	defer closePool(c.pool)
+
+	w := NewWorker(c, WorkMap{"Nil": nilWorker})
+	w.Interval = time.Second
+
+	polls := 0
+	for i := 0; i < b.N; i++ {
+		if err := c.Enqueue(&Job{Type: "Nil", RunAt: time.Now().Add(35 * time.Millisecond)}); err != nil {
+			b.Fatal(err)
+		}
+		for {
+			polls++
+			if w.WorkOne() {
+				break
+			}
+			time.Sleep(w.pollWait())
+		}
+	}
+	b.ReportMetric(float64(polls)/float64(b.N), "polls/op")
+}
+
 func nilWorker(j *Job) error {
 	return nil
 }
@@ -250,3 +332,515 @@ func TestWorkerWorkOneTypeNotInMap(t *testing.T) {
 	}
 
 }
+
+func TestWorkerStatsAndMetrics(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var stats []JobStats
+	wm := WorkMap{
+		"Good": func(j *Job) error { return nil },
+		"Bad":  func(j *Job) error { return fmt.Errorf("bad") },
+	}
+	w := NewWorker(c, wm)
+	w.Stats = func(s JobStats) { stats = append(stats, s) }
+
+	runAt := time.Now().Add(-time.Minute)
+	for _, typ := range []string{"Good", "Good", "Bad", "Unknown"} {
+		if err := c.Enqueue(&Job{Type: typ, RunAt: runAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for w.WorkOne() {
+	}
+
+	if len(stats) != 4 {
+		t.Fatalf("want 4 stats, got %d", len(stats))
+	}
+	for _, s := range stats {
+		if failed := s.Err != nil; failed != (s.Type != "Good") {
+			t.Errorf("want Err only for failed types, got %+v", s)
+		}
+		if s.PickupDelay < time.Minute {
+			t.Errorf("want PickupDelay >= 1m for a job ready a minute ago, got %v", s.PickupDelay)
+		}
+	}
+
+	m := w.Metrics()
+	if want, got := (TypeMetrics{Succeeded: 2}), m.Types["Good"]; got != want {
+		t.Errorf("want Good=%+v, got %+v", want, got)
+	}
+	if want, got := (TypeMetrics{Failed: 1}), m.Types["Bad"]; got != want {
+		t.Errorf("want Bad=%+v, got %+v", want, got)
+	}
+	if want, got := (TypeMetrics{Failed: 1}), m.Types["Unknown"]; got != want {
+		t.Errorf("want Unknown=%+v, got %+v", want, got)
+	}
+	if m = w.Metrics(); len(m.Types) != 0 {
+		t.Errorf("want metrics reset on read, got %+v", m.Types)
+	}
+}
+
+func TestWorkerStatsLabels(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	var stats []JobStats
+	w := NewWorker(c, WorkMap{"MyJob": nilWorker})
+	w.Stats = func(s JobStats) { stats = append(stats, s) }
+	w.Labels = func(j *Job) map[string]string {
+		var args struct{ Tenant string }
+		if err := json.Unmarshal(j.Args, &args); err != nil {
+			return nil
+		}
+		return map[string]string{"tenant": args.Tenant}
+	}
+
+	for _, args := range []string{`{"Tenant":"acme"}`, `[]`} {
+		if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(args)}); err != nil {
+			t.Fatal(err)
+		}
+		if !w.WorkOne() {
+			t.Fatal("want job worked")
+		}
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("want 2 stats, got %d", len(stats))
+	}
+	if want, got := "acme", stats[0].Labels["tenant"]; got != want {
+		t.Errorf("want tenant=%q, got %q", want, got)
+	}
+	if stats[1].Labels != nil {
+		t.Errorf("want no labels for undecodable args, got %v", stats[1].Labels)
+	}
+}
+
+func TestWorkerWorkOneSkipWrapped(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "Skipped"}); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(c, WorkMap{"Skipped": func(j *Job) error {
+		return fmt.Errorf("upstream busy: %w", ErrSkip)
+	}})
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want skipped job to remain in queue")
+	}
+	if j.ErrorCount != 0 || j.LastError.Status == pgtype.Present {
+		t.Errorf("want skipped job untouched, got %+v", j)
+	}
+}
+
+func TestWorkerWorkOneSkip(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	skippedCalls, otherCalls := 0, 0
+	wm := WorkMap{
+		"Skipped": func(j *Job) error {
+			skippedCalls++
+			return ErrSkip
+		},
+		"Other": func(j *Job) error {
+			otherCalls++
+			return nil
+		},
+	}
+	w := NewWorker(c, wm)
+	w.Interval = time.Hour
+
+	// the skipped job is at the head of the queue
+	if err := c.Enqueue(&Job{Type: "Skipped", Priority: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&Job{Type: "Other", Priority: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		w.WorkOne()
+	}
+	if skippedCalls != 1 {
+		t.Errorf("want skipped job worked once during cooldown, got %d", skippedCalls)
+	}
+	if otherCalls != 1 {
+		t.Errorf("want other job worked once, got %d", otherCalls)
+	}
+
+	// the skipped job is left untouched and unlocked
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want skipped job to remain in queue")
+	}
+	if j.Type != "Skipped" || j.ErrorCount != 0 || j.LastError.Status == pgtype.Present {
+		t.Errorf("want skipped job untouched, got %+v", j)
+	}
+
+	j2, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j2 == nil {
+		t.Fatal("want skipped job to be lockable by another worker")
+	}
+	j2.Done()
+}
+
+func TestWorkerWorkOneNotHandled(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	calls := 0
+	w := NewWorker(c, WorkMap{"Render": func(j *Job) error {
+		calls++
+		return fmt.Errorf("needs a GPU: %w", ErrNotHandled)
+	}})
+	w.Interval = time.Hour
+
+	if err := c.Enqueue(&Job{Type: "Render"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.WorkOne()
+	}
+	if calls != 1 {
+		t.Errorf("want job not locked again during cooldown, got %d calls", calls)
+	}
+
+	// the job is released untouched for another worker
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want job to be lockable by another worker")
+	}
+	defer j.Done()
+	if j.ErrorCount != 0 || j.LastError.Status == pgtype.Present {
+		t.Errorf("want job untouched, got %+v", j)
+	}
+}
+
+func TestWorkerQuarantinesPoisonJob(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	called := 0
+	wm := WorkMap{
+		"Poison": func(j *Job) error {
+			called++
+			panic("poisoned")
+		},
+	}
+	w := NewWorker(c, wm)
+	w.MaxPanics = 2
+
+	if err := c.Enqueue(&Job{Type: "Poison"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < w.MaxPanics; i++ {
+		// make the job immediately available again after its backoff
+		if _, err := c.pool.Exec(context.Background(), "UPDATE que_jobs SET run_at = now()"); err != nil {
+			t.Fatal(err)
+		}
+		if !w.WorkOne() {
+			t.Fatalf("want didWork=true on attempt %d", i+1)
+		}
+	}
+	if called != w.MaxPanics {
+		t.Errorf("want called=%d, got %d", w.MaxPanics, called)
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Fatalf("want poison job removed from que_jobs, got %+v", j)
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("want 1 dead job, got %d", len(dead))
+	}
+	if want := "Poison"; dead[0].Type != want {
+		t.Errorf("want Type=%q, got %q", want, dead[0].Type)
+	}
+	if want := int32(2); dead[0].PanicCount != want {
+		t.Errorf("want PanicCount=%d, got %d", want, dead[0].PanicCount)
+	}
+	if !strings.Contains(dead[0].LastError.String, "poisoned") {
+		t.Errorf("want LastError to contain panic message, got %q", dead[0].LastError.String)
+	}
+}
+
+func TestJobDeadLetter(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "MyJob"}); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.LockJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("wanted job, got none")
+	}
+	defer j.Done()
+
+	if err := j.DeadLetter("gave up"); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("want 1 dead job, got %d", len(dead))
+	}
+	if dead[0].ID != j.ID {
+		t.Errorf("want ID=%d, got %d", j.ID, dead[0].ID)
+	}
+	if want := "gave up"; dead[0].LastError.String != want {
+		t.Errorf("want LastError=%q, got %q", want, dead[0].LastError.String)
+	}
+	if dead[0].DiedAt.IsZero() {
+		t.Error("want non-zero DiedAt")
+	}
+}
+
+func TestWorkerWorkOneDeadLettersPermanentError(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	type args struct {
+		ID int64
+	}
+	wm := WorkMap{
+		"MyJob": TypedWorkFunc(func(j *Job, a args) error {
+			t.Error("handler should not be called")
+			return nil
+		}),
+	}
+	w := NewWorker(c, wm)
+
+	if err := c.Enqueue(&Job{Type: "MyJob", Args: []byte(`{"ID": "not-a-number"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if !w.WorkOne() {
+		t.Fatal("want didWork=true")
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Fatalf("want job removed from que_jobs, got %+v", j)
+	}
+
+	dead, err := c.DeadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("want 1 dead job, got %d", len(dead))
+	}
+	if !strings.Contains(dead[0].LastError.String, "ID") {
+		t.Errorf("want LastError to name the offending field, got %q", dead[0].LastError.String)
+	}
+}
+
+func TestWorkerPoolShutdownContextCancelsJobs(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	started := make(chan struct{})
+	checkpointed := make(chan struct{})
+	wm := WorkMap{
+		"LongJob": func(j *Job) error {
+			close(started)
+			select {
+			case <-j.Context().Done():
+				close(checkpointed)
+				j.Reschedule(time.Now())
+				return nil
+			case <-time.After(time.Minute):
+				return errors.New("not cancelled")
+			}
+		},
+	}
+	if err := c.Enqueue(&Job{Type: "LongJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wp := NewWorkerPool(c, wm, 1)
+	wp.Interval = 10 * time.Millisecond
+	wp.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wp.ShutdownContext(ctx); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	select {
+	case <-checkpointed:
+	default:
+		t.Fatal("want job to observe cancellation before shutdown returns")
+	}
+
+	// the job was rescheduled rather than deleted
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want rescheduled job, got none")
+	}
+}
+
+func TestWorkerShutdownContextDeadline(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wm := WorkMap{
+		"StubbornJob": func(j *Job) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}
+	if err := c.Enqueue(&Job{Type: "StubbornJob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(c, wm)
+	w.Interval = 10 * time.Millisecond
+	finished := make(chan struct{})
+	go func() {
+		w.Work()
+		close(finished)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.ShutdownContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want context.DeadlineExceeded, got %v", err)
+	}
+
+	// the worker still stops once the job returns
+	close(release)
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("want worker to stop after the job returned")
+	}
+}
+
+func TestWorkerTreatCancelledSuccessAsRetry(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	for _, retry := range []bool{false, true} {
+		if err := c.Enqueue(&Job{Type: "IgnoresCancel"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var w *Worker
+		w = NewWorker(c, WorkMap{
+			"IgnoresCancel": func(j *Job) error {
+				w.cancel() // as if shutting down
+				<-j.Context().Done()
+				return nil
+			},
+		})
+		w.TreatCancelledSuccessAsRetry = retry
+		if !w.WorkOne() {
+			t.Fatal("want job worked")
+		}
+
+		j, err := findOneJob(c.pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !retry {
+			if j != nil {
+				t.Errorf("want job completed, got %+v", j)
+			}
+			continue
+		}
+		if j == nil {
+			t.Fatal("want job kept for retry, got none")
+		}
+		if j.ErrorCount != 1 {
+			t.Errorf("want ErrorCount=1, got %d", j.ErrorCount)
+		}
+		if !strings.Contains(j.LastError.String, "context canceled") {
+			t.Errorf("want LastError to mention the cancellation, got %q", j.LastError.String)
+		}
+	}
+}
+
+func TestWorkerTreatCancelledSuccessAsRetryRescheduled(t *testing.T) {
+	c := openTestClient(t)
+	defer closePool(c.pool)
+
+	if err := c.Enqueue(&Job{Type: "Reschedules"}); err != nil {
+		t.Fatal(err)
+	}
+
+	runAt := time.Now().Add(time.Hour)
+	var w *Worker
+	w = NewWorker(c, WorkMap{
+		"Reschedules": func(j *Job) error {
+			w.cancel() // as if shutting down
+			<-j.Context().Done()
+			j.Reschedule(runAt)
+			return nil
+		},
+	})
+	w.TreatCancelledSuccessAsRetry = true
+	if !w.WorkOne() {
+		t.Fatal("want job worked")
+	}
+
+	j, err := findOneJob(c.pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("want job rescheduled, got none")
+	}
+	if j.ErrorCount != 0 {
+		t.Errorf("want ErrorCount=0, got %d", j.ErrorCount)
+	}
+	if j.RunAt.Sub(runAt).Round(time.Second) != 0 {
+		t.Errorf("want RunAt=%v, got %v", runAt, j.RunAt)
+	}
+}